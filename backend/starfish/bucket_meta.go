@@ -0,0 +1,331 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/versity/versitygw/auth"
+	"github.com/versity/versitygw/backend/meta"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+// Collections live in Starfish, so the S3 level bucket settings are kept
+// in a gateway side metadata store keyed by bucket name
+const (
+	aclkey       = "acl"
+	ownershipkey = "ownership"
+	policykey    = "policy"
+	taggingkey   = "bucket-tagging"
+)
+
+// checkBucket returns NoSuchBucket if the bucket is not a known collection
+func (b *StarfishBackend) checkBucket(bucket string) error {
+	if _, exists := b.GetCollectionTag(bucket); !exists {
+		return s3err.GetAPIError(s3err.ErrNoSuchBucket)
+	}
+	return nil
+}
+
+// retrieveBucketAttribute reads a bucket setting from the metadata store,
+// returning meta.ErrNoSuchKey if it was never set
+func (b *StarfishBackend) retrieveBucketAttribute(bucket, attribute string) ([]byte, error) {
+	if b.meta == nil {
+		return nil, meta.ErrNoSuchKey
+	}
+	return b.meta.RetrieveAttribute(nil, bucket, "", attribute)
+}
+
+// storeBucketAttribute writes a bucket setting to the metadata store, or
+// removes it if value is nil
+func (b *StarfishBackend) storeBucketAttribute(bucket, attribute string, value []byte) error {
+	// Without a metadata store settings cannot be kept, refuse rather
+	// than silently dropping them
+	if b.meta == nil {
+		return s3err.GetAPIError(s3err.ErrNotImplemented)
+	}
+
+	if value == nil {
+		err := b.meta.DeleteAttribute(bucket, "", attribute)
+		if err != nil && !errors.Is(err, meta.ErrNoSuchKey) {
+			return fmt.Errorf("delete %v: %w", attribute, err)
+		}
+		return nil
+	}
+
+	if err := b.meta.StoreAttribute(nil, bucket, "", attribute, value); err != nil {
+		return fmt.Errorf("set %v: %w", attribute, err)
+	}
+	return nil
+}
+
+// bucketACL returns the stored ACL of a bucket. Collections without a
+// stored ACL are owned by the configured default owner, if any.
+func (b *StarfishBackend) bucketACL(bucket string) ([]byte, error) {
+	data, err := b.retrieveBucketAttribute(bucket, aclkey)
+	if errors.Is(err, meta.ErrNoSuchKey) {
+		if b.defaultOwner == "" {
+			return []byte{}, nil
+		}
+		return json.Marshal(auth.ACL{Owner: b.defaultOwner})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get acl: %w", err)
+	}
+	return data, nil
+}
+
+// ListBuckets returns available buckets based on discovered Collection tags.
+// Non-admin users only see the collections they own.
+func (b *StarfishBackend) ListBuckets(_ context.Context, input s3response.ListBucketsInput) (s3response.ListAllMyBucketsResult, error) {
+	names := b.sortedBucketNames()
+
+	var cToken string
+
+	var buckets []s3response.ListAllMyBucketsEntry
+	for _, name := range names {
+		if len(input.Prefix) > 0 && (len(name) < len(input.Prefix) || name[:len(input.Prefix)] != input.Prefix) {
+			continue
+		}
+
+		if len(buckets) == int(input.MaxBuckets) {
+			cToken = buckets[len(buckets)-1].Name
+			break
+		}
+
+		if name <= input.ContinuationToken {
+			continue
+		}
+
+		// return all the buckets for admin users
+		if !input.IsAdmin {
+			aclJSON, err := b.bucketACL(name)
+			if err != nil {
+				return s3response.ListAllMyBucketsResult{}, err
+			}
+
+			acl, err := auth.ParseACL(aclJSON)
+			if err != nil {
+				return s3response.ListAllMyBucketsResult{}, err
+			}
+
+			if acl.Owner != input.Owner {
+				continue
+			}
+		}
+
+		// Starfish has no creation time for collections
+		buckets = append(buckets, s3response.ListAllMyBucketsEntry{
+			Name:         name,
+			CreationDate: b.startTime,
+		})
+	}
+
+	return s3response.ListAllMyBucketsResult{
+		Buckets: s3response.ListAllMyBucketsList{
+			Bucket: buckets,
+		},
+		Owner: s3response.CanonicalUser{
+			ID: input.Owner,
+		},
+		Prefix:            input.Prefix,
+		ContinuationToken: cToken,
+	}, nil
+}
+
+// sortedBucketNames returns the names of all collections in S3 order
+func (b *StarfishBackend) sortedBucketNames() []string {
+	b.collectionsMux.RLock()
+	names := make([]string, 0, len(b.collections))
+	for name := range b.collections {
+		names = append(names, name)
+	}
+	b.collectionsMux.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// ListBucketsAndOwners returns all collections along with their owners
+func (b *StarfishBackend) ListBucketsAndOwners(_ context.Context) ([]s3response.Bucket, error) {
+	var buckets []s3response.Bucket
+	for _, name := range b.sortedBucketNames() {
+		aclJSON, err := b.bucketACL(name)
+		if err != nil {
+			return nil, err
+		}
+
+		acl, err := auth.ParseACL(aclJSON)
+		if err != nil {
+			return nil, fmt.Errorf("parse acl tag: %w", err)
+		}
+
+		buckets = append(buckets, s3response.Bucket{
+			Name:  name,
+			Owner: acl.Owner,
+		})
+	}
+
+	return buckets, nil
+}
+
+// GetBucketAcl retrieves the ACL for a bucket (collection)
+func (b *StarfishBackend) GetBucketAcl(_ context.Context, input *s3.GetBucketAclInput) ([]byte, error) {
+	if input.Bucket == nil {
+		return nil, s3err.GetAPIError(s3err.ErrInvalidBucketName)
+	}
+	if err := b.checkBucket(*input.Bucket); err != nil {
+		return nil, err
+	}
+
+	return b.bucketACL(*input.Bucket)
+}
+
+// PutBucketAcl sets the ACL for a bucket (collection)
+func (b *StarfishBackend) PutBucketAcl(_ context.Context, bucket string, data []byte) error {
+	if err := b.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	return b.storeBucketAttribute(bucket, aclkey, data)
+}
+
+// ChangeBucketOwner replaces the ACL of a collection with one naming the
+// new owner
+func (b *StarfishBackend) ChangeBucketOwner(ctx context.Context, bucket string, acl []byte) error {
+	return b.PutBucketAcl(ctx, bucket, acl)
+}
+
+// PutBucketPolicy sets the bucket policy for a collection, a nil policy
+// removes it
+func (b *StarfishBackend) PutBucketPolicy(_ context.Context, bucket string, policy []byte) error {
+	if err := b.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	return b.storeBucketAttribute(bucket, policykey, policy)
+}
+
+// GetBucketPolicy retrieves the bucket policy for a collection
+func (b *StarfishBackend) GetBucketPolicy(_ context.Context, bucket string) ([]byte, error) {
+	if err := b.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	policy, err := b.retrieveBucketAttribute(bucket, policykey)
+	if errors.Is(err, meta.ErrNoSuchKey) {
+		return nil, s3err.GetAPIError(s3err.ErrNoSuchBucketPolicy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get bucket policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// DeleteBucketPolicy deletes the bucket policy for a collection
+func (b *StarfishBackend) DeleteBucketPolicy(ctx context.Context, bucket string) error {
+	return b.PutBucketPolicy(ctx, bucket, nil)
+}
+
+// PutBucketOwnershipControls sets the object ownership setting of a collection
+func (b *StarfishBackend) PutBucketOwnershipControls(_ context.Context, bucket string, ownership types.ObjectOwnership) error {
+	if err := b.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	return b.storeBucketAttribute(bucket, ownershipkey, []byte(ownership))
+}
+
+// GetBucketOwnershipControls retrieves the object ownership setting of a collection
+func (b *StarfishBackend) GetBucketOwnershipControls(_ context.Context, bucket string) (types.ObjectOwnership, error) {
+	var ownship types.ObjectOwnership
+	if err := b.checkBucket(bucket); err != nil {
+		return ownship, err
+	}
+
+	ownership, err := b.retrieveBucketAttribute(bucket, ownershipkey)
+	if errors.Is(err, meta.ErrNoSuchKey) {
+		return ownship, s3err.GetAPIError(s3err.ErrOwnershipControlsNotFound)
+	}
+	if err != nil {
+		return ownship, fmt.Errorf("get bucket ownership status: %w", err)
+	}
+
+	return types.ObjectOwnership(ownership), nil
+}
+
+// DeleteBucketOwnershipControls removes the object ownership setting of a collection
+func (b *StarfishBackend) DeleteBucketOwnershipControls(_ context.Context, bucket string) error {
+	if err := b.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	return b.storeBucketAttribute(bucket, ownershipkey, nil)
+}
+
+// PutBucketTagging sets the tags of a collection, nil tags remove them
+func (b *StarfishBackend) PutBucketTagging(_ context.Context, bucket string, tags map[string]string) error {
+	if err := b.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	var data []byte
+	if tags != nil {
+		var err error
+		data, err = json.Marshal(tags)
+		if err != nil {
+			return fmt.Errorf("marshal tags: %w", err)
+		}
+	}
+
+	return b.storeBucketAttribute(bucket, taggingkey, data)
+}
+
+// GetBucketTagging retrieves the tags of a collection
+func (b *StarfishBackend) GetBucketTagging(_ context.Context, bucket string) (map[string]string, error) {
+	if err := b.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	data, err := b.retrieveBucketAttribute(bucket, taggingkey)
+	if errors.Is(err, meta.ErrNoSuchKey) {
+		return nil, s3err.GetAPIError(s3err.ErrBucketTaggingNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get tags: %w", err)
+	}
+
+	tags := make(map[string]string)
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("parse tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// DeleteBucketTagging removes the tags of a collection
+func (b *StarfishBackend) DeleteBucketTagging(ctx context.Context, bucket string) error {
+	return b.PutBucketTagging(ctx, bucket, nil)
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/versity/versitygw/auth"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+// newMetaBackend creates a backend storing bucket settings in dir, as a
+// gateway restarted with the same --metadata-dir would
+func newMetaBackend(t *testing.T, dir, defaultOwner string) *StarfishBackend {
+	t.Helper()
+
+	backend, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:  "http://localhost",
+		BearerToken:  "test-token",
+		CacheTTL:     time.Minute,
+		MetadataDir:  dir,
+		DefaultOwner: defaultOwner,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.AddCollection("test-bucket", "Collections:TestCollection")
+	backend.AddCollection("another-bucket", "Collections:AnotherCollection")
+
+	return backend
+}
+
+func TestBucketPolicySurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	policy := `{
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Principal": ["alice"],
+				"Action": ["s3:GetObject"],
+				"Resource": ["arn:aws:s3:::test-bucket/*"]
+			}
+		]
+	}`
+	if err := newMetaBackend(t, dir, "").PutBucketPolicy(ctx, "test-bucket", []byte(policy)); err != nil {
+		t.Fatalf("PutBucketPolicy failed: %v", err)
+	}
+
+	backend := newMetaBackend(t, dir, "")
+
+	stored, err := backend.GetBucketPolicy(ctx, "test-bucket")
+	if err != nil {
+		t.Fatalf("GetBucketPolicy failed: %v", err)
+	}
+	if string(stored) != policy {
+		t.Errorf("expected stored policy, got %s", stored)
+	}
+
+	opts := func(access string) auth.AccessOptions {
+		return auth.AccessOptions{
+			AclPermission: auth.PermissionRead,
+			Acc:           auth.Account{Access: access, Role: auth.RoleUser},
+			Bucket:        "test-bucket",
+			Object:        "data/file.txt",
+			Action:        auth.GetObjectAction,
+		}
+	}
+
+	if err := auth.VerifyAccess(ctx, backend, opts("alice")); err != nil {
+		t.Errorf("expected policy to grant alice access, got %v", err)
+	}
+	if err := auth.VerifyAccess(ctx, backend, opts("bob")); err == nil {
+		t.Error("expected bob to be denied access")
+	}
+
+	// Other collections are not affected
+	if _, err := backend.GetBucketPolicy(ctx, "another-bucket"); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchBucketPolicy)) {
+		t.Errorf("expected NoSuchBucketPolicy, got %v", err)
+	}
+
+	if err := backend.DeleteBucketPolicy(ctx, "test-bucket"); err != nil {
+		t.Fatalf("DeleteBucketPolicy failed: %v", err)
+	}
+	if err := auth.VerifyAccess(ctx, newMetaBackend(t, dir, ""), opts("alice")); err == nil {
+		t.Error("expected alice to be denied access after the policy was deleted")
+	}
+}
+
+func TestBucketAclSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	acl, err := json.Marshal(auth.ACL{
+		Owner: "alice",
+		Grantees: []auth.Grantee{
+			{Permission: auth.PermissionFullControl, Access: "alice", Type: types.TypeCanonicalUser},
+			{Permission: auth.PermissionRead, Access: "bob", Type: types.TypeCanonicalUser},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal acl: %v", err)
+	}
+	if err := newMetaBackend(t, dir, "").PutBucketAcl(ctx, "test-bucket", acl); err != nil {
+		t.Fatalf("PutBucketAcl failed: %v", err)
+	}
+
+	backend := newMetaBackend(t, dir, "")
+
+	// The gateway parses the stored ACL and hands it to VerifyAccess
+	bucket := "test-bucket"
+	data, err := backend.GetBucketAcl(ctx, &s3.GetBucketAclInput{Bucket: &bucket})
+	if err != nil {
+		t.Fatalf("GetBucketAcl failed: %v", err)
+	}
+	parsed, err := auth.ParseACL(data)
+	if err != nil {
+		t.Fatalf("ParseACL failed: %v", err)
+	}
+	if parsed.Owner != "alice" {
+		t.Errorf("expected owner alice, got %q", parsed.Owner)
+	}
+
+	opts := func(access string, permission auth.Permission, action auth.Action) auth.AccessOptions {
+		return auth.AccessOptions{
+			Acl:           parsed,
+			AclPermission: permission,
+			Acc:           auth.Account{Access: access, Role: auth.RoleUser},
+			Bucket:        bucket,
+			Object:        "data/file.txt",
+			Action:        action,
+		}
+	}
+
+	if err := auth.VerifyAccess(ctx, backend, opts("bob", auth.PermissionRead, auth.GetObjectAction)); err != nil {
+		t.Errorf("expected ACL to grant bob read access, got %v", err)
+	}
+	if err := auth.VerifyAccess(ctx, backend, opts("bob", auth.PermissionWrite, auth.PutObjectAction)); err == nil {
+		t.Error("expected bob to be denied write access")
+	}
+	if err := auth.VerifyAccess(ctx, backend, opts("carol", auth.PermissionRead, auth.GetObjectAction)); err == nil {
+		t.Error("expected carol to be denied access")
+	}
+
+	// Non-admin users only list the collections they own
+	result, err := backend.ListBuckets(ctx, s3response.ListBucketsInput{Owner: "alice", MaxBuckets: 1000})
+	if err != nil {
+		t.Fatalf("ListBuckets failed: %v", err)
+	}
+	if len(result.Buckets.Bucket) != 1 || result.Buckets.Bucket[0].Name != "test-bucket" {
+		t.Errorf("expected alice to list test-bucket only, got %v", result.Buckets.Bucket)
+	}
+
+	result, err = backend.ListBuckets(ctx, s3response.ListBucketsInput{Owner: "admin", IsAdmin: true, MaxBuckets: 1000})
+	if err != nil {
+		t.Fatalf("ListBuckets failed: %v", err)
+	}
+	if len(result.Buckets.Bucket) != 2 || result.Buckets.Bucket[0].Name != "another-bucket" {
+		t.Errorf("expected admin to list all collections in order, got %v", result.Buckets.Bucket)
+	}
+}
+
+func TestBucketSettingsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	backend := newMetaBackend(t, dir, "")
+	if err := backend.PutBucketTagging(ctx, "test-bucket", map[string]string{"team": "genomics"}); err != nil {
+		t.Fatalf("PutBucketTagging failed: %v", err)
+	}
+	if err := backend.PutBucketOwnershipControls(ctx, "test-bucket", types.ObjectOwnershipBucketOwnerEnforced); err != nil {
+		t.Fatalf("PutBucketOwnershipControls failed: %v", err)
+	}
+
+	backend = newMetaBackend(t, dir, "")
+
+	tags, err := backend.GetBucketTagging(ctx, "test-bucket")
+	if err != nil {
+		t.Fatalf("GetBucketTagging failed: %v", err)
+	}
+	if tags["team"] != "genomics" {
+		t.Errorf("expected team tag, got %v", tags)
+	}
+
+	ownership, err := backend.GetBucketOwnershipControls(ctx, "test-bucket")
+	if err != nil {
+		t.Fatalf("GetBucketOwnershipControls failed: %v", err)
+	}
+	if ownership != types.ObjectOwnershipBucketOwnerEnforced {
+		t.Errorf("expected BucketOwnerEnforced, got %q", ownership)
+	}
+
+	if err := backend.DeleteBucketTagging(ctx, "test-bucket"); err != nil {
+		t.Fatalf("DeleteBucketTagging failed: %v", err)
+	}
+	if _, err := backend.GetBucketTagging(ctx, "test-bucket"); !errors.Is(err, s3err.GetAPIError(s3err.ErrBucketTaggingNotFound)) {
+		t.Errorf("expected BucketTaggingNotFound, got %v", err)
+	}
+
+	if err := backend.DeleteBucketOwnershipControls(ctx, "test-bucket"); err != nil {
+		t.Fatalf("DeleteBucketOwnershipControls failed: %v", err)
+	}
+	if _, err := backend.GetBucketOwnershipControls(ctx, "test-bucket"); !errors.Is(err, s3err.GetAPIError(s3err.ErrOwnershipControlsNotFound)) {
+		t.Errorf("expected OwnershipControlsNotFound, got %v", err)
+	}
+
+	// Settings are only kept for known collections
+	if err := backend.PutBucketTagging(ctx, "missing", map[string]string{}); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchBucket)) {
+		t.Errorf("expected NoSuchBucket, got %v", err)
+	}
+}
+
+func TestBucketSettingsWithoutMetadataDir(t *testing.T) {
+	ctx := context.Background()
+	backend := newMetaBackend(t, "", "alice")
+
+	// Collections without a stored ACL belong to the default owner
+	bucket := "test-bucket"
+	data, err := backend.GetBucketAcl(ctx, &s3.GetBucketAclInput{Bucket: &bucket})
+	if err != nil {
+		t.Fatalf("GetBucketAcl failed: %v", err)
+	}
+	acl, err := auth.ParseACL(data)
+	if err != nil {
+		t.Fatalf("ParseACL failed: %v", err)
+	}
+	if acl.Owner != "alice" {
+		t.Errorf("expected default owner alice, got %q", acl.Owner)
+	}
+
+	if _, err := backend.GetBucketPolicy(ctx, bucket); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchBucketPolicy)) {
+		t.Errorf("expected NoSuchBucketPolicy, got %v", err)
+	}
+
+	// Settings that cannot be kept are refused rather than dropped
+	if err := backend.PutBucketPolicy(ctx, bucket, []byte(`{}`)); !errors.Is(err, s3err.GetAPIError(s3err.ErrNotImplemented)) {
+		t.Errorf("expected NotImplemented, got %v", err)
+	}
+}
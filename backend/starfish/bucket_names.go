@@ -0,0 +1,123 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/versity/versitygw/s3api/utils"
+)
+
+// maxBucketNameLength is the longest valid S3 bucket name
+const maxBucketNameLength = 63
+
+// sanitizeBucketName derives a DNS-safe bucket name from a tag, zone or
+// volume name. Letters are lowercased and every run of other characters,
+// dots included, becomes a single hyphen, so "User Data" and "Archive_US"
+// become "user-data" and "archive-us". The result may still be too short
+// to be a valid bucket name.
+func sanitizeBucketName(name string) string {
+	var sb strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+
+	bucket := sb.String()
+	if len(bucket) > maxBucketNameLength {
+		bucket = strings.TrimRight(bucket[:maxBucketNameLength], "-")
+	}
+	return bucket
+}
+
+// assignBucketNames maps the discovered tags, zones or volumes, keyed by
+// name, to bucket names. Aliases take precedence over derived names, and
+// of several names deriving the same bucket name the first in sort order
+// wins. The collections left out are described by the returned warnings.
+func assignBucketNames(found, aliases map[string]string) (map[string]string, []string) {
+	collections := make(map[string]string, len(found))
+	var warnings []string
+
+	discovered := make(map[string]bool, len(found))
+	for _, source := range found {
+		discovered[source] = true
+	}
+
+	// Aliases of collections that do not exist (yet) are not served
+	aliased := make(map[string]bool, len(aliases))
+	for bucket, source := range aliases {
+		aliased[source] = true
+		if discovered[source] {
+			collections[bucket] = source
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		source := found[name]
+		if aliased[source] {
+			continue
+		}
+
+		bucket := sanitizeBucketName(name)
+		if !utils.IsValidBucketName(bucket) {
+			warnings = append(warnings, fmt.Sprintf(
+				"%s has no valid bucket name, add a bucket alias to serve it", source))
+			continue
+		}
+		if taken, ok := collections[bucket]; ok {
+			warnings = append(warnings, fmt.Sprintf(
+				"%s and %s both map to bucket %s, add a bucket alias to serve %s", taken, source, bucket, source))
+			continue
+		}
+		collections[bucket] = source
+	}
+
+	return collections, warnings
+}
+
+// addVirtualBuckets adds the buckets defined by a Starfish query to the
+// collections, mapped to their query. A virtual bucket takes precedence
+// over a collection of the same name, which is described by the returned
+// warnings.
+func addVirtualBuckets(collections, virtualBuckets map[string]string) []string {
+	var warnings []string
+	for bucket, query := range virtualBuckets {
+		if source, ok := collections[bucket]; ok {
+			warnings = append(warnings, fmt.Sprintf(
+				"virtual bucket %s hides %s, add a bucket alias to serve %s", bucket, source, source))
+		}
+		collections[bucket] = query
+	}
+	sort.Strings(warnings)
+	return warnings
+}
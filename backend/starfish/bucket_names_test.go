@@ -0,0 +1,250 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/versity/versitygw/s3response"
+)
+
+func TestSanitizeBucketName(t *testing.T) {
+	tests := map[string]string{
+		"ProjectA":              "projecta",
+		"Archive-US":            "archive-us",
+		"Archive_US":            "archive-us",
+		"User Data":             "user-data",
+		"  Spaced  Out  ":       "spaced-out",
+		"data.v2":               "data-v2",
+		"_hidden_":              "hidden",
+		"Ünïcode Names":         "n-code-names",
+		"a":                     "a",
+		strings.Repeat("x", 70): strings.Repeat("x", 63),
+	}
+	for name, expected := range tests {
+		if got := sanitizeBucketName(name); got != expected {
+			t.Errorf("sanitizeBucketName(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestAssignBucketNames(t *testing.T) {
+	found := map[string]string{
+		"Archive US": "Collections:Archive US",
+		"Archive_US": "Collections:Archive_US",
+		"User Data":  "Collections:User Data",
+		"X":          "Collections:X",
+		"Legacy":     "Collections:Legacy",
+	}
+	aliases := map[string]string{
+		"legacy-data": "Collections:Legacy",
+		"missing":     "Collections:Missing",
+	}
+
+	collections, warnings := assignBucketNames(found, aliases)
+
+	expected := map[string]string{
+		"archive-us":  "Collections:Archive US",
+		"user-data":   "Collections:User Data",
+		"legacy-data": "Collections:Legacy",
+	}
+	if !reflect.DeepEqual(collections, expected) {
+		t.Errorf("expected collections %v, got %v", expected, collections)
+	}
+
+	expectedWarnings := []string{
+		"Collections:Archive US and Collections:Archive_US both map to bucket archive-us, add a bucket alias to serve Collections:Archive_US",
+		"Collections:X has no valid bucket name, add a bucket alias to serve it",
+	}
+	if !reflect.DeepEqual(warnings, expectedWarnings) {
+		t.Errorf("expected warnings %q, got %q", expectedWarnings, warnings)
+	}
+
+	// An alias resolves the collision
+	aliases["archive-us-2"] = "Collections:Archive_US"
+	collections, warnings = assignBucketNames(found, aliases)
+	if collections["archive-us-2"] != "Collections:Archive_US" || collections["archive-us"] != "Collections:Archive US" {
+		t.Errorf("expected the alias to serve Collections:Archive_US, got %v", collections)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected only the invalid name to be reported, got %q", warnings)
+	}
+}
+
+func TestLoadBucketAliases(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	aliases, err := LoadBucketAliases(write("valid.json", `{"archive-us": "Collections:Archive_US"}`))
+	if err != nil {
+		t.Fatalf("LoadBucketAliases failed: %v", err)
+	}
+	if aliases["archive-us"] != "Collections:Archive_US" {
+		t.Errorf("unexpected aliases %v", aliases)
+	}
+
+	if aliases, err := LoadBucketAliases(""); err != nil || aliases != nil {
+		t.Errorf("expected no aliases without a file, got %v, %v", aliases, err)
+	}
+
+	for name, content := range map[string]string{
+		"invalid-name.json": `{"Archive_US": "Collections:Archive_US"}`,
+		"empty-source.json": `{"archive": ""}`,
+		"duplicate.json":    `{"archive": "Collections:Archive", "archive-2": "Collections:Archive"}`,
+	} {
+		if _, err := LoadBucketAliases(write(name, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadVirtualBuckets(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	buckets, err := LoadVirtualBuckets(write("valid.json", `{"large-logs": "ext=log size>1G volume=proj1"}`))
+	if err != nil {
+		t.Fatalf("LoadVirtualBuckets failed: %v", err)
+	}
+	if buckets["large-logs"] != "ext=log size>1G volume=proj1" {
+		t.Errorf("unexpected virtual buckets %v", buckets)
+	}
+
+	if buckets, err := LoadVirtualBuckets(""); err != nil || buckets != nil {
+		t.Errorf("expected no virtual buckets without a file, got %v, %v", buckets, err)
+	}
+
+	for name, content := range map[string]string{
+		"invalid-name.json":  `{"Large_Logs": "ext=log"}`,
+		"empty-query.json":   `{"large-logs": " "}`,
+		"not-an-object.json": `["large-logs"]`,
+	} {
+		if _, err := LoadVirtualBuckets(write(name, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestVirtualBuckets(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries = map[string]string{}
+	)
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/query/") {
+			json.NewEncoder(w).Encode([]string{"ProjectA", "Logs"})
+			return
+		}
+		mu.Lock()
+		queries[r.URL.Query().Get("query")] = r.URL.Query().Get("volumes_and_paths")
+		mu.Unlock()
+		json.NewEncoder(w).Encode([]StarfishEntry{
+			{Filename: "app.log", ParentPath: "logs", Size: 2 << 30, Volume: "proj1", Inode: 1},
+		})
+	})
+	defer server.Close()
+
+	backend, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint: server.URL,
+		BearerToken: "test-token",
+		VirtualBuckets: map[string]string{
+			"large-logs": "ext=log size>1G volume=proj1",
+			"logs":       "ext=log",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create backend: %v", err)
+	}
+	defer backend.Shutdown()
+
+	if err := backend.InitializeCollections(context.Background()); err != nil {
+		t.Fatalf("InitializeCollections failed: %v", err)
+	}
+	if len(backend.bucketNameWarnings) != 1 || !strings.Contains(backend.bucketNameWarnings[0], "Collections:Logs") {
+		t.Errorf("expected the hidden collection to be reported, got %q", backend.bucketNameWarnings)
+	}
+
+	res, err := backend.ListBuckets(context.Background(), s3response.ListBucketsInput{IsAdmin: true, MaxBuckets: 100})
+	if err != nil {
+		t.Fatalf("ListBuckets failed: %v", err)
+	}
+	var names []string
+	for _, bucket := range res.Buckets.Bucket {
+		names = append(names, bucket.Name)
+	}
+	if strings.Join(names, ",") != "large-logs,logs,projecta" {
+		t.Errorf("expected large-logs,logs,projecta, got %v", names)
+	}
+
+	bucket := "large-logs"
+	key := "logs/app.log"
+	if _, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: &bucket, Key: &key}); err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+
+	// The query of the bucket replaces the tag filter
+	mu.Lock()
+	defer mu.Unlock()
+	found := false
+	for query, volumes := range queries {
+		if strings.HasPrefix(query, "ext=log size>1G volume=proj1 ") && volumes == "" {
+			found = true
+		}
+		if strings.Contains(query, "tag=") {
+			t.Errorf("expected no tag filter in virtual bucket queries, got %q", query)
+		}
+	}
+	if !found {
+		t.Errorf("expected the virtual bucket query to be sent, got %v", queries)
+	}
+}
+
+func TestVirtualBucketsNotWritable(t *testing.T) {
+	_, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:    "http://localhost",
+		BearerToken:    "test-token",
+		FileServerURL:  "http://localhost",
+		VirtualBuckets: map[string]string{"large-logs": "ext=log"},
+		WriteConfig: &WriteConfig{Collections: map[string]WriteTarget{
+			"large-logs": {Volume: "proj1", Writable: true},
+		}},
+	})
+	if err == nil {
+		t.Error("expected a writable virtual bucket to be rejected")
+	}
+}
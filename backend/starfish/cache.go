@@ -14,21 +14,53 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
-
 package starfish
 
 import (
+	"container/list"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/versity/versitygw/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// Default budgets of the query cache
+const (
+	defaultQueryCacheEntries = 10000
+	defaultQueryCacheBytes   = 256 << 20
+
+	// queryEntryOverhead approximates the memory of a Starfish entry
+	// besides its strings
+	queryEntryOverhead = 256
+
+	// minSweepInterval bounds how often expired results are swept
+	minSweepInterval = time.Second
 )
 
-// QueryCache provides caching for Starfish query results
+// QueryCache provides caching for Starfish query results. It is bounded
+// by the number of cached results and their approximate size, the least
+// recently used results are evicted first. Expired results are kept for
+// staleTTL to be served while Starfish is unavailable, then dropped by a
+// background sweeper. Concurrent misses for the same key are coalesced
+// into a single query.
 type QueryCache struct {
-	data       map[string]*CachedResult
-	mutex      sync.RWMutex
+	mutex      sync.Mutex
+	data       map[string]*list.Element
+	lru        *list.List
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
 	defaultTTL time.Duration
+	staleTTL   time.Duration
+	evictions  int64
+	coalesced  int64
+
+	group singleflight.Group
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
 
 	// Metrics integration
 	metricsManager *metrics.Manager
@@ -36,44 +68,117 @@ type QueryCache struct {
 
 // CachedResult represents a cached query result
 type CachedResult struct {
+	Key           string
 	Data          *StarfishQueryResponse
 	CachedAt      time.Time
 	ExpiresAt     time.Time
 	VolumeAndPath string
 	HitCount      int64 // Track cache hit count for metrics
+	Size          int64 // approximate memory held by Data
 }
 
-// NewQueryCache creates a new query cache with optional metrics integration
-func NewQueryCache(defaultTTL time.Duration, metricsManager *metrics.Manager) *QueryCache {
-	return &QueryCache{
-		data:           make(map[string]*CachedResult),
+// NewQueryCache creates a new query cache with optional metrics
+// integration. Zero budgets use the defaults. A sweeper removing expired
+// results runs until Close.
+func NewQueryCache(defaultTTL, staleTTL time.Duration, maxEntries int, maxBytes int64, metricsManager *metrics.Manager) *QueryCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultQueryCacheEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultQueryCacheBytes
+	}
+
+	c := &QueryCache{
+		data:           make(map[string]*list.Element),
+		lru:            list.New(),
+		maxEntries:     maxEntries,
+		maxBytes:       maxBytes,
 		defaultTTL:     defaultTTL,
+		staleTTL:       staleTTL,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
 		metricsManager: metricsManager,
 	}
+
+	if defaultTTL > 0 {
+		go c.sweep(max((defaultTTL+staleTTL)/2, minSweepInterval))
+	} else {
+		close(c.done)
+	}
+
+	return c
+}
+
+// Close stops the background sweeper
+func (c *QueryCache) Close() {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+}
+
+// sweep removes expired results every interval until Close
+func (c *QueryCache) sweep(interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.removeExpired(now)
+		}
+	}
+}
+
+// removeExpired drops every result that expired, and is no longer kept
+// as a stale result, before now
+func (c *QueryCache) removeExpired(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expired := 0
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if now.After(elem.Value.(*CachedResult).ExpiresAt.Add(c.staleTTL)) {
+			c.remove(elem)
+			expired++
+		}
+		elem = next
+	}
+
+	if expired > 0 && c.metricsManager != nil {
+		c.metricsManager.Add("starfish_cache_expired", int64(expired))
+		c.metricsManager.Add("starfish_cache_entries", int64(len(c.data)))
+	}
 }
 
 // Get retrieves a cached result if it exists and hasn't expired
 func (c *QueryCache) Get(key string) *StarfishQueryResponse {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	cached, exists := c.data[key]
+	elem, exists := c.data[key]
 	if !exists {
 		// Cache miss - record metric
 		if c.metricsManager != nil {
-			c.metricsManager.Add("starfish_cache_miss", 1,
-				metrics.Tag{Key: "cache_key", Value: key})
+			c.metricsManager.Add("starfish_cache_miss", 1)
 		}
 		return nil
 	}
 
+	cached := elem.Value.(*CachedResult)
 	if time.Now().After(cached.ExpiresAt) {
-		// Expired, remove from cache
-		delete(c.data, key)
+		// Expired, remove from cache unless it may still be served stale
+		if c.staleTTL <= 0 {
+			c.remove(elem)
+		}
 		// Cache miss due to expiration - record metric
 		if c.metricsManager != nil {
 			c.metricsManager.Add("starfish_cache_miss", 1,
-				metrics.Tag{Key: "cache_key", Value: key},
 				metrics.Tag{Key: "reason", Value: "expired"})
 		}
 		return nil
@@ -81,36 +186,129 @@ func (c *QueryCache) Get(key string) *StarfishQueryResponse {
 
 	// Cache hit - increment hit count and record metric
 	cached.HitCount++
+	c.lru.MoveToFront(elem)
 	if c.metricsManager != nil {
-		c.metricsManager.Add("starfish_cache_hit", 1,
-			metrics.Tag{Key: "cache_key", Value: key})
-		c.metricsManager.Add("starfish_cache_hit_count", cached.HitCount,
-			metrics.Tag{Key: "cache_key", Value: key})
+		c.metricsManager.Add("starfish_cache_hit", 1)
 	}
 
 	return cached.Data
 }
 
-// Set stores a result in the cache
+// Set stores a result in the cache, evicting the least recently used
+// results to stay within the budgets. Results larger than the whole byte
+// budget are not cached.
 func (c *QueryCache) Set(key string, data *StarfishQueryResponse, volumeAndPath string) {
+	size := responseSize(key, data)
+	if size > c.maxBytes {
+		return
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	if elem, exists := c.data[key]; exists {
+		c.remove(elem)
+	}
+
 	now := time.Now()
-	c.data[key] = &CachedResult{
+	c.data[key] = c.lru.PushFront(&CachedResult{
+		Key:           key,
 		Data:          data,
 		CachedAt:      now,
 		ExpiresAt:     now.Add(c.defaultTTL),
 		VolumeAndPath: volumeAndPath,
-		HitCount:      0,
+		Size:          size,
+	})
+	c.bytes += size
+
+	evicted := 0
+	for len(c.data) > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		evicted++
 	}
+	c.evictions += int64(evicted)
 
 	// Record cache set metric
 	if c.metricsManager != nil {
-		c.metricsManager.Add("starfish_cache_set", 1,
-			metrics.Tag{Key: "cache_key", Value: key})
+		c.metricsManager.Add("starfish_cache_set", 1)
+		if evicted > 0 {
+			c.metricsManager.Add("starfish_cache_evicted", int64(evicted))
+		}
 		c.metricsManager.Add("starfish_cache_entries", int64(len(c.data)))
+		c.metricsManager.Add("starfish_cache_bytes", c.bytes)
+	}
+}
+
+// GetStale returns a cached result whether or not it has expired, for
+// use when a fresh result cannot be fetched
+func (c *QueryCache) GetStale(key string) *StarfishQueryResponse {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, exists := c.data[key]
+	if !exists {
+		return nil
+	}
+	cached := elem.Value.(*CachedResult)
+	if time.Now().After(cached.ExpiresAt.Add(c.staleTTL)) {
+		c.remove(elem)
+		return nil
+	}
+	return cached.Data
+}
+
+// GetOrLoad returns the cached result for key, or calls load to fetch and
+// cache it. Concurrent callers missing the same key share a single call
+// to load, made with the context of the first caller. Errors are returned
+// to every waiting caller and are not cached.
+func (c *QueryCache) GetOrLoad(key, volumeAndPath string, load func() (*StarfishQueryResponse, error)) (*StarfishQueryResponse, error) {
+	if c == nil {
+		return load()
+	}
+	if data := c.Get(key); data != nil {
+		return data, nil
 	}
+
+	return c.do(key, func() (*StarfishQueryResponse, error) {
+		data, err := load()
+		if err != nil {
+			return nil, err
+		}
+		c.Set(key, data, volumeAndPath)
+		return data, nil
+	})
+}
+
+// Coalesce calls load without caching its result, sharing the call with
+// concurrent callers for the same key
+func (c *QueryCache) Coalesce(key string, load func() (*StarfishQueryResponse, error)) (*StarfishQueryResponse, error) {
+	if c == nil {
+		return load()
+	}
+	return c.do(key, load)
+}
+
+// do runs load once for all concurrent callers with the same key
+func (c *QueryCache) do(key string, load func() (*StarfishQueryResponse, error)) (*StarfishQueryResponse, error) {
+	v, err, shared := c.group.Do(key, func() (interface{}, error) {
+		return load()
+	})
+	if shared {
+		c.mutex.Lock()
+		c.coalesced++
+		c.mutex.Unlock()
+		if c.metricsManager != nil {
+			c.metricsManager.Add("starfish_cache_coalesced", 1)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*StarfishQueryResponse), nil
 }
 
 // Invalidate removes a specific cache entry
@@ -118,24 +316,44 @@ func (c *QueryCache) Invalidate(key string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	if _, exists := c.data[key]; exists {
-		delete(c.data, key)
+	if elem, exists := c.data[key]; exists {
+		c.remove(elem)
 		// Record cache invalidation metric
 		if c.metricsManager != nil {
-			c.metricsManager.Add("starfish_cache_invalidate", 1,
-				metrics.Tag{Key: "cache_key", Value: key})
+			c.metricsManager.Add("starfish_cache_invalidate", 1)
 			c.metricsManager.Add("starfish_cache_entries", int64(len(c.data)))
 		}
 	}
 }
 
+// InvalidatePrefix removes every cache entry whose key starts with prefix
+func (c *QueryCache) InvalidatePrefix(prefix string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := 0
+	for key, elem := range c.data {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(elem)
+			removed++
+		}
+	}
+
+	if removed > 0 && c.metricsManager != nil {
+		c.metricsManager.Add("starfish_cache_invalidate", int64(removed))
+		c.metricsManager.Add("starfish_cache_entries", int64(len(c.data)))
+	}
+}
+
 // Clear removes all cache entries
 func (c *QueryCache) Clear() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	clearedCount := len(c.data)
-	c.data = make(map[string]*CachedResult)
+	c.data = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
 
 	// Record cache clear metric
 	if c.metricsManager != nil {
@@ -144,30 +362,49 @@ func (c *QueryCache) Clear() {
 	}
 }
 
-// Stats returns cache statistics
-func (c *QueryCache) Stats() map[string]interface{} {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-
-	valid := 0
-	expired := 0
-	totalHits := int64(0)
-	now := time.Now()
+// remove drops a cached result, the caller must hold the lock
+func (c *QueryCache) remove(elem *list.Element) {
+	cached := c.lru.Remove(elem).(*CachedResult)
+	delete(c.data, cached.Key)
+	c.bytes -= cached.Size
+}
 
-	for _, cached := range c.data {
-		if now.After(cached.ExpiresAt) {
-			expired++
-		} else {
-			valid++
-			totalHits += cached.HitCount
+// responseSize approximates the memory held by a cached query result
+func responseSize(key string, data *StarfishQueryResponse) int64 {
+	size := int64(len(key))
+	if data == nil {
+		return size
+	}
+	for _, entry := range data.Entries {
+		size += queryEntryOverhead
+		size += int64(len(entry.Filename) + len(entry.ParentPath) + len(entry.FullPath) +
+			len(entry.Mode) + len(entry.Volume) + len(entry.SizeUnit) +
+			len(entry.TagsExplicitStr) + len(entry.TagsInheritedStr) +
+			len(entry.MD5) + len(entry.SHA256))
+		for _, zone := range entry.Zones {
+			size += int64(len(zone.Name) + len(zone.RelativePath))
 		}
 	}
+	return size
+}
+
+// Stats returns cache statistics
+func (c *QueryCache) Stats() map[string]interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	valid, expired, totalHits := c.counts()
 
 	stats := map[string]interface{}{
 		"total_entries":   len(c.data),
 		"valid_entries":   valid,
 		"expired_entries": expired,
 		"total_hits":      totalHits,
+		"total_bytes":     c.bytes,
+		"max_entries":     c.maxEntries,
+		"max_bytes":       c.maxBytes,
+		"evictions":       c.evictions,
+		"coalesced":       c.coalesced,
 		"cache_hit_ratio": 0.0,
 	}
 
@@ -181,15 +418,28 @@ func (c *QueryCache) Stats() map[string]interface{} {
 
 // GetCacheMetrics returns metrics for monitoring systems
 func (c *QueryCache) GetCacheMetrics() map[string]int64 {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	valid := 0
-	expired := 0
-	totalHits := int64(0)
-	now := time.Now()
+	valid, expired, totalHits := c.counts()
+
+	return map[string]int64{
+		"starfish_cache_total_entries":   int64(len(c.data)),
+		"starfish_cache_valid_entries":   int64(valid),
+		"starfish_cache_expired_entries": int64(expired),
+		"starfish_cache_total_hits":      totalHits,
+		"starfish_cache_total_bytes":     c.bytes,
+		"starfish_cache_evictions":       c.evictions,
+		"starfish_cache_coalesced":       c.coalesced,
+	}
+}
 
-	for _, cached := range c.data {
+// counts returns the number of valid and expired results and the hits of
+// the valid ones, the caller must hold the lock
+func (c *QueryCache) counts() (valid, expired int, totalHits int64) {
+	now := time.Now()
+	for _, elem := range c.data {
+		cached := elem.Value.(*CachedResult)
 		if now.After(cached.ExpiresAt) {
 			expired++
 		} else {
@@ -197,11 +447,5 @@ func (c *QueryCache) GetCacheMetrics() map[string]int64 {
 			totalHits += cached.HitCount
 		}
 	}
-
-	return map[string]int64{
-		"starfish_cache_total_entries":   int64(len(c.data)),
-		"starfish_cache_valid_entries":   int64(valid),
-		"starfish_cache_expired_entries": int64(expired),
-		"starfish_cache_total_hits":      totalHits,
-	}
+	return valid, expired, totalHits
 }
@@ -0,0 +1,177 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheResponse returns a query result of n entries
+func cacheResponse(n int) *StarfishQueryResponse {
+	entries := make([]StarfishEntry, n)
+	for i := range entries {
+		entries[i] = StarfishEntry{Filename: fmt.Sprintf("file%d.txt", i), Volume: "vol"}
+	}
+	return &StarfishQueryResponse{Entries: entries, Total: n}
+}
+
+func TestQueryCacheEntryBudget(t *testing.T) {
+	cache := NewQueryCache(time.Minute, 0, 2, 0, nil)
+	defer cache.Close()
+
+	cache.Set("a", cacheResponse(1), "")
+	cache.Set("b", cacheResponse(1), "")
+	cache.Get("a") // b is now the least recently used
+	cache.Set("c", cacheResponse(1), "")
+
+	if cache.Get("b") != nil {
+		t.Error("expected the least recently used result to be evicted")
+	}
+	if cache.Get("a") == nil || cache.Get("c") == nil {
+		t.Error("expected the recently used results to stay cached")
+	}
+	if evictions := cache.GetCacheMetrics()["starfish_cache_evictions"]; evictions != 1 {
+		t.Errorf("expected 1 eviction, got %d", evictions)
+	}
+}
+
+func TestQueryCacheByteBudget(t *testing.T) {
+	size := responseSize("a", cacheResponse(10))
+	cache := NewQueryCache(time.Minute, 0, 100, 2*size, nil)
+	defer cache.Close()
+
+	cache.Set("a", cacheResponse(10), "")
+	cache.Set("b", cacheResponse(10), "")
+	cache.Set("c", cacheResponse(10), "")
+
+	stats := cache.Stats()
+	if stats["total_entries"].(int) != 2 {
+		t.Errorf("expected 2 results within the byte budget, got %d", stats["total_entries"].(int))
+	}
+	if stats["total_bytes"].(int64) > 2*size {
+		t.Errorf("expected at most %d bytes, got %d", 2*size, stats["total_bytes"].(int64))
+	}
+	if cache.Get("a") != nil {
+		t.Error("expected the oldest result to be evicted")
+	}
+
+	// A result larger than the whole budget is not cached
+	cache.Set("huge", cacheResponse(100), "")
+	if cache.Get("huge") != nil {
+		t.Error("expected a result over the byte budget not to be cached")
+	}
+}
+
+func TestQueryCacheSweeper(t *testing.T) {
+	cache := NewQueryCache(10*time.Millisecond, 0, 0, 0, nil)
+	defer cache.Close()
+
+	cache.Set("a", cacheResponse(1), "")
+	cache.removeExpired(time.Now().Add(time.Second))
+
+	if entries := cache.Stats()["total_entries"].(int); entries != 0 {
+		t.Errorf("expected expired results to be swept, got %d", entries)
+	}
+
+	// The background sweeper removes results nobody asks for again
+	cache.Set("b", cacheResponse(1), "")
+	deadline := time.Now().Add(3 * minSweepInterval)
+	for cache.GetCacheMetrics()["starfish_cache_total_entries"] != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the sweeper to remove the expired result")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueryCacheCoalescing(t *testing.T) {
+	cache := NewQueryCache(time.Minute, 0, 0, 0, nil)
+	defer cache.Close()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func() (*StarfishQueryResponse, error) {
+		loads.Add(1)
+		<-release
+		return cacheResponse(1), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.GetOrLoad("key", "", load); err != nil {
+				t.Errorf("GetOrLoad failed: %v", err)
+			}
+		}()
+	}
+
+	waitFor(t, func() bool { return loads.Load() == 1 })
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("expected concurrent misses to share one load, got %d", n)
+	}
+	if cache.Get("key") == nil {
+		t.Error("expected the loaded result to be cached")
+	}
+
+	// Errors are returned but not cached
+	failed := errors.New("starfish unavailable")
+	if _, err := cache.GetOrLoad("failing", "", func() (*StarfishQueryResponse, error) {
+		return nil, failed
+	}); !errors.Is(err, failed) {
+		t.Errorf("expected load error, got %v", err)
+	}
+	if cache.Get("failing") != nil {
+		t.Error("expected a failed load not to be cached")
+	}
+
+	// Coalesced loads are not cached
+	if _, err := cache.Coalesce("uncached", func() (*StarfishQueryResponse, error) {
+		return cacheResponse(1), nil
+	}); err != nil {
+		t.Fatalf("Coalesce failed: %v", err)
+	}
+	if cache.Get("uncached") != nil {
+		t.Error("expected a coalesced load not to be cached")
+	}
+}
+
+func TestQueryCacheInvalidatePrefix(t *testing.T) {
+	cache := NewQueryCache(time.Minute, 0, 0, 0, nil)
+	defer cache.Close()
+
+	cache.Set(queryCacheKey("bucket", "type=f", 0), cacheResponse(1), "")
+	cache.Set(queryCacheKey("bucket-2", "type=f", 0), cacheResponse(1), "")
+	cache.InvalidatePrefix("bucket\x00")
+
+	if cache.Get(queryCacheKey("bucket", "type=f", 0)) != nil {
+		t.Error("expected the bucket's results to be invalidated")
+	}
+	if cache.Get(queryCacheKey("bucket-2", "type=f", 0)) == nil {
+		t.Error("expected other buckets' results to stay cached")
+	}
+}
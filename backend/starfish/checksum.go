@@ -0,0 +1,241 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"container/list"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/versity/versitygw/metrics"
+)
+
+// contentHashes are the digests of a file's content. MD5 is hex encoded
+// for use as an ETag, the checksums are base64 encoded as in S3.
+type contentHashes struct {
+	MD5    string
+	SHA256 string
+	CRC32C string
+}
+
+// hashKey identifies a version of a file. A file whose size or
+// modification time changed gets a new key, so stale hashes are never
+// returned.
+type hashKey struct {
+	volume  string
+	inode   int64
+	path    string
+	size    int64
+	modTime int64
+}
+
+// hashCache is an LRU cache of content hashes
+type hashCache struct {
+	mu         sync.Mutex
+	items      map[hashKey]*list.Element
+	lru        *list.List
+	maxEntries int
+}
+
+// hashCacheItem is a cached hash along with its key
+type hashCacheItem struct {
+	key    hashKey
+	hashes contentHashes
+}
+
+// newHashCache creates an empty hash cache of up to maxEntries files
+func newHashCache(maxEntries int) *hashCache {
+	return &hashCache{
+		items:      make(map[hashKey]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the cached hashes of a file version
+func (c *hashCache) get(key hashKey) (contentHashes, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return contentHashes{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*hashCacheItem).hashes, true
+}
+
+// add caches the hashes of a file version
+func (c *hashCache) add(key hashKey, hashes contentHashes) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*hashCacheItem).hashes = hashes
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&hashCacheItem{key: key, hashes: hashes})
+	for c.lru.Len() > c.maxEntries {
+		item := c.lru.Remove(c.lru.Back()).(*hashCacheItem)
+		delete(c.items, item.key)
+	}
+}
+
+// entryHashKey returns the hash cache key of an entry. The inode is used
+// when Starfish returned it, so renamed files keep their hashes.
+func (b *StarfishBackend) entryHashKey(entry StarfishEntry, bucket string) hashKey {
+	key := hashKey{
+		volume:  entry.Volume,
+		inode:   entry.Inode,
+		size:    entry.Size,
+		modTime: entry.ModifyTimeUnix,
+	}
+	if entry.Inode == 0 {
+		key.path = b.buildObjectKeyFromEntryWithBucket(entry, bucket)
+	}
+	return key
+}
+
+// cachedETag returns the content ETag of an entry if it is known without
+// reading the file, and the size-mtime ETag otherwise
+func (b *StarfishBackend) cachedETag(entry StarfishEntry, bucket string) string {
+	if b.hashCache == nil {
+		return b.generateETag(entry)
+	}
+	if entry.MD5 != "" {
+		return fmt.Sprintf("\"%s\"", entry.MD5)
+	}
+	if hashes, ok := b.hashCache.get(b.entryHashKey(entry, bucket)); ok {
+		return fmt.Sprintf("\"%s\"", hashes.MD5)
+	}
+	return b.generateETag(entry)
+}
+
+// objectETag returns the ETag of an entry. With content ETags enabled it
+// is the MD5 of the file, read through the file server if neither
+// Starfish nor the hash cache has it.
+func (b *StarfishBackend) objectETag(ctx context.Context, entry StarfishEntry, bucket string) (string, error) {
+	if b.hashCache == nil {
+		return b.generateETag(entry), nil
+	}
+	if entry.MD5 != "" {
+		return fmt.Sprintf("\"%s\"", entry.MD5), nil
+	}
+
+	hashes, err := b.contentHashes(ctx, entry, bucket)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("\"%s\"", hashes.MD5), nil
+}
+
+// contentHashes returns the hashes of an entry's content, computing and
+// caching them if needed. Hashes stored by Starfish are used as they are.
+func (b *StarfishBackend) contentHashes(ctx context.Context, entry StarfishEntry, bucket string) (contentHashes, error) {
+	if b.hashCache == nil {
+		return contentHashes{}, fmt.Errorf("content hashes are not enabled")
+	}
+
+	key := b.entryHashKey(entry, bucket)
+	if hashes, ok := b.hashCache.get(key); ok {
+		if b.metricsManager != nil {
+			b.metricsManager.Add("starfish_hash_cache_hits", 1,
+				metrics.Tag{Key: "bucket", Value: bucket})
+		}
+		return hashes, nil
+	}
+
+	hashes, err := b.computeHashes(ctx, entry, bucket)
+	if err != nil {
+		return contentHashes{}, err
+	}
+	if b.metricsManager != nil {
+		b.metricsManager.Add("starfish_hash_computed_bytes", entry.Size,
+			metrics.Tag{Key: "bucket", Value: bucket})
+	}
+
+	// Prefer the hashes Starfish recorded over our own
+	if entry.MD5 != "" {
+		hashes.MD5 = entry.MD5
+	}
+	if entry.SHA256 != "" {
+		if sum, err := hex.DecodeString(entry.SHA256); err == nil {
+			hashes.SHA256 = base64.StdEncoding.EncodeToString(sum)
+		}
+	}
+
+	b.hashCache.add(key, hashes)
+	return hashes, nil
+}
+
+// computeHashes reads a file through the file server and hashes it
+func (b *StarfishBackend) computeHashes(ctx context.Context, entry StarfishEntry, bucket string) (contentHashes, error) {
+	if b.fileServerURL == "" {
+		return contentHashes{}, fmt.Errorf("a file server is required to compute content hashes")
+	}
+
+	filePath := b.buildObjectKeyFromEntryWithBucket(entry, bucket)
+	fileURL := fmt.Sprintf("%s/%s/%s", b.fileServerURL, entry.Volume, filePath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return contentHashes{}, fmt.Errorf("failed to create file server request: %w", err)
+	}
+	req.Header.Set("X-Internal-Token", b.bearerToken)
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return contentHashes{}, fmt.Errorf("failed to fetch file from file server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return contentHashes{}, fmt.Errorf("file server returned status %d", resp.StatusCode)
+	}
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	crc32cHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+
+	n, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash, crc32cHash), resp.Body)
+	if err != nil {
+		return contentHashes{}, fmt.Errorf("failed to read file from file server: %w", err)
+	}
+
+	// A file that changed since Starfish indexed it would be cached under
+	// the wrong version
+	if n != entry.Size {
+		return contentHashes{}, fmt.Errorf("file %s changed size while hashing: expected %d bytes, read %d",
+			filePath, entry.Size, n)
+	}
+
+	return contentHashes{
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256: base64.StdEncoding.EncodeToString(sha256Hash.Sum(nil)),
+		CRC32C: base64.StdEncoding.EncodeToString(crc32cHash.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/versity/versitygw/metrics"
+)
+
+// Policies for Starfish entries whose object keys collide, such as files
+// of the same name on different volumes of a collection or files that
+// path rewrite rules give the same key
+const (
+	CollisionSuffix    = "suffix"     // every entry but the first gets its inode appended to the key
+	CollisionFirstWins = "first-wins" // only the first entry is served
+	CollisionError     = "error"      // listings of colliding keys fail
+)
+
+// collisionSeparator separates a colliding key from the inode appended to
+// it by the suffix policy
+const collisionSeparator = "~"
+
+// uniqueKeys sorts listing entries by key and resolves entries sharing a
+// key according to the collision policy. The entries of a key are ordered
+// by their Starfish path, volume and inode, so the same entry comes first
+// whichever listing or lookup finds them. Entries keeping a suffixed key
+// that still collides are dropped.
+func (b *StarfishBackend) uniqueKeys(bucket string, entries []listEntry) ([]listEntry, error) {
+	sortListEntries(entries)
+
+	var (
+		unique   []listEntry
+		suffixed bool
+	)
+	for i, le := range entries {
+		if i == 0 || le.key != entries[i-1].key {
+			unique = append(unique, le)
+			continue
+		}
+
+		if b.metricsManager != nil {
+			b.metricsManager.Add("starfish_key_collisions", 1,
+				metrics.Tag{Key: "bucket", Value: bucket})
+		}
+
+		first := unique[len(unique)-1]
+		switch b.collisionPolicy {
+		case CollisionError:
+			return nil, fmt.Errorf("%s:%s and %s:%s both map to key %s of bucket %s",
+				first.entry.Volume, originalObjectKey(first.entry),
+				le.entry.Volume, originalObjectKey(le.entry), le.key, bucket)
+		case CollisionFirstWins:
+		default:
+			le.key = suffixKey(le.key, le.entry)
+			unique = append(unique, le)
+			suffixed = true
+		}
+	}
+
+	if !suffixed {
+		return unique, nil
+	}
+
+	// Suffixed keys sort elsewhere and may meet other keys
+	sortListEntries(unique)
+	entries = unique[:0]
+	for i, le := range unique {
+		if i == 0 || le.key != unique[i-1].key {
+			entries = append(entries, le)
+		}
+	}
+	return entries, nil
+}
+
+// sortListEntries sorts entries by key, ordering the entries of a key by
+// Starfish path, volume and inode
+func sortListEntries(entries []listEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return listEntryLess(entries[i], entries[j])
+	})
+}
+
+// listEntryLess reports whether a sorts before b in listing order
+func listEntryLess(a, b listEntry) bool {
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	if pa, pb := originalObjectKey(a.entry), originalObjectKey(b.entry); pa != pb {
+		return pa < pb
+	}
+	if a.entry.Volume != b.entry.Volume {
+		return a.entry.Volume < b.entry.Volume
+	}
+	return a.entry.Inode < b.entry.Inode
+}
+
+// suffixKey returns the key an entry losing a collision is served under
+func suffixKey(key string, entry StarfishEntry) string {
+	return key + collisionSeparator + strconv.FormatInt(entry.Inode, 10)
+}
+
+// collisionBase returns the key a key or prefix with an inode suffix was
+// derived from under the suffix policy. The suffix of a prefix may be
+// partial.
+func (b *StarfishBackend) collisionBase(key string) (string, bool) {
+	switch b.collisionPolicy {
+	case CollisionFirstWins, CollisionError:
+		return "", false
+	}
+
+	i := strings.LastIndex(key, collisionSeparator)
+	if i < 0 {
+		return "", false
+	}
+	for _, r := range key[i+len(collisionSeparator):] {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return key[:i], true
+}
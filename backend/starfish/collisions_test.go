@@ -0,0 +1,175 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/versity/versitygw/s3err"
+)
+
+// newCollisionServer serves files of the same path on two volumes
+func newCollisionServer(t *testing.T) string {
+	t.Helper()
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]StarfishEntry{
+			{Filename: "b.txt", ParentPath: "dir", Size: 3, Volume: "vol1", Inode: 5},
+			{Filename: "a.txt", ParentPath: "dir", Size: 2, Volume: "vol2", Inode: 7},
+			{Filename: "a.txt", ParentPath: "dir", Size: 1, Volume: "vol1", Inode: 3},
+		})
+	})
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// listKeys lists the keys of test-bucket after startAfter with prefix
+func listKeys(t *testing.T, backend *StarfishBackend, prefix, startAfter string) (string, error) {
+	t.Helper()
+	bucket := "test-bucket"
+	res, err := backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket:     &bucket,
+		Prefix:     &prefix,
+		StartAfter: &startAfter,
+	})
+	if err != nil {
+		return "", err
+	}
+	var keys []string
+	for _, obj := range res.Contents {
+		keys = append(keys, *obj.Key)
+	}
+	return strings.Join(keys, ","), nil
+}
+
+// headSize returns the size of the object behind a key
+func headSize(backend *StarfishBackend, key string) (int64, error) {
+	bucket := "test-bucket"
+	res, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return 0, err
+	}
+	return *res.ContentLength, nil
+}
+
+func TestCollisionSuffix(t *testing.T) {
+	backend := newResilienceBackend(t, newCollisionServer(t), StarfishConfig{})
+
+	tests := []struct {
+		prefix, startAfter, expected string
+	}{
+		{"", "", "dir/a.txt,dir/a.txt~7,dir/b.txt"},
+		{"", "dir/a.txt", "dir/a.txt~7,dir/b.txt"},
+		{"dir/a.txt~", "", "dir/a.txt~7"},
+		{"dir/a.txt~7", "", "dir/a.txt~7"},
+		{"dir/a.txt~3", "", ""},
+	}
+	for _, tt := range tests {
+		keys, err := listKeys(t, backend, tt.prefix, tt.startAfter)
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		if keys != tt.expected {
+			t.Errorf("prefix %q after %q: expected %q, got %q", tt.prefix, tt.startAfter, tt.expected, keys)
+		}
+	}
+
+	// The first file by path, volume and inode keeps the key, whichever
+	// order Starfish returns them in
+	if size, err := headSize(backend, "dir/a.txt"); err != nil || size != 1 {
+		t.Errorf("expected dir/a.txt to be the vol1 file, got size %d, err %v", size, err)
+	}
+	if size, err := headSize(backend, "dir/a.txt~7"); err != nil || size != 2 {
+		t.Errorf("expected dir/a.txt~7 to be the vol2 file, got size %d, err %v", size, err)
+	}
+	if _, err := headSize(backend, "dir/a.txt~3"); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchKey)) {
+		t.Errorf("expected the winning file not to be served under a suffix, got %v", err)
+	}
+}
+
+func TestCollisionFirstWins(t *testing.T) {
+	backend := newResilienceBackend(t, newCollisionServer(t), StarfishConfig{CollisionPolicy: CollisionFirstWins})
+
+	keys, err := listKeys(t, backend, "", "")
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if keys != "dir/a.txt,dir/b.txt" {
+		t.Errorf("expected dir/a.txt,dir/b.txt, got %q", keys)
+	}
+
+	if size, err := headSize(backend, "dir/a.txt"); err != nil || size != 1 {
+		t.Errorf("expected dir/a.txt to be the vol1 file, got size %d, err %v", size, err)
+	}
+	if _, err := headSize(backend, "dir/a.txt~7"); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchKey)) {
+		t.Errorf("expected no suffixed keys, got %v", err)
+	}
+}
+
+func TestCollisionError(t *testing.T) {
+	backend := newResilienceBackend(t, newCollisionServer(t), StarfishConfig{CollisionPolicy: CollisionError})
+
+	if _, err := listKeys(t, backend, "", ""); err == nil {
+		t.Error("expected the listing to fail on colliding keys")
+	}
+	if _, err := headSize(backend, "dir/a.txt"); err == nil {
+		t.Error("expected a colliding key to fail")
+	}
+	if size, err := headSize(backend, "dir/b.txt"); err != nil || size != 3 {
+		t.Errorf("expected keys without collisions to be served, got size %d, err %v", size, err)
+	}
+}
+
+func TestRewrittenKeysSortedAndUnique(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		// Starfish order is by parent_path and fn, not by rewritten key
+		json.NewEncoder(w).Encode([]StarfishEntry{
+			{Filename: "z.txt", ParentPath: "a", Size: 1, Volume: "vol", Inode: 1},
+			{Filename: "m.txt", ParentPath: "b", Size: 2, Volume: "vol", Inode: 2},
+			{Filename: "z.txt", ParentPath: "c", Size: 3, Volume: "vol", Inode: 3},
+		})
+	})
+	defer server.Close()
+
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{
+		PathRewriteConfig: &PathRewriteConfig{
+			Rules: []PathRewriteRule{{Bucket: "*", Pattern: "^(.*)$", Template: "{{.Entry.Filename}}"}},
+		},
+	})
+
+	keys, err := listKeys(t, backend, "", "")
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if keys != "m.txt,z.txt,z.txt~3" {
+		t.Errorf("expected m.txt,z.txt,z.txt~3, got %q", keys)
+	}
+
+	// Suffixed keys resolve without a listing
+	backend.invalidateBucket("")
+	if size, err := headSize(backend, "z.txt~3"); err != nil || size != 3 {
+		t.Errorf("expected z.txt~3 to be c/z.txt, got size %d, err %v", size, err)
+	}
+	if size, err := headSize(backend, "z.txt"); err != nil || size != 1 {
+		t.Errorf("expected z.txt to be a/z.txt, got size %d, err %v", size, err)
+	}
+}
@@ -21,7 +21,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/versity/versitygw/backend/meta"
 )
 
 // NewStarfishBackend creates a new Starfish backend instance
@@ -39,6 +42,18 @@ func NewStarfishBackend(config *StarfishConfig) (*StarfishBackend, error) {
 	if config.CollectionsRefreshInterval == 0 {
 		config.CollectionsRefreshInterval = 10 * time.Minute
 	}
+	if config.QueryPageSize <= 0 {
+		config.QueryPageSize = 1000
+	}
+	if config.ListCacheEntries <= 0 {
+		config.ListCacheEntries = 1000000
+	}
+	if config.RewriteIndexSize <= 0 {
+		config.RewriteIndexSize = 100000
+	}
+	if config.HashCacheEntries <= 0 {
+		config.HashCacheEntries = 100000
+	}
 
 	// Configure TLS
 	tlsConfig := &tls.Config{
@@ -83,24 +98,131 @@ func NewStarfishBackend(config *StarfishConfig) (*StarfishBackend, error) {
 		},
 	}
 
+	// Bucket settings can only be changed when there is somewhere to
+	// keep them
+	var metaStore meta.MetadataStorer
+	if config.MetadataDir != "" {
+		sidecar, err := meta.NewSideCar(config.MetadataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open metadata directory: %w", err)
+		}
+		metaStore = sidecar
+	}
+
+	var contentHashes *hashCache
+	if config.ContentETags {
+		if config.FileServerURL == "" {
+			return nil, fmt.Errorf("content ETags require a file server URL")
+		}
+		contentHashes = newHashCache(config.HashCacheEntries)
+	}
+
+	if config.WriteConfig != nil && len(config.WriteConfig.Collections) > 0 && config.FileServerURL == "" {
+		return nil, fmt.Errorf("writable collections require a file server URL")
+	}
+	if config.WriteConfig != nil {
+		// Uploaded files would only show up in the bucket if they
+		// happened to match its query
+		for bucket := range config.VirtualBuckets {
+			if _, ok := config.WriteConfig.Collections[bucket]; ok {
+				return nil, fmt.Errorf("virtual bucket %s cannot be writable", bucket)
+			}
+		}
+	}
+
+	bucketSource := config.BucketSource
+	if bucketSource == "" {
+		bucketSource = BucketSourceTagset
+	}
+	switch bucketSource {
+	case BucketSourceTagset, BucketSourceZone, BucketSourceVolume:
+	default:
+		return nil, fmt.Errorf("unsupported bucket source: %s (supported: %s, %s, %s)",
+			bucketSource, BucketSourceTagset, BucketSourceZone, BucketSourceVolume)
+	}
+
+	collisionPolicy := config.CollisionPolicy
+	if collisionPolicy == "" {
+		collisionPolicy = CollisionSuffix
+	}
+	switch collisionPolicy {
+	case CollisionSuffix, CollisionFirstWins, CollisionError:
+	default:
+		return nil, fmt.Errorf("unsupported collision policy: %s (supported: %s, %s, %s)",
+			collisionPolicy, CollisionSuffix, CollisionFirstWins, CollisionError)
+	}
+
+	bucketTagset := strings.TrimSuffix(config.BucketTagset, ":")
+	if bucketTagset == "" {
+		bucketTagset = defaultBucketTagset
+	}
+
+	staleTTL := config.StaleCacheTTL
+	if staleTTL == 0 {
+		staleTTL = time.Hour
+	}
+	staleTTL = max(staleTTL, 0)
+
+	queryRetries := config.QueryRetries
+	if queryRetries == 0 {
+		queryRetries = defaultQueryRetries
+	}
+	queryRetries = max(queryRetries, 0)
+
+	var breaker *circuitBreaker
+	if config.BreakerThreshold >= 0 {
+		threshold, cooldown := config.BreakerThreshold, config.BreakerCooldown
+		if threshold == 0 {
+			threshold = defaultBreakerThreshold
+		}
+		if cooldown <= 0 {
+			cooldown = defaultBreakerCooldown
+		}
+		breaker = newCircuitBreaker(threshold, cooldown)
+	}
+
 	backend := &StarfishBackend{
 		apiEndpoint:                config.APIEndpoint,
 		bearerToken:                config.BearerToken,
 		fileServerURL:              config.FileServerURL,
-		cache:                      NewQueryCache(config.CacheTTL, config.MetricsManager),
+		cache:                      NewQueryCache(config.CacheTTL, staleTTL, config.QueryCacheEntries, config.QueryCacheBytes, config.MetricsManager),
 		httpClient:                 httpClient,
+		writeClient:                &http.Client{Transport: httpClient.Transport},
 		collections:                make(map[string]string),
+		bucketSource:               bucketSource,
+		bucketTagset:               bucketTagset,
+		bucketAliases:              config.BucketAliases,
+		virtualBuckets:             config.VirtualBuckets,
 		CollectionsRefreshInterval: config.CollectionsRefreshInterval,
 		pathRewriteConfig:          config.PathRewriteConfig,
+		pathRewriteConfigFile:      config.PathRewriteConfigFile,
+		collisionPolicy:            collisionPolicy,
 		metricsManager:             config.MetricsManager,
+		queryPageSize:              config.QueryPageSize,
+		rewriteIndex:               newRewriteIndex(config.RewriteIndexSize, config.CacheTTL),
+		listCache:                  newListCache(config.ListCacheEntries, config.CacheTTL),
+		meta:                       metaStore,
+		defaultOwner:               config.DefaultOwner,
+		startTime:                  time.Now(),
+		includeInheritedTags:       config.IncludeInheritedTags,
+		hashCache:                  contentHashes,
+		writeConfig:                config.WriteConfig,
+		breaker:                    breaker,
+		queryRetries:               queryRetries,
+		retryBaseDelay:             defaultRetryBaseDelay,
+		shardVolumes:               config.ShardVolumes,
+		shardWorkers:               config.ShardWorkers,
+		shardTTL:                   config.CacheTTL,
+		volumeShards:               make(map[string]volumeShards),
 	}
 
 	return backend, nil
 }
 
-// Note: InitializeCollections is implemented in starfish.go - discovers Collections: tagset
+// Note: InitializeCollections is implemented in starfish.go - discovers the buckets of the bucket source
 
-// GetCollectionTag returns the Collections: tagset tag for a given bucket name
+// GetCollectionTag returns what a bucket maps to in Starfish: the full
+// tag in tagset mode, the zone or the volume name otherwise
 func (b *StarfishBackend) GetCollectionTag(bucketName string) (string, bool) {
 	b.collectionsMux.RLock()
 	defer b.collectionsMux.RUnlock()
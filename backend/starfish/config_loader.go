@@ -22,6 +22,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/versity/versitygw/s3api/utils"
 )
 
 // LoadPathRewriteConfig loads path rewrite configuration from a file
@@ -83,6 +87,25 @@ func validatePathRewriteConfig(config *PathRewriteConfig) error {
 		}
 	}
 
+	for i, rule := range config.Exclude {
+		if err := validateExclusionRule(rule); err != nil {
+			return fmt.Errorf("exclude rule %d: %w", i, err)
+		}
+	}
+
+	// Patterns and templates are compiled once here, before the rules are
+	// used by listings
+	for _, rule := range config.compiledRules() {
+		if rule.err != nil {
+			return fmt.Errorf("rule %d: %w", rule.index, rule.err)
+		}
+	}
+	for _, rule := range config.exclusions {
+		if rule.err != nil {
+			return fmt.Errorf("exclude rule %d: %w", rule.index, rule.err)
+		}
+	}
+
 	return nil
 }
 
@@ -137,3 +160,138 @@ func SavePathRewriteConfig(config *PathRewriteConfig, configPath string) error {
 
 	return nil
 }
+
+// LoadWriteConfig loads the writable collections from a file
+func LoadWriteConfig(configPath string) (*WriteConfig, error) {
+	if configPath == "" {
+		return nil, nil // No configuration file specified
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read write configuration file: %w", err)
+	}
+
+	var config WriteConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse write configuration JSON: %w", err)
+	}
+
+	if err := validateWriteConfig(&config); err != nil {
+		return nil, fmt.Errorf("invalid write configuration: %w", err)
+	}
+
+	return &config, nil
+}
+
+// validateWriteConfig validates the write configuration
+func validateWriteConfig(config *WriteConfig) error {
+	for bucket, target := range config.Collections {
+		if bucket == "" {
+			return fmt.Errorf("collection name cannot be empty")
+		}
+		if target.Volume == "" {
+			return fmt.Errorf("collection %s: volume cannot be empty", bucket)
+		}
+		if strings.Contains(target.Volume, "/") {
+			return fmt.Errorf("collection %s: invalid volume %q", bucket, target.Volume)
+		}
+		for _, part := range strings.Split(strings.Trim(target.Path, "/"), "/") {
+			if part == "." || part == ".." {
+				return fmt.Errorf("collection %s: invalid path %q", bucket, target.Path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadBucketAliases loads bucket names for collections from a file. The
+// file is a JSON object mapping bucket names to the tag, zone or volume
+// served by the bucket, such as {"archive-us": "Collections:Archive_US"}.
+func LoadBucketAliases(configPath string) (map[string]string, error) {
+	if configPath == "" {
+		return nil, nil // No configuration file specified
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bucket aliases file: %w", err)
+	}
+
+	var aliases map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("failed to parse bucket aliases JSON: %w", err)
+	}
+
+	if err := validateBucketAliases(aliases); err != nil {
+		return nil, fmt.Errorf("invalid bucket aliases: %w", err)
+	}
+
+	return aliases, nil
+}
+
+// LoadVirtualBuckets loads buckets defined by a Starfish query from a
+// file. The file is a JSON object mapping bucket names to queries, such as
+// {"large-logs": "ext=log size>1G volume=proj1"}.
+func LoadVirtualBuckets(configPath string) (map[string]string, error) {
+	if configPath == "" {
+		return nil, nil // No configuration file specified
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read virtual buckets file: %w", err)
+	}
+
+	var buckets map[string]string
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return nil, fmt.Errorf("failed to parse virtual buckets JSON: %w", err)
+	}
+
+	if err := validateVirtualBuckets(buckets); err != nil {
+		return nil, fmt.Errorf("invalid virtual buckets: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// validateVirtualBuckets checks that virtual buckets have valid names and
+// a query
+func validateVirtualBuckets(buckets map[string]string) error {
+	for bucket, query := range buckets {
+		if !utils.IsValidBucketName(bucket) {
+			return fmt.Errorf("invalid bucket name %q", bucket)
+		}
+		if strings.TrimSpace(query) == "" {
+			return fmt.Errorf("bucket %s: query cannot be empty", bucket)
+		}
+	}
+	return nil
+}
+
+// validateBucketAliases checks that aliases are valid bucket names and
+// that no collection has more than one alias
+func validateBucketAliases(aliases map[string]string) error {
+	names := make([]string, 0, len(aliases))
+	for bucket := range aliases {
+		names = append(names, bucket)
+	}
+	sort.Strings(names)
+
+	buckets := make(map[string]string, len(aliases))
+	for _, bucket := range names {
+		source := aliases[bucket]
+		if !utils.IsValidBucketName(bucket) {
+			return fmt.Errorf("invalid bucket name %q", bucket)
+		}
+		if source == "" {
+			return fmt.Errorf("bucket %s: collection cannot be empty", bucket)
+		}
+		if other, ok := buckets[source]; ok {
+			return fmt.Errorf("%s has more than one alias: %s and %s", source, other, bucket)
+		}
+		buckets[source] = bucket
+	}
+	return nil
+}
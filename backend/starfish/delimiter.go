@@ -0,0 +1,130 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// directoryFilter matches directory entries (d is the type code for
+// directories)
+const directoryFilter = "type=d"
+
+// isDirectoryQuery reports whether a query matches directory entries
+func isDirectoryQuery(query string) bool {
+	return query == directoryFilter || strings.HasPrefix(query, directoryFilter+" ")
+}
+
+// listLevel returns the entries of a listing of prefix with the "/"
+// delimiter from the directory the prefix is in: its files starting with
+// the prefix, and its subdirectories starting with the prefix as entries
+// keyed by the common prefix they are listed as. Browsing a tree then
+// takes a few small queries per level instead of fetching every file
+// below the prefix. ok is false if the level cannot be listed this way,
+// and every key below the prefix has to be listed instead.
+func (b *StarfishBackend) listLevel(ctx context.Context, operation, bucket, prefix string) (entries []listEntry, ok bool, err error) {
+	// Files in the top level directory have no parent_path to match on
+	idx := strings.LastIndex(prefix, "/")
+	if idx <= 0 {
+		return nil, false, nil
+	}
+	dir, base := prefix[:idx], prefix[idx+1:]
+
+	// Rewritten keys are not paths, and suffixed keys of colliding
+	// entries are not file names
+	if b.hasPathRewriteRules(bucket) {
+		return nil, false, nil
+	}
+	if _, ok := b.collisionBase(prefix); ok {
+		return nil, false, nil
+	}
+
+	cacheKey := prefix + "\x00/"
+	if entries, ok := b.listCache.get(bucket, cacheKey); ok {
+		return entries, true, nil
+	}
+
+	complete, err := b.directoryComplete(ctx, operation, bucket, dir)
+	if err != nil || !complete {
+		return nil, false, err
+	}
+
+	filter := "parent_path=" + queryValue(globLiteral(dir))
+	if base != "" {
+		filter += " fn=" + queryValue(globLiteral(base)+"*")
+	}
+
+	// The glob patterns of the filters may match a superset of the level
+	inLevel := func(key string) bool {
+		return strings.HasPrefix(key, prefix) && !strings.Contains(key[len(prefix):], "/")
+	}
+
+	entries, err = b.findEntries(ctx, operation, bucket, []string{"type=f " + filter}, inLevel)
+	if err != nil {
+		return nil, false, err
+	}
+	entries, err = b.uniqueKeys(bucket, entries)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// A directory on several volumes is listed once
+	seen := make(map[string]bool)
+	err = b.walkQuery(ctx, operation, bucket, directoryFilter+" "+filter, true, func(entry StarfishEntry) bool {
+		key := originalObjectKey(entry)
+		if inLevel(key) && !seen[key] {
+			seen[key] = true
+			entries = append(entries, listEntry{key: key + "/", entry: entry, dir: true})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	b.listCache.add(bucket, cacheKey, entries)
+	return entries, true, nil
+}
+
+// directoryComplete reports whether every subdirectory of dir holding
+// files of the bucket is a directory of the bucket, so the directory
+// entries of the bucket are its common prefixes. Volume buckets hold every
+// directory of their volume. Tagset and zone buckets hold the files below
+// tagged directories and zone roots, but not the directories above them,
+// so only directories inside the bucket are complete. The query of a
+// virtual bucket need not match directories at all.
+func (b *StarfishBackend) directoryComplete(ctx context.Context, operation, bucket, dir string) (bool, error) {
+	if _, virtual := b.virtualBuckets[bucket]; virtual {
+		return false, nil
+	}
+	if b.bucketSource == BucketSourceVolume {
+		return true, nil
+	}
+
+	found := false
+	err := b.walkQuery(ctx, operation, bucket, directoryFilter+" "+pathFilters(dir), true, func(entry StarfishEntry) bool {
+		found = originalObjectKey(entry) == dir
+		return !found
+	})
+	return found, err
+}
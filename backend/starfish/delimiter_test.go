@@ -0,0 +1,222 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	testFileType = 32768
+	testDirType  = 16384
+)
+
+// newTreeServer serves a tree of entries, applying the type, parent_path
+// and fn filters of queries, and records the queries it receives
+func newTreeServer(t *testing.T, entries []StarfishEntry) (string, func() []string) {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+
+		var matched []StarfishEntry
+		for _, entry := range entries {
+			if treeEntryMatches(entry, query) {
+				matched = append(matched, entry)
+			}
+		}
+		json.NewEncoder(w).Encode(matched)
+	})
+	t.Cleanup(server.Close)
+
+	return server.URL, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), queries...)
+	}
+}
+
+// treeEntryMatches applies the filters of a query the tree server knows
+func treeEntryMatches(entry StarfishEntry, query string) bool {
+	for _, filter := range strings.Fields(query) {
+		name, value, _ := strings.Cut(filter, "=")
+		switch name {
+		case "type":
+			if (value == "d") != (entry.Type == testDirType) {
+				return false
+			}
+		case "parent_path":
+			if ok, _ := path.Match(value, entry.ParentPath); !ok {
+				return false
+			}
+		case "fn":
+			if ok, _ := path.Match(value, entry.Filename); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// treeEntries returns the entries of a tree given by paths, directories
+// end with a slash
+func treeEntries(paths ...string) []StarfishEntry {
+	var entries []StarfishEntry
+	for i, p := range paths {
+		entry := StarfishEntry{Type: testFileType, Volume: "vol", Inode: int64(i + 1), Size: 1}
+		if strings.HasSuffix(p, "/") {
+			entry.Type = testDirType
+			p = strings.TrimSuffix(p, "/")
+		}
+		entry.ParentPath, entry.Filename = path.Split(p)
+		entry.ParentPath = strings.TrimSuffix(entry.ParentPath, "/")
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// listLevelKeys lists test-bucket with the "/" delimiter, paging through
+// maxKeys at a time, and returns the keys and common prefixes in order
+func listLevelKeys(t *testing.T, backend *StarfishBackend, prefix string, maxKeys int32) string {
+	t.Helper()
+	var (
+		items []string
+		token *string
+	)
+	for {
+		res, err := backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+			Bucket:            aws.String("test-bucket"),
+			Prefix:            &prefix,
+			Delimiter:         aws.String("/"),
+			MaxKeys:           &maxKeys,
+			ContinuationToken: token,
+		})
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		// Keys and common prefixes are returned separately, merge them
+		// back in key order
+		var page []string
+		for _, obj := range res.Contents {
+			page = append(page, *obj.Key)
+		}
+		for _, cp := range res.CommonPrefixes {
+			page = append(page, *cp.Prefix)
+		}
+		slices.Sort(page)
+		items = append(items, page...)
+		if res.IsTruncated == nil || !*res.IsTruncated {
+			return strings.Join(items, ",")
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+var testTree = treeEntries(
+	"data/",
+	"data/a/",
+	"data/a/1.txt",
+	"data/a/deep/",
+	"data/a/deep/2.txt",
+	"data/a.txt",
+	"data/b/",
+	"data/b/3.txt",
+	"data/empty/",
+	"data/.snapshot/",
+	"data/.snapshot/a.txt",
+	"data/x.txt",
+)
+
+func TestDelimiterListingByLevel(t *testing.T) {
+	serverURL, queries := newTreeServer(t, testTree)
+	backend := newResilienceBackend(t, serverURL, StarfishConfig{
+		BucketSource: BucketSourceVolume,
+		PathRewriteConfig: &PathRewriteConfig{
+			Exclude: []ExclusionRule{{Bucket: "*", Glob: ".snapshot"}},
+		},
+	})
+
+	tests := []struct {
+		prefix   string
+		expected string
+	}{
+		{"data/", "data/a.txt,data/a/,data/b/,data/empty/,data/x.txt"},
+		{"data/a", "data/a.txt,data/a/"},
+		{"data/a/", "data/a/1.txt,data/a/deep/"},
+		{"data/a/deep/", "data/a/deep/2.txt"},
+		{"data/missing/", ""},
+	}
+	for _, tt := range tests {
+		for _, maxKeys := range []int32{1000, 2} {
+			if got := listLevelKeys(t, backend, tt.prefix, maxKeys); got != tt.expected {
+				t.Errorf("prefix %q max keys %d: expected %q, got %q", tt.prefix, maxKeys, tt.expected, got)
+			}
+		}
+	}
+
+	// Only the listed levels are queried, never the files below them
+	for _, query := range queries() {
+		if strings.Contains(query, "parent_path=data/*") || strings.Contains(query, "parent_path=data/a/*") {
+			t.Errorf("expected no queries below the listed level, got %q", query)
+		}
+	}
+}
+
+func TestDelimiterListingAboveBucketDirectories(t *testing.T) {
+	// Tagset buckets hold the files below tagged directories, not the
+	// directories above them
+	tree := treeEntries(
+		"data/a/",
+		"data/a/1.txt",
+		"data/a/deep/",
+		"data/a/deep/2.txt",
+		"data/x.txt",
+	)
+	serverURL, queries := newTreeServer(t, tree)
+	backend := newResilienceBackend(t, serverURL, StarfishConfig{})
+
+	if got := listLevelKeys(t, backend, "data/", 1000); got != "data/a/,data/x.txt" {
+		t.Errorf("expected data/a/,data/x.txt, got %q", got)
+	}
+	if got := listLevelKeys(t, backend, "data/a/", 1000); got != "data/a/1.txt,data/a/deep/" {
+		t.Errorf("expected data/a/1.txt,data/a/deep/, got %q", got)
+	}
+
+	var belowA bool
+	for _, query := range queries() {
+		belowA = belowA || strings.Contains(query, "parent_path=data/a/*")
+	}
+	if belowA {
+		t.Error("expected data/a/ to be listed from its directory entries")
+	}
+}
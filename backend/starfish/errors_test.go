@@ -0,0 +1,190 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/versity/versitygw/s3err"
+)
+
+func TestQueryErrorMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    s3err.ErrorCode
+	}{
+		{
+			name:    "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) },
+			want:    s3err.ErrNoSuchBucket,
+		},
+		{
+			name:    "unauthorized",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) },
+			want:    s3err.ErrAccessDenied,
+		},
+		{
+			name:    "forbidden",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusForbidden) },
+			want:    s3err.ErrAccessDenied,
+		},
+		{
+			name:    "rate limited",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTooManyRequests) },
+			want:    s3err.ErrSlowDown,
+		},
+		{
+			name:    "unavailable",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			want:    s3err.ErrServiceUnavailable,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			},
+			want: s3err.ErrRequestTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(tt.handler)
+			defer server.Close()
+
+			backend := newResilienceBackend(t, server.URL, StarfishConfig{QueryRetries: -1})
+			backend.httpClient.Timeout = 20 * time.Millisecond
+
+			_, err := listTestBucket(context.Background(), backend)
+			if !errors.Is(err, s3err.GetAPIError(tt.want)) {
+				t.Errorf("expected %v, got %v", s3err.GetAPIError(tt.want).Code, err)
+			}
+		})
+	}
+}
+
+func TestQueryErrorUnmapped(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name:    "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+		},
+		{
+			name:    "malformed response",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("{not json")) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(tt.handler)
+			defer server.Close()
+
+			backend := newResilienceBackend(t, server.URL, StarfishConfig{QueryRetries: -1})
+
+			// Errors without an S3 equivalent keep their details, so the
+			// controller logs them before answering InternalError
+			_, err := listTestBucket(context.Background(), backend)
+			var starfishErr *StarfishError
+			if !errors.As(err, &starfishErr) {
+				t.Errorf("expected the Starfish error to be returned, got %v", err)
+			}
+		})
+	}
+}
+
+func TestQueryClientCanceled(t *testing.T) {
+	started := make(chan struct{})
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+	defer server.Close()
+
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{QueryRetries: -1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err := listTestBucket(ctx, backend)
+	if !errors.Is(err, s3err.GetAPIError(s3err.ErrClientClosedRequest)) {
+		t.Errorf("expected ClientClosedRequest, got %v", err)
+	}
+	if !backend.breaker.allow() {
+		t.Error("expected a canceled query not to count against Starfish")
+	}
+}
+
+func TestQueryUnreachable(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {})
+	url := server.URL
+	server.Close()
+
+	backend := newResilienceBackend(t, url, StarfishConfig{QueryRetries: -1})
+
+	_, err := listTestBucket(context.Background(), backend)
+	if !errors.Is(err, s3err.GetAPIError(s3err.ErrServiceUnavailable)) {
+		t.Errorf("expected ServiceUnavailable, got %v", err)
+	}
+}
+
+func TestStarfishErrToS3Err(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want s3err.ErrorCode
+	}{
+		{"object not found", &StarfishError{Code: "OBJECT_NOT_FOUND"}, s3err.ErrNoSuchKey},
+		{"collection not found", &StarfishError{Code: "COLLECTION_NOT_FOUND"}, s3err.ErrNoSuchBucket},
+		{"circuit open", &StarfishError{Code: "CIRCUIT_OPEN"}, s3err.ErrServiceUnavailable},
+		{"access not found", &ErrStarfishAPIAccess{StatusCode: http.StatusNotFound}, s3err.ErrNoSuchBucket},
+		{"access forbidden", &ErrStarfishAPIAccess{StatusCode: http.StatusForbidden}, s3err.ErrAccessDenied},
+		{"access rate limited", &ErrStarfishAPIAccess{StatusCode: http.StatusTooManyRequests}, s3err.ErrSlowDown},
+		{"wrapped access error", fmt.Errorf("fetch tags: %w", &ErrStarfishAPIAccess{StatusCode: http.StatusUnauthorized}), s3err.ErrAccessDenied},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), s3err.ErrRequestTimeout},
+		{"canceled", &StarfishError{Code: "API_UNAVAILABLE", Err: context.Canceled}, s3err.ErrClientClosedRequest},
+		{"s3 error", s3err.GetAPIError(s3err.ErrNoSuchKey), s3err.ErrNoSuchKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := starfishErrToS3Err(tt.err)
+			if !errors.Is(err, s3err.GetAPIError(tt.want)) {
+				t.Errorf("expected %v, got %v", s3err.GetAPIError(tt.want).Code, err)
+			}
+		})
+	}
+
+	if err := starfishErrToS3Err(nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ExclusionRule hides the files of a bucket matching all of its
+// conditions. Excluded files are left out of listings and cannot be
+// fetched.
+type ExclusionRule struct {
+	Bucket  string   `json:"bucket"`             // "*" for all buckets
+	Glob    string   `json:"glob,omitempty"`     // glob on the path, or on any path element if it has no "/"
+	Pattern string   `json:"pattern,omitempty"`  // regex on the path
+	MinSize *int64   `json:"min_size,omitempty"` // files of at least this many bytes
+	MaxSize *int64   `json:"max_size,omitempty"` // files of at most this many bytes
+	UIDs    []int    `json:"uids,omitempty"`     // files owned by any of these users
+	GIDs    []int    `json:"gids,omitempty"`     // files owned by any of these groups
+	Tags    []string `json:"tags,omitempty"`     // files with any of these tags, explicit or inherited
+}
+
+// compiledExclusion is an exclusion rule with its pattern compiled
+type compiledExclusion struct {
+	ExclusionRule
+	index   int // position of the rule in the configuration
+	pattern *regexp.Regexp
+	err     error // why the rule could not be compiled
+}
+
+// compileExclusion compiles the pattern of an exclusion rule and checks
+// its glob
+func compileExclusion(index int, rule ExclusionRule) compiledExclusion {
+	compiled := compiledExclusion{ExclusionRule: rule, index: index}
+
+	if rule.Glob != "" {
+		if _, err := path.Match(rule.Glob, ""); err != nil {
+			compiled.err = fmt.Errorf("invalid glob: %w", err)
+			return compiled
+		}
+	}
+	if rule.Pattern != "" {
+		compiled.pattern, compiled.err = regexp.Compile(rule.Pattern)
+		if compiled.err != nil {
+			compiled.err = fmt.Errorf("invalid pattern: %w", compiled.err)
+		}
+	}
+	return compiled
+}
+
+// validateExclusionRule checks that an exclusion rule has a bucket and at
+// least one condition
+func validateExclusionRule(rule ExclusionRule) error {
+	if rule.Bucket == "" {
+		return fmt.Errorf("bucket name cannot be empty")
+	}
+	if rule.Glob == "" && rule.Pattern == "" && rule.MinSize == nil && rule.MaxSize == nil &&
+		len(rule.UIDs) == 0 && len(rule.GIDs) == 0 && len(rule.Tags) == 0 {
+		return fmt.Errorf("no conditions, it would hide every file")
+	}
+	if rule.MinSize != nil && rule.MaxSize != nil && *rule.MinSize > *rule.MaxSize {
+		return fmt.Errorf("min_size is larger than max_size")
+	}
+	return nil
+}
+
+// matches reports whether the rule hides an entry. Rules that failed to
+// compile hide nothing. Directories, listed as common prefixes, are only
+// hidden by rules that hide every file below them.
+func (r *compiledExclusion) matches(entry StarfishEntry) bool {
+	if r.err != nil {
+		return false
+	}
+
+	key := originalObjectKey(entry)
+	if entry.IsDir() {
+		return r.hidesSubtree() && globMatches(r.Glob, key)
+	}
+
+	if r.Glob != "" && !globMatches(r.Glob, key) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(key) {
+		return false
+	}
+	if r.MinSize != nil && entry.Size < *r.MinSize {
+		return false
+	}
+	if r.MaxSize != nil && entry.Size > *r.MaxSize {
+		return false
+	}
+	if len(r.UIDs) > 0 && !slices.Contains(r.UIDs, entry.UID) {
+		return false
+	}
+	if len(r.GIDs) > 0 && !slices.Contains(r.GIDs, entry.GID) {
+		return false
+	}
+	if len(r.Tags) > 0 && !slices.ContainsFunc(entry.GetAllTags(), func(tag string) bool {
+		return slices.Contains(r.Tags, tag)
+	}) {
+		return false
+	}
+	return true
+}
+
+// sizeOnly reports whether the only conditions of the rule are size
+// bounds
+func (r *compiledExclusion) sizeOnly() bool {
+	return r.err == nil && r.Glob == "" && r.Pattern == "" && len(r.UIDs) == 0 &&
+		len(r.GIDs) == 0 && len(r.Tags) == 0 && (r.MinSize == nil) != (r.MaxSize == nil)
+}
+
+// hidesSubtree reports whether the only condition of the rule is a glob
+// on path elements, which hides every file below a matching directory
+func (r *compiledExclusion) hidesSubtree() bool {
+	return r.err == nil && r.Glob != "" && !strings.Contains(r.Glob, "/") && r.Pattern == "" &&
+		r.MinSize == nil && r.MaxSize == nil && len(r.UIDs) == 0 && len(r.GIDs) == 0 && len(r.Tags) == 0
+}
+
+// globMatches matches a glob against the whole path if it has a "/", and
+// against each element of the path otherwise, so "*.tmp" matches files and
+// ".snapshot" matches directories at any depth
+func globMatches(glob, key string) bool {
+	if strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, key)
+		return ok
+	}
+	for _, elem := range strings.Split(key, "/") {
+		if ok, _ := path.Match(glob, elem); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// exclusions returns the exclusion rules applying to a bucket
+func (b *StarfishBackend) exclusions(bucket string) []compiledExclusion {
+	config := b.rewriteConfig()
+	if config == nil {
+		return nil
+	}
+	config.compile()
+
+	var rules []compiledExclusion
+	for _, rule := range config.exclusions {
+		if rule.Bucket == "*" || rule.Bucket == bucket {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// excluded reports whether any of the rules hides an entry
+func excluded(rules []compiledExclusion, entry StarfishEntry) bool {
+	for i := range rules {
+		if rules[i].matches(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// exclusionFilters returns Starfish query filters leaving out files hidden
+// by the rules, where the query language can express it. Rules with only
+// a lower or an upper size bound become a size range of the files to keep.
+// Entries are checked against every rule regardless, so the filters only
+// save fetching files that would be dropped.
+func exclusionFilters(rules []compiledExclusion) string {
+	low, high := int64(0), int64(-1)
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.sizeOnly() {
+			continue
+		}
+		if rule.MinSize != nil {
+			// Keep files smaller than the bound
+			if high < 0 || *rule.MinSize-1 < high {
+				high = *rule.MinSize - 1
+			}
+		} else {
+			// Keep files larger than the bound
+			low = max(low, *rule.MaxSize+1)
+		}
+	}
+
+	switch {
+	case high >= 0:
+		return "size=" + strconv.FormatInt(low, 10) + "-" + strconv.FormatInt(high, 10)
+	case low > 0:
+		return "size=" + strconv.FormatInt(low, 10) + "-"
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/versity/versitygw/s3err"
+)
+
+func int64Ptr(n int64) *int64 { return &n }
+
+func TestExclusionRules(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query().Get("query"))
+		mu.Unlock()
+		json.NewEncoder(w).Encode([]StarfishEntry{
+			{Filename: "a.txt", ParentPath: "data", Size: 10, Volume: "vol", Inode: 1, UID: 100},
+			{Filename: ".DS_Store", ParentPath: "data", Size: 10, Volume: "vol", Inode: 2},
+			{Filename: "a.txt", ParentPath: "data/.snapshot/hourly", Size: 10, Volume: "vol", Inode: 3},
+			{Filename: "b.tmp", ParentPath: "data", Size: 10, Volume: "vol", Inode: 4},
+			{Filename: "empty.txt", ParentPath: "data", Size: 0, Volume: "vol", Inode: 5},
+			{Filename: "root.txt", ParentPath: "data", Size: 10, Volume: "vol", Inode: 6, UID: 0},
+			{Filename: "secret.txt", ParentPath: "data", Size: 10, Volume: "vol", Inode: 7, UID: 100, TagsInheritedStr: "Access:private"},
+			{Filename: "other.txt", ParentPath: "data", Size: 10, Volume: "vol", Inode: 8, UID: 100},
+		})
+	})
+	defer server.Close()
+
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{
+		PathRewriteConfig: &PathRewriteConfig{
+			Exclude: []ExclusionRule{
+				{Bucket: "*", Glob: ".snapshot"},
+				{Bucket: "*", Glob: ".DS_Store"},
+				{Bucket: "test-bucket", Pattern: `\.tmp$`},
+				{Bucket: "test-bucket", MaxSize: int64Ptr(0)},
+				{Bucket: "test-bucket", Glob: "data/root.*", UIDs: []int{0}},
+				{Bucket: "test-bucket", Tags: []string{"Access:private"}},
+				{Bucket: "other-bucket", Glob: "other.txt"},
+			},
+		},
+	})
+
+	keys, err := listKeys(t, backend, "", "")
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if keys != "data/a.txt,data/other.txt" {
+		t.Errorf("expected data/a.txt,data/other.txt, got %q", keys)
+	}
+
+	// Size bounds are pushed into the query
+	mu.Lock()
+	pushed := len(queries) > 0 && strings.Contains(queries[0], "size=1-")
+	mu.Unlock()
+	if !pushed {
+		t.Errorf("expected the size exclusion in the Starfish query, got %q", queries)
+	}
+
+	backend.invalidateBucket("")
+	for _, key := range []string{"data/.DS_Store", "data/.snapshot/hourly/a.txt", "data/b.tmp",
+		"data/empty.txt", "data/root.txt", "data/secret.txt"} {
+		if _, err := headSize(backend, key); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchKey)) {
+			t.Errorf("expected %s to be hidden, got %v", key, err)
+		}
+	}
+	if size, err := headSize(backend, "data/a.txt"); err != nil || size != 10 {
+		t.Errorf("expected data/a.txt to be served, got size %d, err %v", size, err)
+	}
+}
+
+func TestExclusionFilters(t *testing.T) {
+	compile := func(rules ...ExclusionRule) []compiledExclusion {
+		compiled := make([]compiledExclusion, len(rules))
+		for i, rule := range rules {
+			compiled[i] = compileExclusion(i, rule)
+		}
+		return compiled
+	}
+
+	tests := []struct {
+		name     string
+		rules    []compiledExclusion
+		expected string
+	}{
+		{"none", nil, ""},
+		{"small files", compile(ExclusionRule{MaxSize: int64Ptr(99)}), "size=100-"},
+		{"large files", compile(ExclusionRule{MinSize: int64Ptr(1000)}), "size=0-999"},
+		{"both", compile(ExclusionRule{MaxSize: int64Ptr(99)}, ExclusionRule{MinSize: int64Ptr(1000)},
+			ExclusionRule{MinSize: int64Ptr(5000)}), "size=100-999"},
+		{"size band", compile(ExclusionRule{MinSize: int64Ptr(10), MaxSize: int64Ptr(20)}), ""},
+		{"size and glob", compile(ExclusionRule{MaxSize: int64Ptr(99), Glob: "*.tmp"}), ""},
+	}
+	for _, tt := range tests {
+		if got := exclusionFilters(tt.rules); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestExclusionRuleValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ExclusionRule
+	}{
+		{"empty bucket", ExclusionRule{Glob: "*.tmp"}},
+		{"no conditions", ExclusionRule{Bucket: "*"}},
+		{"inverted size", ExclusionRule{Bucket: "*", MinSize: int64Ptr(10), MaxSize: int64Ptr(1)}},
+		{"invalid glob", ExclusionRule{Bucket: "*", Glob: "[a-"}},
+		{"invalid pattern", ExclusionRule{Bucket: "*", Pattern: "("}},
+	}
+	for _, tt := range tests {
+		if err := validatePathRewriteConfig(&PathRewriteConfig{Exclude: []ExclusionRule{tt.rule}}); err == nil {
+			t.Errorf("%s: expected a validation error", tt.name)
+		}
+	}
+
+	valid := &PathRewriteConfig{Exclude: []ExclusionRule{{Bucket: "*", Glob: "*.tmp"}}}
+	if err := validatePathRewriteConfig(valid); err != nil {
+		t.Errorf("expected a valid configuration, got %v", err)
+	}
+}
@@ -0,0 +1,571 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"container/list"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/versity/versitygw/metrics"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+// listToken is the position of a paginated ListObjectsV2 listing. It is
+// handed to clients as an opaque continuation token and is only accepted
+// for the listing it was issued for.
+type listToken struct {
+	Bucket    string `json:"b"`
+	Prefix    string `json:"p,omitempty"`
+	Delimiter string `json:"d,omitempty"`
+	Marker    string `json:"m"` // last key or common prefix returned
+}
+
+// encode returns the opaque string form of the token
+func (t listToken) encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListToken parses a token previously returned by encode
+func decodeListToken(token string) (listToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return listToken{}, fmt.Errorf("decode list token: %w", err)
+	}
+
+	var t listToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return listToken{}, fmt.Errorf("parse list token: %w", err)
+	}
+
+	return t, nil
+}
+
+// listEntry is a Starfish entry along with the object key it is listed under
+type listEntry struct {
+	key   string
+	entry StarfishEntry
+	dir   bool // a directory listed as the common prefix key
+}
+
+// listPage holds the objects and common prefixes collected for a single
+// ListObjects or ListObjectsV2 response
+type listPage struct {
+	Contents       []s3response.Object
+	CommonPrefixes []types.CommonPrefix
+	IsTruncated    bool
+	NextMarker     string // last key or common prefix returned, set when IsTruncated
+}
+
+// listObjects collects up to maxKeys objects and common prefixes with keys
+// after marker, in key order. The marker is either a key or a common prefix
+// returned on a previous page, or a client supplied StartAfter/Marker.
+func (b *StarfishBackend) listObjects(ctx context.Context, operation, bucket, prefix, delimiter, marker string, maxKeys int) (listPage, error) {
+	var page listPage
+	if maxKeys <= 0 {
+		return page, nil
+	}
+
+	var (
+		entries []listEntry
+		levels  bool
+		err     error
+	)
+	if delimiter == "/" {
+		entries, levels, err = b.listLevel(ctx, operation, bucket, prefix)
+	}
+	if err == nil && !levels {
+		entries, err = b.listEntries(ctx, operation, bucket, prefix)
+	}
+	if err != nil {
+		return listPage{}, err
+	}
+
+	// Everything up to and including the marker has already been returned
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].key > marker
+	})
+
+	var listed []listEntry
+	for i < len(entries) {
+		le := entries[i]
+		i++
+
+		// Handle delimiter logic for common prefixes
+		if le.dir || (delimiter != "" && b.shouldBeCommonPrefix(le.key, prefix, delimiter)) {
+			commonPrefix := le.key
+			if !le.dir {
+				commonPrefix = b.getCommonPrefix(le.key, prefix, delimiter)
+			}
+
+			// Keys sharing a common prefix are adjacent in key order,
+			// skip past all of them
+			i += sort.Search(len(entries)-i, func(j int) bool {
+				return !strings.HasPrefix(entries[i+j].key, commonPrefix)
+			})
+
+			// Common prefixes containing the marker were returned before
+			if strings.HasPrefix(marker, commonPrefix) {
+				continue
+			}
+
+			if len(page.Contents)+len(page.CommonPrefixes) >= maxKeys {
+				page.IsTruncated = true
+				break
+			}
+
+			page.CommonPrefixes = append(page.CommonPrefixes, types.CommonPrefix{
+				Prefix: &commonPrefix,
+			})
+			page.NextMarker = commonPrefix
+			continue
+		}
+
+		// Another key remains, stop here
+		if len(page.Contents)+len(page.CommonPrefixes) >= maxKeys {
+			page.IsTruncated = true
+			break
+		}
+
+		// Listings never read file content, content ETags are only
+		// returned once they are known
+		eTag := b.cachedETag(le.entry, bucket)
+		modifyTime := le.entry.GetModifyTime()
+		size := le.entry.Size
+		key := le.key
+		page.Contents = append(page.Contents, s3response.Object{
+			Key:          &key,
+			Size:         &size,
+			LastModified: &modifyTime,
+			ETag:         &eTag,
+		})
+		page.NextMarker = key
+		listed = append(listed, le)
+	}
+
+	if !page.IsTruncated {
+		page.NextMarker = ""
+	}
+
+	// Listed keys are likely to be fetched next, remember where rewritten
+	// keys came from so they resolve without another scan
+	if b.hasPathRewriteRules(bucket) {
+		for _, le := range listed {
+			b.rewriteIndex.add(bucket, le.key, le.entry)
+		}
+	}
+
+	return page, nil
+}
+
+// listEntries returns the entries of the bucket with keys starting with
+// prefix, sorted by key. Starfish sorts results by parent_path and fn,
+// which is not key order: the files of a directory come before those of
+// its subdirectories, and dir sorts before dir-x although dir-x/ sorts
+// before dir/. The matching entries are therefore collected and sorted
+// before a page is cut from them, and kept in the listing cache so later
+// pages of the same listing do not query Starfish again. Keys are unique,
+// entries sharing a key are resolved by the collision policy.
+func (b *StarfishBackend) listEntries(ctx context.Context, operation, bucket, prefix string) ([]listEntry, error) {
+	if entries, ok := b.listCache.get(bucket, prefix); ok {
+		return entries, nil
+	}
+
+	queries := b.listQueries(bucket, prefix)
+
+	// A prefix ending in an inode suffix also covers the suffixed keys of
+	// entries colliding on the key before it
+	base, hasBase := b.collisionBase(prefix)
+	if hasBase {
+		queries = appendUnique(queries, b.listQueries(bucket, base)...)
+	}
+
+	entries, err := b.findEntries(ctx, operation, bucket, queries, func(key string) bool {
+		return strings.HasPrefix(key, prefix) || (hasBase && key == base)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err = b.uniqueKeys(bucket, entries)
+	if err != nil {
+		return nil, err
+	}
+	if hasBase {
+		entries = slices.DeleteFunc(entries, func(le listEntry) bool {
+			return !strings.HasPrefix(le.key, prefix)
+		})
+	}
+
+	b.listCache.add(bucket, prefix, entries)
+	return entries, nil
+}
+
+// findEntries runs Starfish queries and returns the entries whose listing
+// keys, before collisions are resolved, satisfy match. The query filters
+// may match a superset of the wanted keys.
+func (b *StarfishBackend) findEntries(ctx context.Context, operation, bucket string, queries []string, match func(key string) bool) ([]listEntry, error) {
+	if b.shardsEnabled() {
+		return b.findEntriesByVolume(ctx, operation, bucket, queries, match)
+	}
+	return b.collectEntries(ctx, operation, bucket, "", queries, match)
+}
+
+// collectEntries is findEntries restricted to the entries on a volume, or
+// on any volume if volume is empty
+func (b *StarfishBackend) collectEntries(ctx context.Context, operation, bucket, volume string, queries []string, match func(key string) bool) ([]listEntry, error) {
+	// The same entry may match more than one of the queries
+	var seen map[string]bool
+	if len(queries) > 1 {
+		seen = make(map[string]bool)
+	}
+
+	var entries []listEntry
+	for _, query := range queries {
+		err := b.walkVolumeQuery(ctx, operation, bucket, volume, query, true, func(entry StarfishEntry) bool {
+			if seen != nil {
+				id := entryID(entry)
+				if seen[id] {
+					return true
+				}
+				seen[id] = true
+			}
+
+			key := b.objectKeyForEntry(entry, bucket)
+			if match(key) {
+				entries = append(entries, listEntry{key: key, entry: entry})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// appendUnique appends the values missing from s
+func appendUnique(s []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(s, v) {
+			s = append(s, v)
+		}
+	}
+	return s
+}
+
+// listQueries returns the Starfish queries whose combined results cover
+// every file in the bucket with a key starting with prefix. Only files (f
+// is the type code for regular files) are listed, narrowed where possible
+// to the part of the collection below the prefix.
+func (b *StarfishBackend) listQueries(bucket, prefix string) []string {
+	whole := []string{"type=f"}
+
+	prefixes := []string{prefix}
+	if b.hasPathRewriteRules(bucket) {
+		var ok bool
+		prefixes, ok = b.originalPrefixes(bucket, prefix)
+		if !ok {
+			return whole
+		}
+	}
+
+	var queries []string
+	seen := make(map[string]bool)
+	for _, p := range prefixes {
+		filters := prefixFilters(p)
+		if filters == nil {
+			return whole
+		}
+		for _, filter := range filters {
+			query := "type=f " + filter
+			if !seen[query] {
+				seen[query] = true
+				queries = append(queries, query)
+			}
+		}
+	}
+
+	return queries
+}
+
+// walkQuery calls fn for each entry matching the query, fetching one page
+// of results at a time until fn returns false or the results run out
+func (b *StarfishBackend) walkQuery(ctx context.Context, operation, bucket, additionalQuery string, cached bool, fn func(StarfishEntry) bool) error {
+	return b.walkVolumeQuery(ctx, operation, bucket, "", additionalQuery, cached, fn)
+}
+
+// walkVolumeQuery is walkQuery restricted to the entries on a volume, or
+// on any volume if volume is empty
+func (b *StarfishBackend) walkVolumeQuery(ctx context.Context, operation, bucket, volume, additionalQuery string, cached bool, fn func(StarfishEntry) bool) error {
+	// Files hidden by exclusion rules are left out of the query where
+	// Starfish can filter them, and skipped here otherwise
+	exclusions := b.exclusions(bucket)
+	if filter := exclusionFilters(exclusions); filter != "" && !isDirectoryQuery(additionalQuery) {
+		additionalQuery = strings.TrimSpace(additionalQuery + " " + filter)
+	}
+
+	offset := 0
+	firstID := ""
+	for {
+		result, err := b.queryPage(ctx, operation, bucket, volume, additionalQuery, offset, cached)
+		if err != nil {
+			return err
+		}
+
+		// A page starting where the previous one did means Starfish did
+		// not apply the offset, give up rather than loop forever
+		if offset > 0 && len(result.Entries) > 0 && entryID(result.Entries[0]) == firstID {
+			return fmt.Errorf("starfish query %q returned the same page at offset %d",
+				additionalQuery, offset)
+		}
+
+		for _, entry := range result.Entries {
+			if excluded(exclusions, entry) {
+				continue
+			}
+			if !fn(entry) {
+				return nil
+			}
+		}
+
+		// A short page means Starfish has no more results
+		if len(result.Entries) < b.pageSize() {
+			return nil
+		}
+		firstID = entryID(result.Entries[0])
+		offset += len(result.Entries)
+	}
+}
+
+// entryID identifies a Starfish entry by its location
+func entryID(entry StarfishEntry) string {
+	return entry.Volume + ":" + entry.ParentPath + "/" + entry.Filename
+}
+
+// queryPage returns one page of Starfish results for a query, restricted
+// to a volume if volume is set. Concurrent requests for the same page are
+// sent to Starfish once, and if cached is set the page is kept in the
+// query cache.
+func (b *StarfishBackend) queryPage(ctx context.Context, operation, bucket, volume, additionalQuery string, offset int, cached bool) (*StarfishQueryResponse, error) {
+	startTime := time.Now()
+	key := queryCacheKey(bucket, additionalQuery, offset)
+	volumeAndPath := ""
+	if volume != "" {
+		key += "\x00" + volume
+		volumeAndPath = volume + ":"
+	}
+	load := func() (*StarfishQueryResponse, error) {
+		return b.QueryStarfishPage(ctx, bucket, volumeAndPath, additionalQuery, offset)
+	}
+
+	var (
+		result *StarfishQueryResponse
+		err    error
+	)
+	if cached {
+		result, err = b.cache.GetOrLoad(key, volumeAndPath, load)
+	} else {
+		result, err = b.cache.Coalesce(key, load)
+	}
+
+	// Record metrics
+	if b.metricsManager != nil {
+		duration := time.Since(startTime).Milliseconds()
+		b.metricsManager.Add("starfish_query_duration_ms", duration,
+			metrics.Tag{Key: "bucket", Value: bucket},
+			metrics.Tag{Key: "operation", Value: operation})
+
+		if err != nil {
+			b.metricsManager.Add("starfish_query_errors", 1,
+				metrics.Tag{Key: "bucket", Value: bucket},
+				metrics.Tag{Key: "operation", Value: operation})
+		} else {
+			b.metricsManager.Add("starfish_query_success", 1,
+				metrics.Tag{Key: "bucket", Value: bucket},
+				metrics.Tag{Key: "operation", Value: operation})
+			b.metricsManager.Add("starfish_objects_returned", int64(len(result.Entries)),
+				metrics.Tag{Key: "bucket", Value: bucket})
+		}
+	}
+
+	if err != nil {
+		// Expired results beat failing the request while Starfish is down
+		if cached && isStarfishUnavailable(err) && ctx.Err() == nil {
+			if stale := b.cache.GetStale(key); stale != nil {
+				b.markStale(ctx, bucket)
+				return stale, nil
+			}
+		}
+		return nil, starfishErrToS3Err(err)
+	}
+
+	return result, nil
+}
+
+// queryCacheKey returns the query cache key of a page of query results.
+// Keys start with the bucket so a bucket's pages can be invalidated
+// together.
+func queryCacheKey(bucket, query string, offset int) string {
+	return bucket + "\x00" + query + "\x00" + strconv.Itoa(offset)
+}
+
+// parseContinuationToken returns the marker to resume a ListObjectsV2
+// listing from. Tokens issued for a different listing are rejected.
+func parseContinuationToken(token, bucket, prefix, delimiter string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+
+	pos, err := decodeListToken(token)
+	if err != nil {
+		return "", s3err.GetAPIError(s3err.ErrInvalidContinuationToken)
+	}
+	if pos.Bucket != bucket || pos.Prefix != prefix || pos.Delimiter != delimiter {
+		return "", s3err.GetAPIError(s3err.ErrInvalidContinuationToken)
+	}
+
+	return pos.Marker, nil
+}
+
+// listCache keeps the sorted entries of recent listings so a listing
+// paged through by a client is only fetched from Starfish once. It is
+// bounded by the total number of entries held, the least recently used
+// listings are dropped first.
+type listCache struct {
+	mu         sync.Mutex
+	items      map[string]*list.Element
+	lru        *list.List
+	size       int
+	maxEntries int
+	ttl        time.Duration
+}
+
+// listCacheItem is the sorted result of one listing
+type listCacheItem struct {
+	bucket   string
+	prefix   string
+	entries  []listEntry
+	cachedAt time.Time
+}
+
+// newListCache creates a listing cache holding up to maxEntries entries,
+// each listing is trusted for ttl
+func newListCache(maxEntries int, ttl time.Duration) *listCache {
+	return &listCache{
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		ttl:        ttl,
+	}
+}
+
+// listCacheKey returns the cache key of the listing of prefix in bucket
+func listCacheKey(bucket, prefix string) string {
+	return bucket + "\x00" + prefix
+}
+
+// get returns the cached listing of prefix in bucket
+func (c *listCache) get(bucket, prefix string) ([]listEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[listCacheKey(bucket, prefix)]
+	if !ok {
+		return nil, false
+	}
+
+	item := elem.Value.(*listCacheItem)
+	if c.ttl > 0 && time.Since(item.cachedAt) > c.ttl {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return item.entries, true
+}
+
+// add caches the listing of prefix in bucket, evicting older listings to
+// stay within the entry budget. Listings larger than the whole budget are
+// not cached.
+func (c *listCache) add(bucket, prefix string, entries []listEntry) {
+	if c == nil || len(entries) > c.maxEntries {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := listCacheKey(bucket, prefix)
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+
+	c.items[key] = c.lru.PushFront(&listCacheItem{
+		bucket:   bucket,
+		prefix:   prefix,
+		entries:  entries,
+		cachedAt: time.Now(),
+	})
+	c.size += len(entries)
+
+	for c.size > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// clear drops the cached listings of a bucket, or of every bucket if
+// bucket is empty
+func (c *listCache) clear(bucket string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if bucket == "" || elem.Value.(*listCacheItem).bucket == bucket {
+			c.remove(elem)
+		}
+		elem = next
+	}
+}
+
+// remove drops a cached listing, the caller must hold the lock
+func (c *listCache) remove(elem *list.Element) {
+	item := c.lru.Remove(elem).(*listCacheItem)
+	delete(c.items, listCacheKey(item.bucket, item.prefix))
+	c.size -= len(item.entries)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Starfish file attributes returned as S3 user metadata, sent by the
+// gateway as x-amz-meta-starfish-* headers
+const (
+	metaUID    = "starfish-uid"
+	metaGID    = "starfish-gid"
+	metaMode   = "starfish-mode"
+	metaInode  = "starfish-inode"
+	metaVolume = "starfish-volume"
+	metaCtime  = "starfish-ctime"
+	metaAtime  = "starfish-atime"
+	metaZones  = "starfish-zones"
+)
+
+// objectMetadata returns the POSIX attributes and provenance of a Starfish
+// entry as S3 user metadata. Attributes Starfish did not return are left
+// out.
+func objectMetadata(entry StarfishEntry) map[string]string {
+	metadata := map[string]string{
+		metaUID: strconv.Itoa(entry.UID),
+		metaGID: strconv.Itoa(entry.GID),
+	}
+
+	if entry.Mode != "" {
+		metadata[metaMode] = entry.Mode
+	}
+	if entry.Inode != 0 {
+		metadata[metaInode] = strconv.FormatInt(entry.Inode, 10)
+	}
+	if entry.Volume != "" {
+		metadata[metaVolume] = entry.Volume
+	}
+	if entry.CreateTimeUnix > 0 {
+		metadata[metaCtime] = entry.GetCreateTime().UTC().Format(time.RFC3339)
+	}
+	if entry.AccessTimeUnix > 0 {
+		metadata[metaAtime] = entry.GetAccessTime().UTC().Format(time.RFC3339)
+	}
+
+	if len(entry.Zones) > 0 {
+		zones := make([]string, 0, len(entry.Zones))
+		for _, zone := range entry.Zones {
+			zones = append(zones, zone.Name)
+		}
+		metadata[metaZones] = strings.Join(zones, ",")
+	}
+
+	return metadata
+}
+
+// contentType guesses the Content-Type of an entry from its file
+// extension, returning nil if the extension is not known
+func contentType(entry StarfishEntry) *string {
+	ext := path.Ext(entry.Filename)
+	if ext == "" {
+		return nil
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(ext))
+	if mimeType == "" {
+		return nil
+	}
+	return &mimeType
+}
@@ -0,0 +1,717 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/versity/versitygw/backend"
+	"github.com/versity/versitygw/s3api/utils"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+// Multipart uploads are staged by the file server on the volume of the
+// target file and assembled there, so part data never passes through the
+// gateway twice. The file server computes the MD5 and checksum of each
+// part, the S3 rules for completing an upload are checked here as in the
+// posix backend.
+
+// multipartStagingDir is where the file server stages uploads, relative to
+// the volume root
+const multipartStagingDir = ".sgwtmp"
+
+// uploadMetadata is kept by the file server with a staged upload
+type uploadMetadata struct {
+	ChecksumAlgorithm types.ChecksumAlgorithm `json:"checksumAlgorithm,omitempty"`
+	ChecksumType      types.ChecksumType      `json:"checksumType,omitempty"`
+}
+
+// stagedUpload is a multipart upload staged by the file server
+type stagedUpload struct {
+	UploadID  string         `json:"uploadId"`
+	Path      string         `json:"path"`
+	Initiated time.Time      `json:"initiated"`
+	Metadata  uploadMetadata `json:"metadata"`
+	Parts     []stagedPart   `json:"parts"`
+}
+
+// stagedPart is a part staged by the file server. Checksum is computed
+// with the algorithm of the upload.
+type stagedPart struct {
+	PartNumber   int       `json:"partNumber"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	ETag         string    `json:"etag"`
+	Checksum     string    `json:"checksum"`
+}
+
+// assembleRequest asks the file server to assemble parts into the file
+type assembleRequest struct {
+	Parts             []int  `json:"parts"`
+	ChecksumAlgorithm string `json:"checksumAlgorithm,omitempty"`
+	Checksum          string `json:"checksum,omitempty"`
+}
+
+// assembleResponse describes the assembled file
+type assembleResponse struct {
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// multipartRequest sends a multipart upload request for a file to the
+// file server
+func (b *StarfishBackend) multipartRequest(ctx context.Context, method string, target WriteTarget, object string, query url.Values, body io.Reader, length *int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.fileURL(target.Volume, object)+"?"+query.Encode(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file server request: %w", err)
+	}
+	if length != nil {
+		req.ContentLength = *length
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("X-Internal-Token", b.bearerToken)
+
+	resp, err := b.writeClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("file server request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// multipartError maps a failed file server multipart response to an S3
+// error. The file server reports S3 error codes in the response body.
+func multipartError(resp *http.Response, algo types.ChecksumAlgorithm) error {
+	body, _ := io.ReadAll(resp.Body)
+	code := strings.TrimSpace(string(body))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return s3err.GetAPIError(s3err.ErrNoSuchUpload)
+	case resp.StatusCode == http.StatusForbidden, resp.StatusCode == http.StatusMethodNotAllowed:
+		return s3err.GetAPIError(s3err.ErrAccessDenied)
+	case code == "BadDigest":
+		return s3err.GetChecksumBadDigestErr(algo)
+	case code == s3err.GetAPIError(s3err.ErrInvalidPart).Code:
+		return s3err.GetAPIError(s3err.ErrInvalidPart)
+	case resp.StatusCode == http.StatusConflict:
+		return s3err.GetAPIError(s3err.ErrObjectParentIsFile)
+	}
+
+	return fmt.Errorf("file server returned status %d: %s", resp.StatusCode, code)
+}
+
+// stagedUpload returns a staged upload and its parts
+func (b *StarfishBackend) stagedUpload(ctx context.Context, target WriteTarget, object, uploadID string) (stagedUpload, error) {
+	resp, err := b.multipartRequest(ctx, http.MethodGet, target, object,
+		url.Values{"uploadId": {uploadID}}, nil, nil, nil)
+	if err != nil {
+		return stagedUpload{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return stagedUpload{}, multipartError(resp, "")
+	}
+
+	var upload stagedUpload
+	if err := json.NewDecoder(resp.Body).Decode(&upload); err != nil {
+		return stagedUpload{}, fmt.Errorf("failed to decode upload: %w", err)
+	}
+	return upload, nil
+}
+
+// CreateMultipartUpload stages a new multipart upload on the volume of a
+// writable collection
+func (b *StarfishBackend) CreateMultipartUpload(ctx context.Context, mpu s3response.CreateMultipartUploadInput) (s3response.InitiateMultipartUploadResult, error) {
+	if mpu.Bucket == nil {
+		return s3response.InitiateMultipartUploadResult{}, s3err.GetAPIError(s3err.ErrInvalidBucketName)
+	}
+	if mpu.Key == nil {
+		return s3response.InitiateMultipartUploadResult{}, s3err.GetAPIError(s3err.ErrNoSuchKey)
+	}
+	bucket, object := *mpu.Bucket, *mpu.Key
+
+	target, err := b.writeTarget(bucket, object)
+	if err != nil {
+		return s3response.InitiateMultipartUploadResult{}, err
+	}
+
+	metadata, err := json.Marshal(uploadMetadata{
+		ChecksumAlgorithm: mpu.ChecksumAlgorithm,
+		ChecksumType:      mpu.ChecksumType,
+	})
+	if err != nil {
+		return s3response.InitiateMultipartUploadResult{}, fmt.Errorf("failed to encode upload metadata: %w", err)
+	}
+
+	resp, err := b.multipartRequest(ctx, http.MethodPost, target, object,
+		url.Values{"uploads": {""}}, bytes.NewReader(metadata), nil, nil)
+	if err != nil {
+		return s3response.InitiateMultipartUploadResult{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return s3response.InitiateMultipartUploadResult{}, multipartError(resp, "")
+	}
+
+	var upload stagedUpload
+	if err := json.NewDecoder(resp.Body).Decode(&upload); err != nil {
+		return s3response.InitiateMultipartUploadResult{}, fmt.Errorf("failed to decode upload: %w", err)
+	}
+
+	return s3response.InitiateMultipartUploadResult{
+		Bucket:   bucket,
+		Key:      object,
+		UploadId: upload.UploadID,
+	}, nil
+}
+
+// UploadPart stages a part through the file server, which validates the
+// part checksum before storing it
+func (b *StarfishBackend) UploadPart(ctx context.Context, input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	if input.Bucket == nil {
+		return nil, s3err.GetAPIError(s3err.ErrInvalidBucketName)
+	}
+	if input.Key == nil {
+		return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
+	}
+	if input.UploadId == nil {
+		return nil, s3err.GetAPIError(s3err.ErrNoSuchUpload)
+	}
+	if input.PartNumber == nil {
+		return nil, s3err.GetAPIError(s3err.ErrInvalidPartNumber)
+	}
+	bucket, object := *input.Bucket, *input.Key
+
+	target, err := b.writeTarget(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, err := b.stagedUpload(ctx, target, object, *input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	// A checksum value selects its algorithm, otherwise the checksum of
+	// the requested algorithm is only computed
+	algo, expected := input.ChecksumAlgorithm, ""
+	provided := s3response.Checksum{
+		CRC32:     input.ChecksumCRC32,
+		CRC32C:    input.ChecksumCRC32C,
+		SHA1:      input.ChecksumSHA1,
+		SHA256:    input.ChecksumSHA256,
+		CRC64NVME: input.ChecksumCRC64NVME,
+	}
+	for _, candidate := range checksumAlgorithms {
+		if value := checksumValue(provided, candidate); value != "" {
+			algo, expected = candidate, value
+			break
+		}
+	}
+
+	// If checksum isn't provided for the part,
+	// but it has been provided on mp initalization
+	if algo == "" && upload.Metadata.ChecksumAlgorithm != "" {
+		return nil, s3err.GetChecksumTypeMismatchErr(upload.Metadata.ChecksumAlgorithm, "null")
+	}
+	// The checksum algorithm must match the one of the upload
+	if algo != "" && upload.Metadata.ChecksumType != "" && algo != upload.Metadata.ChecksumAlgorithm {
+		return nil, s3err.GetChecksumTypeMismatchErr(upload.Metadata.ChecksumAlgorithm, algo)
+	}
+
+	header := http.Header{}
+	if algo != "" {
+		header.Set("X-Checksum-Algorithm", string(algo))
+		if expected != "" {
+			header.Set("X-Checksum", expected)
+		}
+	}
+
+	body := input.Body
+	if body == nil {
+		body = http.NoBody
+	}
+
+	query := url.Values{
+		"uploadId":   {*input.UploadId},
+		"partNumber": {strconv.Itoa(int(*input.PartNumber))},
+	}
+	resp, err := b.multipartRequest(ctx, http.MethodPut, target, object, query,
+		body, input.ContentLength, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, multipartError(resp, algo)
+	}
+
+	var part stagedPart
+	if err := json.NewDecoder(resp.Body).Decode(&part); err != nil {
+		return nil, fmt.Errorf("failed to decode part: %w", err)
+	}
+
+	output := &s3.UploadPartOutput{
+		ETag: &part.ETag,
+	}
+	if algo != "" {
+		checksum := newChecksum(algo, part.Checksum)
+		output.ChecksumCRC32 = checksum.CRC32
+		output.ChecksumCRC32C = checksum.CRC32C
+		output.ChecksumSHA1 = checksum.SHA1
+		output.ChecksumSHA256 = checksum.SHA256
+		output.ChecksumCRC64NVME = checksum.CRC64NVME
+	}
+
+	return output, nil
+}
+
+// ListParts lists the staged parts of an upload
+func (b *StarfishBackend) ListParts(ctx context.Context, input *s3.ListPartsInput) (s3response.ListPartsResult, error) {
+	var lpr s3response.ListPartsResult
+
+	if input.Bucket == nil {
+		return lpr, s3err.GetAPIError(s3err.ErrInvalidBucketName)
+	}
+	if input.Key == nil {
+		return lpr, s3err.GetAPIError(s3err.ErrNoSuchKey)
+	}
+	if input.UploadId == nil {
+		return lpr, s3err.GetAPIError(s3err.ErrNoSuchUpload)
+	}
+	bucket, object, uploadID := *input.Bucket, *input.Key, *input.UploadId
+
+	var partNumberMarker int
+	if marker := backend.GetStringFromPtr(input.PartNumberMarker); marker != "" {
+		var err error
+		partNumberMarker, err = strconv.Atoi(marker)
+		if err != nil {
+			return lpr, s3err.GetAPIError(s3err.ErrInvalidPartNumberMarker)
+		}
+	}
+
+	maxParts := 1000
+	if input.MaxParts != nil {
+		maxParts = int(*input.MaxParts)
+	}
+
+	target, err := b.writeTarget(bucket, object)
+	if err != nil {
+		return lpr, err
+	}
+
+	upload, err := b.stagedUpload(ctx, target, object, uploadID)
+	if err != nil {
+		return lpr, err
+	}
+
+	parts := make([]s3response.Part, 0, len(upload.Parts))
+	for _, part := range upload.Parts {
+		if part.PartNumber <= partNumberMarker {
+			continue
+		}
+
+		checksum := newChecksum(upload.Metadata.ChecksumAlgorithm, upload.partChecksum(part))
+		parts = append(parts, s3response.Part{
+			PartNumber:        part.PartNumber,
+			ETag:              part.ETag,
+			LastModified:      part.LastModified,
+			Size:              part.Size,
+			ChecksumCRC32:     checksum.CRC32,
+			ChecksumCRC32C:    checksum.CRC32C,
+			ChecksumSHA1:      checksum.SHA1,
+			ChecksumSHA256:    checksum.SHA256,
+			ChecksumCRC64NVME: checksum.CRC64NVME,
+		})
+	}
+
+	oldLen := len(parts)
+	if maxParts > 0 && len(parts) > maxParts {
+		parts = parts[:maxParts]
+	}
+
+	nextpart := 0
+	if len(parts) != 0 {
+		nextpart = parts[len(parts)-1].PartNumber
+	}
+
+	algorithm := upload.Metadata.ChecksumAlgorithm
+	if algorithm == "" {
+		algorithm = types.ChecksumAlgorithm("null")
+	}
+	checksumType := upload.Metadata.ChecksumType
+	if checksumType == "" {
+		checksumType = types.ChecksumType("null")
+	}
+
+	return s3response.ListPartsResult{
+		Bucket:               bucket,
+		IsTruncated:          oldLen != len(parts),
+		Key:                  object,
+		MaxParts:             maxParts,
+		NextPartNumberMarker: nextpart,
+		PartNumberMarker:     partNumberMarker,
+		Parts:                parts,
+		UploadID:             uploadID,
+		StorageClass:         types.StorageClassStandard,
+		ChecksumAlgorithm:    algorithm,
+		ChecksumType:         checksumType,
+	}, nil
+}
+
+// CompleteMultipartUpload checks the parts of an upload and has the file
+// server assemble them into the file, which is then tagged with the
+// collection tag like a single part upload
+func (b *StarfishBackend) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput) (s3response.CompleteMultipartUploadResult, string, error) {
+	var res s3response.CompleteMultipartUploadResult
+
+	if input.Bucket == nil {
+		return res, "", s3err.GetAPIError(s3err.ErrInvalidBucketName)
+	}
+	if input.Key == nil {
+		return res, "", s3err.GetAPIError(s3err.ErrNoSuchKey)
+	}
+	if input.UploadId == nil {
+		return res, "", s3err.GetAPIError(s3err.ErrNoSuchUpload)
+	}
+	if input.MultipartUpload == nil {
+		return res, "", s3err.GetAPIError(s3err.ErrInvalidRequest)
+	}
+	bucket, object := *input.Bucket, *input.Key
+	parts := input.MultipartUpload.Parts
+
+	target, err := b.writeTarget(bucket, object)
+	if err != nil {
+		return res, "", err
+	}
+
+	upload, err := b.stagedUpload(ctx, target, object, *input.UploadId)
+	if err != nil {
+		return res, "", err
+	}
+	algo := upload.Metadata.ChecksumAlgorithm
+	checksumType := upload.Metadata.ChecksumType
+
+	// ChecksumType should be the same as specified on CreateMultipartUpload
+	if input.ChecksumType != "" && checksumType != input.ChecksumType {
+		if checksumType == "" {
+			return res, "", s3err.GetChecksumTypeMismatchOnMpErr(types.ChecksumType("null"))
+		}
+		return res, "", s3err.GetChecksumTypeMismatchOnMpErr(checksumType)
+	}
+
+	staged := make(map[int]stagedPart, len(upload.Parts))
+	for _, part := range upload.Parts {
+		staged[part.PartNumber] = part
+	}
+
+	// check all parts ok
+	last := len(parts) - 1
+	var totalsize int64
+	var partNumber int32
+	partNumbers := make([]int, 0, len(parts))
+	for i, part := range parts {
+		if part.PartNumber == nil {
+			return res, "", s3err.GetAPIError(s3err.ErrInvalidPart)
+		}
+		if *part.PartNumber < 1 {
+			return res, "", s3err.GetAPIError(s3err.ErrInvalidCompleteMpPartNumber)
+		}
+		if *part.PartNumber <= partNumber {
+			return res, "", s3err.GetAPIError(s3err.ErrInvalidPartOrder)
+		}
+		partNumber = *part.PartNumber
+
+		stagedPart, ok := staged[int(partNumber)]
+		if !ok {
+			return res, "", s3err.GetAPIError(s3err.ErrInvalidPart)
+		}
+
+		totalsize += stagedPart.Size
+		// all parts except the last need to be at least the minimum
+		// allowed size (5 MiB)
+		if i < last && stagedPart.Size < backend.MinPartSize {
+			return res, "", s3err.GetAPIError(s3err.ErrEntityTooSmall)
+		}
+
+		if part.ETag == nil || !backend.AreEtagsSame(stagedPart.ETag, *part.ETag) {
+			return res, "", s3err.GetAPIError(s3err.ErrInvalidPart)
+		}
+
+		if err := validatePartChecksum(algo, upload.partChecksum(stagedPart), part); err != nil {
+			return res, "", err
+		}
+
+		partNumbers = append(partNumbers, int(partNumber))
+	}
+
+	if input.MpuObjectSize != nil && totalsize != *input.MpuObjectSize {
+		return res, "", s3err.GetIncorrectMpObjectSizeErr(totalsize, *input.MpuObjectSize)
+	}
+
+	provided := checksumValue(s3response.Checksum{
+		CRC32:     input.ChecksumCRC32,
+		CRC32C:    input.ChecksumCRC32C,
+		SHA1:      input.ChecksumSHA1,
+		SHA256:    input.ChecksumSHA256,
+		CRC64NVME: input.ChecksumCRC64NVME,
+	}, algo)
+
+	// Composite checksums are computed from the part checksums, full
+	// object checksums by the file server while it assembles the file
+	req := assembleRequest{Parts: partNumbers}
+	var sum string
+	switch checksumType {
+	case types.ChecksumTypeComposite:
+		compositeRdr, err := utils.NewCompositeChecksumReader(utils.HashType(strings.ToLower(string(algo))))
+		if err != nil {
+			return res, "", fmt.Errorf("initialize composite checksum reader: %w", err)
+		}
+		for _, part := range parts {
+			if err := compositeRdr.Process(completedPartChecksum(algo, part)); err != nil {
+				return res, "", fmt.Errorf("process %v part checksum: %w", *part.PartNumber, err)
+			}
+		}
+		sum = compositeRdr.Sum()
+		if provided != "" && provided != sum {
+			return res, "", s3err.GetChecksumBadDigestErr(algo)
+		}
+	case types.ChecksumTypeFullObject:
+		req.ChecksumAlgorithm = string(algo)
+		req.Checksum = provided
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return res, "", fmt.Errorf("failed to encode complete request: %w", err)
+	}
+
+	resp, err := b.multipartRequest(ctx, http.MethodPost, target, object,
+		url.Values{"uploadId": {*input.UploadId}}, bytes.NewReader(body), nil, nil)
+	if err != nil {
+		return res, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return res, "", multipartError(resp, algo)
+	}
+
+	var assembled assembleResponse
+	if err := json.NewDecoder(resp.Body).Decode(&assembled); err != nil {
+		return res, "", fmt.Errorf("failed to decode assembled file: %w", err)
+	}
+	if checksumType == types.ChecksumTypeFullObject {
+		sum = assembled.Checksum
+	}
+
+	if err := b.tagWrittenObject(ctx, bucket, target.Volume, object); err != nil {
+		return res, "", err
+	}
+
+	b.invalidateBucket(bucket)
+
+	// Calculate s3 compatible md5sum for complete multipart.
+	s3MD5 := backend.GetMultipartMD5(parts)
+
+	res = s3response.CompleteMultipartUploadResult{
+		Bucket: &bucket,
+		ETag:   &s3MD5,
+		Key:    &object,
+	}
+	if checksumType != "" {
+		checksum := newChecksum(algo, sum)
+		res.ChecksumCRC32 = checksum.CRC32
+		res.ChecksumCRC32C = checksum.CRC32C
+		res.ChecksumSHA1 = checksum.SHA1
+		res.ChecksumSHA256 = checksum.SHA256
+		res.ChecksumCRC64NVME = checksum.CRC64NVME
+		res.ChecksumType = &checksumType
+	}
+
+	return res, "", nil
+}
+
+// AbortMultipartUpload removes a staged upload and its parts
+func (b *StarfishBackend) AbortMultipartUpload(ctx context.Context, mpu *s3.AbortMultipartUploadInput) error {
+	if mpu.Bucket == nil {
+		return s3err.GetAPIError(s3err.ErrInvalidBucketName)
+	}
+	if mpu.Key == nil {
+		return s3err.GetAPIError(s3err.ErrNoSuchKey)
+	}
+	if mpu.UploadId == nil {
+		return s3err.GetAPIError(s3err.ErrNoSuchUpload)
+	}
+
+	target, err := b.writeTarget(*mpu.Bucket, *mpu.Key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.multipartRequest(ctx, http.MethodDelete, target, *mpu.Key,
+		url.Values{"uploadId": {*mpu.UploadId}}, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return multipartError(resp, "")
+	}
+	return nil
+}
+
+// partChecksum returns the stored checksum of a part. As in the posix
+// backend, part checksums only count if the upload has a checksum type.
+func (u stagedUpload) partChecksum(part stagedPart) string {
+	if u.Metadata.ChecksumType == "" {
+		return ""
+	}
+	return part.Checksum
+}
+
+// checksumAlgorithms are the checksum algorithms in the order their
+// values are checked
+var checksumAlgorithms = []types.ChecksumAlgorithm{
+	types.ChecksumAlgorithmCrc32,
+	types.ChecksumAlgorithmCrc32c,
+	types.ChecksumAlgorithmSha1,
+	types.ChecksumAlgorithmSha256,
+	types.ChecksumAlgorithmCrc64nvme,
+}
+
+// checksumValue returns the value of an algorithm in c
+func checksumValue(c s3response.Checksum, algo types.ChecksumAlgorithm) string {
+	switch algo {
+	case types.ChecksumAlgorithmCrc32:
+		return backend.GetStringFromPtr(c.CRC32)
+	case types.ChecksumAlgorithmCrc32c:
+		return backend.GetStringFromPtr(c.CRC32C)
+	case types.ChecksumAlgorithmSha1:
+		return backend.GetStringFromPtr(c.SHA1)
+	case types.ChecksumAlgorithmSha256:
+		return backend.GetStringFromPtr(c.SHA256)
+	case types.ChecksumAlgorithmCrc64nvme:
+		return backend.GetStringFromPtr(c.CRC64NVME)
+	default:
+		return ""
+	}
+}
+
+// newChecksum returns a checksum with the value of one algorithm set, or
+// none if sum is empty
+func newChecksum(algo types.ChecksumAlgorithm, sum string) s3response.Checksum {
+	checksum := s3response.Checksum{Algorithm: algo}
+	if sum == "" {
+		return checksum
+	}
+
+	switch algo {
+	case types.ChecksumAlgorithmCrc32:
+		checksum.CRC32 = &sum
+	case types.ChecksumAlgorithmCrc32c:
+		checksum.CRC32C = &sum
+	case types.ChecksumAlgorithmSha1:
+		checksum.SHA1 = &sum
+	case types.ChecksumAlgorithmSha256:
+		checksum.SHA256 = &sum
+	case types.ChecksumAlgorithmCrc64nvme:
+		checksum.CRC64NVME = &sum
+	}
+	return checksum
+}
+
+// completedPartChecksum returns the checksum of an algorithm given for a
+// part in a complete request
+func completedPartChecksum(algo types.ChecksumAlgorithm, part types.CompletedPart) string {
+	return checksumValue(s3response.Checksum{
+		CRC32:     part.ChecksumCRC32,
+		CRC32C:    part.ChecksumCRC32C,
+		SHA1:      part.ChecksumSHA1,
+		SHA256:    part.ChecksumSHA256,
+		CRC64NVME: part.ChecksumCRC64NVME,
+	}, algo)
+}
+
+// validatePartChecksum checks the checksums given for a part in a complete
+// request against the checksum stored when it was uploaded
+func validatePartChecksum(algo types.ChecksumAlgorithm, stored string, part types.CompletedPart) error {
+	var n int
+	for _, candidate := range checksumAlgorithms {
+		if completedPartChecksum(candidate, part) != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return s3err.GetAPIError(s3err.ErrInvalidChecksumPart)
+	}
+	if algo == "" {
+		if n != 0 {
+			return s3err.GetAPIError(s3err.ErrInvalidPart)
+		}
+		return nil
+	}
+	if n == 0 {
+		return s3err.APIError{
+			Code:           "InvalidRequest",
+			Description:    fmt.Sprintf("The upload was created using a %v checksum. The complete request must include the checksum for each part. It was missing for part %v in the request.", strings.ToLower(string(algo)), *part.PartNumber),
+			HTTPStatusCode: http.StatusBadRequest,
+		}
+	}
+
+	for _, candidate := range checksumAlgorithms {
+		checksum := completedPartChecksum(candidate, part)
+		if checksum == "" {
+			continue
+		}
+
+		if !utils.IsValidChecksum(checksum, candidate) {
+			return s3err.GetAPIError(s3err.ErrInvalidChecksumPart)
+		}
+
+		if candidate != algo {
+			return s3err.APIError{
+				Code:           "BadDigest",
+				Description:    fmt.Sprintf("The %v you specified for part %v did not match what we received.", strings.ToLower(string(candidate)), *part.PartNumber),
+				HTTPStatusCode: http.StatusBadRequest,
+			}
+		}
+		if checksum != stored {
+			return s3err.GetAPIError(s3err.ErrInvalidPart)
+		}
+	}
+
+	return nil
+}
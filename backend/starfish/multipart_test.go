@@ -0,0 +1,375 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/versity/versitygw/backend"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+// fakeMultipartServer stages uploads in memory like the file server. Only
+// CRC32 checksums are supported.
+type fakeMultipartServer struct {
+	uploads   map[string]*stagedUpload
+	data      map[string]map[int][]byte
+	files     map[string][]byte
+	assembled []assembleRequest
+}
+
+func crc32Checksum(data []byte) string {
+	sum := crc32.ChecksumIEEE(data)
+	return base64.StdEncoding.EncodeToString([]byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+}
+
+func (f *fakeMultipartServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Has("uploads") {
+		var metadata uploadMetadata
+		json.NewDecoder(r.Body).Decode(&metadata)
+		upload := &stagedUpload{
+			UploadID: fmt.Sprintf("upload-%d", len(f.uploads)+1),
+			Path:     r.URL.Path,
+			Metadata: metadata,
+		}
+		f.uploads[upload.UploadID] = upload
+		f.data[upload.UploadID] = make(map[int][]byte)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(upload)
+		return
+	}
+
+	upload, ok := f.uploads[query.Get("uploadId")]
+	if !ok || upload.Path != r.URL.Path {
+		http.Error(w, "NoSuchUpload", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(upload)
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if expected := r.Header.Get("X-Checksum"); expected != "" && expected != crc32Checksum(data) {
+			http.Error(w, "BadDigest", http.StatusBadRequest)
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		part := stagedPart{
+			PartNumber: partNumber,
+			Size:       int64(len(data)),
+			ETag:       fmt.Sprintf("\"%x\"", md5.Sum(data)),
+		}
+		if r.Header.Get("X-Checksum-Algorithm") != "" {
+			part.Checksum = crc32Checksum(data)
+		}
+		f.data[upload.UploadID][partNumber] = data
+		parts := []stagedPart{part}
+		for _, p := range upload.Parts {
+			if p.PartNumber != partNumber {
+				parts = append(parts, p)
+			}
+		}
+		sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+		upload.Parts = parts
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(part)
+	case http.MethodPost:
+		var req assembleRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.assembled = append(f.assembled, req)
+		var file []byte
+		for _, partNumber := range req.Parts {
+			file = append(file, f.data[upload.UploadID][partNumber]...)
+		}
+		var resp assembleResponse
+		if req.ChecksumAlgorithm != "" {
+			resp.Checksum = crc32Checksum(file)
+			if req.Checksum != "" && req.Checksum != resp.Checksum {
+				http.Error(w, "BadDigest", http.StatusBadRequest)
+				return
+			}
+		}
+		f.files[r.URL.Path] = file
+		delete(f.uploads, upload.UploadID)
+		resp.Size = int64(len(file))
+		json.NewEncoder(w).Encode(resp)
+	case http.MethodDelete:
+		delete(f.uploads, upload.UploadID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newMultipartBackend(t *testing.T) (*StarfishBackend, *fakeMultipartServer, *[]tagRequest) {
+	t.Helper()
+
+	fileServer := &fakeMultipartServer{
+		uploads: make(map[string]*stagedUpload),
+		data:    make(map[string]map[int][]byte),
+		files:   make(map[string][]byte),
+	}
+	fs := newTestServer(fileServer.ServeHTTP)
+	t.Cleanup(fs.Close)
+
+	var tagged []tagRequest
+	api := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		var req tagRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		tagged = append(tagged, req)
+	})
+	t.Cleanup(api.Close)
+
+	b, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:   api.URL,
+		BearerToken:   "test-token",
+		FileServerURL: fs.URL,
+		WriteConfig: &WriteConfig{
+			Collections: map[string]WriteTarget{
+				"test-bucket": {Volume: "vol1", Path: "uploads", Writable: true},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	b.AddCollection("test-bucket", "Collections:TestCollection")
+
+	return b, fileServer, &tagged
+}
+
+func uploadParts(t *testing.T, b *StarfishBackend, key, uploadID string, algo types.ChecksumAlgorithm, parts ...[]byte) []types.CompletedPart {
+	t.Helper()
+
+	var completed []types.CompletedPart
+	for i, data := range parts {
+		input := &s3.UploadPartInput{
+			Bucket:        aws.String("test-bucket"),
+			Key:           &key,
+			UploadId:      &uploadID,
+			PartNumber:    aws.Int32(int32(i + 1)),
+			Body:          bytes.NewReader(data),
+			ContentLength: aws.Int64(int64(len(data))),
+		}
+		if algo != "" {
+			input.ChecksumCRC32 = aws.String(crc32Checksum(data))
+		}
+		out, err := b.UploadPart(context.Background(), input)
+		if err != nil {
+			t.Fatalf("UploadPart %d failed: %v", i+1, err)
+		}
+		completed = append(completed, types.CompletedPart{
+			PartNumber:    input.PartNumber,
+			ETag:          out.ETag,
+			ChecksumCRC32: out.ChecksumCRC32,
+		})
+	}
+	return completed
+}
+
+func TestMultipartUpload(t *testing.T) {
+	b, fileServer, tagged := newMultipartBackend(t)
+	ctx := context.Background()
+	bucket, key := "test-bucket", "uploads/big.bin"
+
+	mp, err := b.CreateMultipartUpload(ctx, s3response.CreateMultipartUploadInput{
+		Bucket:            &bucket,
+		Key:               &key,
+		ChecksumAlgorithm: types.ChecksumAlgorithmCrc32,
+		ChecksumType:      types.ChecksumTypeFullObject,
+	})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+
+	part1 := bytes.Repeat([]byte("a"), backend.MinPartSize)
+	part2 := []byte("tail")
+	parts := uploadParts(t, b, key, mp.UploadId, types.ChecksumAlgorithmCrc32, part1, part2)
+
+	// A part without the checksum of the upload is refused
+	_, err = b.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket: &bucket, Key: &key, UploadId: &mp.UploadId, PartNumber: aws.Int32(3),
+		Body: strings.NewReader("x"),
+	})
+	if !errors.Is(err, s3err.GetChecksumTypeMismatchErr(types.ChecksumAlgorithmCrc32, "null")) {
+		t.Errorf("expected checksum type mismatch, got %v", err)
+	}
+
+	// A part whose checksum does not match is refused
+	_, err = b.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket: &bucket, Key: &key, UploadId: &mp.UploadId, PartNumber: aws.Int32(3),
+		Body: strings.NewReader("x"), ChecksumCRC32: aws.String(crc32Checksum([]byte("y"))),
+	})
+	if !errors.Is(err, s3err.GetChecksumBadDigestErr(types.ChecksumAlgorithmCrc32)) {
+		t.Errorf("expected BadDigest, got %v", err)
+	}
+
+	list, err := b.ListParts(ctx, &s3.ListPartsInput{Bucket: &bucket, Key: &key, UploadId: &mp.UploadId, MaxParts: aws.Int32(1)})
+	if err != nil {
+		t.Fatalf("ListParts failed: %v", err)
+	}
+	if len(list.Parts) != 1 || !list.IsTruncated || list.NextPartNumberMarker != 1 || list.ChecksumType != types.ChecksumTypeFullObject {
+		t.Errorf("unexpected first page %+v", list)
+	}
+	list, err = b.ListParts(ctx, &s3.ListPartsInput{Bucket: &bucket, Key: &key, UploadId: &mp.UploadId, PartNumberMarker: aws.String("1")})
+	if err != nil {
+		t.Fatalf("ListParts failed: %v", err)
+	}
+	if len(list.Parts) != 1 || list.Parts[0].PartNumber != 2 || list.Parts[0].Size != 4 || *list.Parts[0].ChecksumCRC32 != crc32Checksum(part2) {
+		t.Errorf("unexpected second page %+v", list.Parts)
+	}
+
+	complete := func(parts []types.CompletedPart, checksum *string) (s3response.CompleteMultipartUploadResult, error) {
+		res, _, err := b.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          &bucket,
+			Key:             &key,
+			UploadId:        &mp.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+			ChecksumCRC32:   checksum,
+		})
+		return res, err
+	}
+
+	for _, tt := range []struct {
+		name  string
+		parts []types.CompletedPart
+		err   error
+	}{
+		{"order", []types.CompletedPart{parts[0], parts[0]}, s3err.GetAPIError(s3err.ErrInvalidPartOrder)},
+		{"too small", []types.CompletedPart{parts[1], {PartNumber: aws.Int32(3), ETag: parts[1].ETag, ChecksumCRC32: parts[1].ChecksumCRC32}}, s3err.GetAPIError(s3err.ErrEntityTooSmall)},
+		{"missing", []types.CompletedPart{parts[0], {PartNumber: aws.Int32(5), ETag: parts[1].ETag, ChecksumCRC32: parts[1].ChecksumCRC32}}, s3err.GetAPIError(s3err.ErrInvalidPart)},
+		{"etag", []types.CompletedPart{parts[0], {PartNumber: aws.Int32(2), ETag: parts[0].ETag, ChecksumCRC32: parts[1].ChecksumCRC32}}, s3err.GetAPIError(s3err.ErrInvalidPart)},
+		{"checksum", []types.CompletedPart{parts[0], {PartNumber: aws.Int32(2), ETag: parts[1].ETag, ChecksumCRC32: parts[0].ChecksumCRC32}}, s3err.GetAPIError(s3err.ErrInvalidPart)},
+	} {
+		if _, err := complete(tt.parts, nil); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+	if len(fileServer.assembled) != 0 {
+		t.Fatalf("expected invalid uploads not to be assembled, got %v", fileServer.assembled)
+	}
+
+	if _, err := complete(parts, aws.String(crc32Checksum([]byte("other")))); !errors.Is(err, s3err.GetChecksumBadDigestErr(types.ChecksumAlgorithmCrc32)) {
+		t.Errorf("expected BadDigest for the full object checksum, got %v", err)
+	}
+
+	whole := append(append([]byte{}, part1...), part2...)
+	res, err := complete(parts, aws.String(crc32Checksum(whole)))
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload failed: %v", err)
+	}
+	if *res.ETag != backend.GetMultipartMD5(parts) {
+		t.Errorf("expected multipart ETag, got %s", *res.ETag)
+	}
+	if *res.ChecksumCRC32 != crc32Checksum(whole) || *res.ChecksumType != types.ChecksumTypeFullObject {
+		t.Errorf("unexpected checksum %v %v", *res.ChecksumCRC32, *res.ChecksumType)
+	}
+	if !bytes.Equal(fileServer.files["/vol1/uploads/big.bin"], whole) {
+		t.Error("expected the file to be assembled from the parts")
+	}
+	if len(*tagged) != 1 || (*tagged)[0].Paths[0] != "vol1:uploads/big.bin" {
+		t.Errorf("expected assembled file to be tagged, got %+v", *tagged)
+	}
+
+	if _, err := b.ListParts(ctx, &s3.ListPartsInput{Bucket: &bucket, Key: &key, UploadId: &mp.UploadId}); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchUpload)) {
+		t.Errorf("expected NoSuchUpload after complete, got %v", err)
+	}
+}
+
+func TestMultipartUploadCompositeChecksum(t *testing.T) {
+	b, fileServer, _ := newMultipartBackend(t)
+	ctx := context.Background()
+	bucket, key := "test-bucket", "uploads/composite.bin"
+
+	mp, err := b.CreateMultipartUpload(ctx, s3response.CreateMultipartUploadInput{
+		Bucket:            &bucket,
+		Key:               &key,
+		ChecksumAlgorithm: types.ChecksumAlgorithmCrc32,
+		ChecksumType:      types.ChecksumTypeComposite,
+	})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+
+	parts := uploadParts(t, b, key, mp.UploadId, types.ChecksumAlgorithmCrc32, []byte("only part"))
+
+	res, _, err := b.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &bucket,
+		Key:             &key,
+		UploadId:        &mp.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload failed: %v", err)
+	}
+	// The composite checksum is the checksum of the part checksums
+	partSum, _ := base64.StdEncoding.DecodeString(*parts[0].ChecksumCRC32)
+	if res.ChecksumCRC32 == nil || *res.ChecksumCRC32 != crc32Checksum(partSum) {
+		t.Errorf("expected composite checksum, got %v", res.ChecksumCRC32)
+	}
+	if fileServer.assembled[0].ChecksumAlgorithm != "" {
+		t.Errorf("expected composite checksum not to be computed by the file server, got %+v", fileServer.assembled[0])
+	}
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	b, _, _ := newMultipartBackend(t)
+	ctx := context.Background()
+	bucket, key := "test-bucket", "uploads/aborted.bin"
+
+	mp, err := b.CreateMultipartUpload(ctx, s3response.CreateMultipartUploadInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+	uploadParts(t, b, key, mp.UploadId, "", []byte("data"))
+
+	// Uploads belong to one key
+	other := "uploads/other.bin"
+	if err := b.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: &bucket, Key: &other, UploadId: &mp.UploadId}); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchUpload)) {
+		t.Errorf("expected NoSuchUpload for another key, got %v", err)
+	}
+
+	if err := b.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: &bucket, Key: &key, UploadId: &mp.UploadId}); err != nil {
+		t.Fatalf("AbortMultipartUpload failed: %v", err)
+	}
+	if err := b.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: &bucket, Key: &key, UploadId: &mp.UploadId}); !errors.Is(err, s3err.GetAPIError(s3err.ErrNoSuchUpload)) {
+		t.Errorf("expected NoSuchUpload after abort, got %v", err)
+	}
+
+	// Uploads are only staged in writable collections
+	readonly := "elsewhere/file.bin"
+	if _, err := b.CreateMultipartUpload(ctx, s3response.CreateMultipartUploadInput{Bucket: &bucket, Key: &readonly}); !errors.Is(err, s3err.GetAPIError(s3err.ErrAccessDenied)) {
+		t.Errorf("expected AccessDenied outside the writable path, got %v", err)
+	}
+}
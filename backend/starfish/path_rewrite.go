@@ -22,8 +22,11 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 )
@@ -36,9 +39,24 @@ type PathRewriteRule struct {
 	Priority int    `json:"priority"` // Higher numbers apply first
 }
 
-// PathRewriteConfig holds the configuration for path rewriting
+// PathRewriteConfig holds the configuration for path rewriting, and the
+// exclusion rules hiding files from buckets
 type PathRewriteConfig struct {
-	Rules []PathRewriteRule `json:"rules"`
+	Rules   []PathRewriteRule `json:"rules"`
+	Exclude []ExclusionRule   `json:"exclude,omitempty"`
+
+	compileOnce sync.Once
+	compiled    []compiledRule      // Rules compiled and sorted by priority
+	exclusions  []compiledExclusion // Exclude compiled
+}
+
+// compiledRule is a rewrite rule with its pattern and template compiled
+type compiledRule struct {
+	PathRewriteRule
+	index    int // position of the rule in the configuration
+	pattern  *regexp.Regexp
+	template *template.Template
+	err      error // why the rule could not be compiled
 }
 
 // TemplateData provides data and functions for template execution
@@ -51,6 +69,9 @@ type TemplateData struct {
 	SizeFormatted       string
 	// Original key for reference
 	OriginalKey string
+	// Capture groups of the rule pattern, by number ("0" is the whole
+	// match) and by name
+	Match map[string]string
 	// Method wrappers for template access
 	GetModifyTimeFormatted func(string) string
 	GetCreateTimeFormatted func(string) string
@@ -69,53 +90,482 @@ type TemplateData struct {
 	GetAllTags             func() []string
 }
 
+// rewriteConfig returns the current path rewrite configuration. The
+// configuration is replaced, never modified, when it is reloaded.
+func (b *StarfishBackend) rewriteConfig() *PathRewriteConfig {
+	b.rewriteMux.RLock()
+	defer b.rewriteMux.RUnlock()
+	return b.pathRewriteConfig
+}
+
+// ReloadConfig reloads the path rewrite configuration from its file. An
+// invalid file is rejected and the current rules are kept. Cached
+// listings and resolved keys are dropped as they hold keys rewritten with
+// the previous rules.
+func (b *StarfishBackend) ReloadConfig() error {
+	if b.pathRewriteConfigFile == "" {
+		return nil
+	}
+
+	config, err := LoadPathRewriteConfig(b.pathRewriteConfigFile)
+	if err != nil {
+		return fmt.Errorf("keeping the current path rewrite rules: %w", err)
+	}
+
+	b.rewriteMux.Lock()
+	b.pathRewriteConfig = config
+	b.rewriteMux.Unlock()
+
+	b.invalidateBucket("")
+	fmt.Printf("Reloaded path rewrite configuration from: %s\n", b.pathRewriteConfigFile)
+	return nil
+}
+
 // applyPathRewrite applies path rewriting rules to an object key
 func (b *StarfishBackend) applyPathRewrite(entry StarfishEntry, originalKey string, bucket string) string {
-	if b.pathRewriteConfig == nil || len(b.pathRewriteConfig.Rules) == 0 {
+	config := b.rewriteConfig()
+	if config == nil || len(config.Rules) == 0 {
 		return originalKey
 	}
 
-	// Sort rules by priority (highest first)
-	sortedRules := make([]PathRewriteRule, len(b.pathRewriteConfig.Rules))
-	copy(sortedRules, b.pathRewriteConfig.Rules)
-	sort.Slice(sortedRules, func(i, j int) bool {
-		return sortedRules[i].Priority > sortedRules[j].Priority
+	newKey, _, _ := config.rewrite(entry, originalKey, bucket)
+	return newKey
+}
+
+// rewrite applies the highest priority rule for the bucket whose pattern
+// matches the key. It returns the new key and the index of the rule, or
+// the original key and -1 if no rule applies. Rules whose template fails
+// are skipped and their errors returned.
+func (c *PathRewriteConfig) rewrite(entry StarfishEntry, originalKey, bucket string) (string, int, []RuleError) {
+	var ruleErrors []RuleError
+	for _, rule := range c.compiledRules() {
+		if rule.Bucket != "*" && rule.Bucket != bucket {
+			continue
+		}
+		matched, newKey, err := rule.apply(entry, originalKey)
+		if err != nil {
+			ruleErrors = append(ruleErrors, RuleError{Rule: rule.index, Err: err})
+			continue
+		}
+		if matched {
+			return newKey, rule.index, ruleErrors
+		}
+	}
+
+	return originalKey, -1, ruleErrors
+}
+
+// compiledRules returns the rules of the configuration compiled and
+// sorted by priority (highest first)
+func (c *PathRewriteConfig) compiledRules() []compiledRule {
+	c.compile()
+	return c.compiled
+}
+
+// compile compiles the rewrite and exclusion rules of the configuration.
+// Rules are compiled once, when the configuration is loaded or first used.
+func (c *PathRewriteConfig) compile() {
+	c.compileOnce.Do(func() {
+		c.compiled = make([]compiledRule, len(c.Rules))
+		for i, rule := range c.Rules {
+			c.compiled[i] = compileRule(i, rule)
+		}
+		sort.SliceStable(c.compiled, func(i, j int) bool {
+			return c.compiled[i].Priority > c.compiled[j].Priority
+		})
+
+		c.exclusions = make([]compiledExclusion, len(c.Exclude))
+		for i, rule := range c.Exclude {
+			c.exclusions[i] = compileExclusion(i, rule)
+		}
 	})
+}
+
+// compileRule compiles the pattern and template of a rule
+func compileRule(index int, rule PathRewriteRule) compiledRule {
+	compiled := compiledRule{PathRewriteRule: rule, index: index}
+
+	compiled.pattern, compiled.err = regexp.Compile(rule.Pattern)
+	if compiled.err != nil {
+		compiled.err = fmt.Errorf("invalid pattern: %w", compiled.err)
+		return compiled
+	}
+
+	compiled.template, compiled.err = parseTemplate(rule.Template)
+	if compiled.err != nil {
+		compiled.err = fmt.Errorf("invalid template: %w", compiled.err)
+	}
+	return compiled
+}
+
+// RuleError is the failure of a rewrite rule on an entry
+type RuleError struct {
+	Rule int // index of the rule in the configuration
+	Err  error
+}
+
+func (e RuleError) Error() string {
+	return fmt.Sprintf("rule %d: %v", e.Rule, e.Err)
+}
+
+// RewriteResult describes how the rewrite rules of a bucket treat a
+// Starfish entry
+type RewriteResult struct {
+	Entry        StarfishEntry
+	OriginalKey  string
+	Key          string
+	Rule         int         // index of the applied rule, -1 if the key was kept
+	Errors       []RuleError // rules skipped because their template failed
+	CollidesWith string      // original key of an earlier entry rewritten to the same key
+	Excluded     int         // index of the exclusion rule hiding the entry, -1 if it is visible
+}
+
+// Explain applies the rewrite rules of a bucket to entries as listings
+// would, reporting the rule applied to each entry, template errors and
+// entries whose keys collide. Entries hidden by an exclusion rule are
+// reported without a key.
+func (c *PathRewriteConfig) Explain(bucket string, entries []StarfishEntry) []RewriteResult {
+	results := make([]RewriteResult, 0, len(entries))
+	owners := make(map[string]string, len(entries))
+
+	var exclusions []compiledExclusion
+	if c != nil {
+		c.compile()
+		exclusions = c.exclusions
+	}
+
+	for _, entry := range entries {
+		trimEntryPaths(&entry)
+		result := RewriteResult{
+			Entry:       entry,
+			OriginalKey: originalObjectKey(entry),
+			Rule:        -1,
+			Excluded:    -1,
+		}
+		if i := slices.IndexFunc(exclusions, func(rule compiledExclusion) bool {
+			return (rule.Bucket == "*" || rule.Bucket == bucket) && rule.matches(entry)
+		}); i >= 0 {
+			result.Excluded = exclusions[i].index
+			results = append(results, result)
+			continue
+		}
 
-	for _, rule := range sortedRules {
+		result.Key = result.OriginalKey
+		if c != nil {
+			result.Key, result.Rule, result.Errors = c.rewrite(entry, result.OriginalKey, bucket)
+		}
+
+		if owner, ok := owners[result.Key]; ok {
+			result.CollidesWith = owner
+		} else {
+			owners[result.Key] = result.OriginalKey
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// hasPathRewriteRules reports whether any rewrite rule applies to the bucket
+func (b *StarfishBackend) hasPathRewriteRules(bucket string) bool {
+	config := b.rewriteConfig()
+	if config == nil {
+		return false
+	}
+
+	for _, rule := range config.Rules {
 		if rule.Bucket == "*" || rule.Bucket == bucket {
-			if matched, newKey := b.applyRule(entry, originalKey, rule); matched {
-				return newKey
-			}
+			return true
 		}
 	}
 
-	return originalKey
+	return false
 }
 
-// applyRule applies a single rewrite rule
-func (b *StarfishBackend) applyRule(entry StarfishEntry, originalKey string, rule PathRewriteRule) (bool, string) {
-	// Check regex pattern
-	re, err := regexp.Compile(rule.Pattern)
-	if err != nil {
-		return false, originalKey
+// originalKeyTemplate matches templates that render the original key
+// behind a fixed literal, the only form of template whose keys can be
+// mapped back to Starfish paths
+var originalKeyTemplate = regexp.MustCompile(`^([^{}]*)\{\{-?\s*\.OriginalKey\s*-?\}\}$`)
+
+// keyPrefix returns the literal the rule's template puts in front of the
+// original key, and false if the template renders anything else
+func (r PathRewriteRule) keyPrefix() (string, bool) {
+	m := originalKeyTemplate.FindStringSubmatch(strings.TrimSpace(r.Template))
+	if m == nil {
+		return "", false
+	}
+	// executeTemplate drops a leading slash from the result
+	return strings.TrimPrefix(m[1], "/"), true
+}
+
+// originalPrefixes returns the prefixes of Starfish paths whose keys may
+// start with prefix once the rewrite rules for the bucket are applied. It
+// returns false if a rule renders keys that cannot be mapped back to
+// Starfish paths, in which case any path may produce a matching key.
+func (b *StarfishBackend) originalPrefixes(bucket, prefix string) ([]string, bool) {
+	// Paths that no rule matches keep their original key
+	prefixes := []string{prefix}
+
+	for _, rule := range b.rewriteConfig().Rules {
+		if rule.Bucket != "*" && rule.Bucket != bucket {
+			continue
+		}
+
+		literal, ok := rule.keyPrefix()
+		if !ok {
+			return nil, false
+		}
+
+		switch {
+		case strings.HasPrefix(prefix, literal):
+			prefixes = append(prefixes, prefix[len(literal):])
+		case strings.HasPrefix(literal, prefix):
+			// Every key the rule renders starts with prefix
+			prefixes = append(prefixes, "")
+		}
+	}
+
+	return prefixes, true
+}
+
+// originalKeys returns the Starfish paths a rewritten key may have been
+// built from. It returns false if a rule for the bucket renders keys that
+// cannot be mapped back to Starfish paths.
+func (b *StarfishBackend) originalKeys(bucket, key string) ([]string, bool) {
+	// Paths that no rule matches keep their original key
+	keys := []string{key}
+
+	for _, rule := range b.rewriteConfig().Rules {
+		if rule.Bucket != "*" && rule.Bucket != bucket {
+			continue
+		}
+
+		literal, ok := rule.keyPrefix()
+		if !ok {
+			return nil, false
+		}
+		if strings.HasPrefix(key, literal) && len(key) > len(literal) {
+			keys = append(keys, key[len(literal):])
+		}
+	}
+
+	return keys, true
+}
+
+// apply applies the rule to a key, reporting whether its pattern matched
+func (r *compiledRule) apply(entry StarfishEntry, originalKey string) (bool, string, error) {
+	if r.err != nil {
+		return false, originalKey, r.err
+	}
+
+	groups := r.pattern.FindStringSubmatch(originalKey)
+	if groups == nil {
+		return false, originalKey, nil
 	}
 
-	if !re.MatchString(originalKey) {
-		return false, originalKey
+	// Capture groups are available to the template as .Match
+	match := make(map[string]string, len(groups))
+	for i, name := range r.pattern.SubexpNames() {
+		match[strconv.Itoa(i)] = groups[i]
+		if name != "" {
+			match[name] = groups[i]
+		}
 	}
 
-	// Apply template
-	newKey, err := b.executeTemplate(entry, rule.Template, originalKey)
+	newKey, err := renderTemplate(r.template, entry, originalKey, match)
 	if err != nil {
-		return false, originalKey
+		return false, originalKey, err
 	}
 
-	return true, newKey
+	return true, newKey, nil
+}
+
+// templateFuncs are the functions available to rewrite templates
+var templateFuncs = template.FuncMap{
+	// String manipulation
+	"join":       strings.Join,
+	"split":      strings.Split,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"title":      strings.Title,
+	"trim":       strings.TrimSpace,
+	"trimLeft":   strings.TrimLeft,
+	"trimRight":  strings.TrimRight,
+	"replace":    strings.Replace,
+	"replaceAll": strings.ReplaceAll,
+	"hasPrefix":  strings.HasPrefix,
+	"hasSuffix":  strings.HasSuffix,
+	"contains":   strings.Contains,
+
+	// Path manipulation
+	"ext":      filepath.Ext,
+	"base":     filepath.Base,
+	"dir":      filepath.Dir,
+	"clean":    filepath.Clean,
+	"joinPath": filepath.Join,
+
+	// Time formatting
+	"formatTime": func(t time.Time, layout string) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(layout)
+	},
+	"formatUnix": func(unixTime int64, layout string) string {
+		if unixTime <= 0 {
+			return ""
+		}
+		return time.Unix(unixTime, 0).Format(layout)
+	},
+
+	// Size formatting
+	"formatSize": func(size int64, unit string) string {
+		return formatSizeWithUnit(size, unit)
+	},
+
+	// Entry-specific functions
+	"getModifyTimeFormatted": func(entry StarfishEntry, layout string) string {
+		return entry.GetModifyTimeFormatted(layout)
+	},
+	"getCreateTimeFormatted": func(entry StarfishEntry, layout string) string {
+		return entry.GetCreateTimeFormatted(layout)
+	},
+	"getAccessTimeFormatted": func(entry StarfishEntry, layout string) string {
+		return entry.GetAccessTimeFormatted(layout)
+	},
+	"getSizeFormatted": func(entry StarfishEntry, unit string) string {
+		return entry.GetSizeFormatted(unit)
+	},
+	"getFilenameWithoutExt": func(entry StarfishEntry) string {
+		return entry.GetFilenameWithoutExt()
+	},
+	"getExtension": func(entry StarfishEntry) string {
+		return entry.GetExtension()
+	},
+	"getParentDir": func(entry StarfishEntry) string {
+		return entry.GetParentDir()
+	},
+	"getVolumeName": func(entry StarfishEntry) string {
+		return entry.GetVolumeName()
+	},
+	"getUIDString": func(entry StarfishEntry) string {
+		return entry.GetUIDString()
+	},
+	"getGIDString": func(entry StarfishEntry) string {
+		return entry.GetGIDString()
+	},
+	"getSizeString": func(entry StarfishEntry) string {
+		return entry.GetSizeString()
+	},
+	"getInodeString": func(entry StarfishEntry) string {
+		return entry.GetInodeString()
+	},
+	"getTagsExplicit": func(entry StarfishEntry) []string {
+		return entry.GetTagsExplicit()
+	},
+	"getTagsInherited": func(entry StarfishEntry) []string {
+		return entry.GetTagsInherited()
+	},
+	"getAllTags": func(entry StarfishEntry) []string {
+		return entry.GetAllTags()
+	},
+
+	// Array/slice operations
+	"first": func(slice []string) string {
+		if len(slice) > 0 {
+			return slice[0]
+		}
+		return ""
+	},
+	"last": func(slice []string) string {
+		if len(slice) > 0 {
+			return slice[len(slice)-1]
+		}
+		return ""
+	},
+	"index": func(collection interface{}, key interface{}) string {
+		switch c := collection.(type) {
+		case []string:
+			if i, ok := key.(int); ok && i >= 0 && i < len(c) {
+				return c[i]
+			}
+		case map[string]string:
+			// Capture groups of .Match by number or name
+			return c[fmt.Sprint(key)]
+		}
+		return ""
+	},
+	"length": func(slice []string) int {
+		return len(slice)
+	},
+
+	// Conditional operations
+	"if": func(condition bool, trueVal, falseVal string) string {
+		if condition {
+			return trueVal
+		}
+		return falseVal
+	},
+	"default": func(value, defaultValue string) string {
+		if value == "" {
+			return defaultValue
+		}
+		return value
+	},
+
+	// Mathematical operations
+	"add": func(a, b int64) int64 {
+		return a + b
+	},
+	"sub": func(a, b int64) int64 {
+		return a - b
+	},
+	"mul": func(a, b int64) int64 {
+		return a * b
+	},
+	"div": func(a, b int64) int64 {
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	},
+
+	// Type conversions
+	"toString": func(v interface{}) string {
+		return fmt.Sprintf("%v", v)
+	},
+	"toInt": func(v interface{}) int64 {
+		switch val := v.(type) {
+		case int64:
+			return val
+		case int:
+			return int64(val)
+		case string:
+			var result int64
+			fmt.Sscanf(val, "%d", &result)
+			return result
+		default:
+			return 0
+		}
+	},
 }
 
 // executeTemplate executes a Go template with the entry data
-func (b *StarfishBackend) executeTemplate(entry StarfishEntry, templateStr string, originalKey string) (string, error) {
+func executeTemplate(entry StarfishEntry, templateStr string, originalKey string) (string, error) {
+	tmpl, err := parseTemplate(templateStr)
+	if err != nil {
+		return "", fmt.Errorf("template parse error: %w", err)
+	}
+	return renderTemplate(tmpl, entry, originalKey, nil)
+}
+
+// parseTemplate parses a rewrite template with the rewrite functions
+func parseTemplate(templateStr string) (*template.Template, error) {
+	return template.New("path").Funcs(templateFuncs).Parse(templateStr)
+}
+
+// renderTemplate executes a parsed rewrite template for an entry
+func renderTemplate(tmpl *template.Template, entry StarfishEntry, originalKey string, match map[string]string) (string, error) {
 	// Create template data with computed fields
 	data := TemplateData{
 		Entry:               entry,
@@ -124,174 +574,7 @@ func (b *StarfishBackend) executeTemplate(entry StarfishEntry, templateStr strin
 		AccessTimeFormatted: entry.GetAccessTime().Format("2006/01/02"),
 		SizeFormatted:       formatSize(entry.Size),
 		OriginalKey:         originalKey,
-	}
-
-	// Create template with custom functions
-	tmpl, err := template.New("path").Funcs(template.FuncMap{
-		// String manipulation
-		"join":       strings.Join,
-		"split":      strings.Split,
-		"lower":      strings.ToLower,
-		"upper":      strings.ToUpper,
-		"title":      strings.Title,
-		"trim":       strings.TrimSpace,
-		"trimLeft":   strings.TrimLeft,
-		"trimRight":  strings.TrimRight,
-		"replace":    strings.Replace,
-		"replaceAll": strings.ReplaceAll,
-		"hasPrefix":  strings.HasPrefix,
-		"hasSuffix":  strings.HasSuffix,
-		"contains":   strings.Contains,
-
-		// Path manipulation
-		"ext":      filepath.Ext,
-		"base":     filepath.Base,
-		"dir":      filepath.Dir,
-		"clean":    filepath.Clean,
-		"joinPath": filepath.Join,
-
-		// Time formatting
-		"formatTime": func(t time.Time, layout string) string {
-			if t.IsZero() {
-				return ""
-			}
-			return t.Format(layout)
-		},
-		"formatUnix": func(unixTime int64, layout string) string {
-			if unixTime <= 0 {
-				return ""
-			}
-			return time.Unix(unixTime, 0).Format(layout)
-		},
-
-		// Size formatting
-		"formatSize": func(size int64, unit string) string {
-			return formatSizeWithUnit(size, unit)
-		},
-
-		// Entry-specific functions
-		"getModifyTimeFormatted": func(entry StarfishEntry, layout string) string {
-			return entry.GetModifyTimeFormatted(layout)
-		},
-		"getCreateTimeFormatted": func(entry StarfishEntry, layout string) string {
-			return entry.GetCreateTimeFormatted(layout)
-		},
-		"getAccessTimeFormatted": func(entry StarfishEntry, layout string) string {
-			return entry.GetAccessTimeFormatted(layout)
-		},
-		"getSizeFormatted": func(entry StarfishEntry, unit string) string {
-			return entry.GetSizeFormatted(unit)
-		},
-		"getFilenameWithoutExt": func(entry StarfishEntry) string {
-			return entry.GetFilenameWithoutExt()
-		},
-		"getExtension": func(entry StarfishEntry) string {
-			return entry.GetExtension()
-		},
-		"getParentDir": func(entry StarfishEntry) string {
-			return entry.GetParentDir()
-		},
-		"getVolumeName": func(entry StarfishEntry) string {
-			return entry.GetVolumeName()
-		},
-		"getUIDString": func(entry StarfishEntry) string {
-			return entry.GetUIDString()
-		},
-		"getGIDString": func(entry StarfishEntry) string {
-			return entry.GetGIDString()
-		},
-		"getSizeString": func(entry StarfishEntry) string {
-			return entry.GetSizeString()
-		},
-		"getInodeString": func(entry StarfishEntry) string {
-			return entry.GetInodeString()
-		},
-		"getTagsExplicit": func(entry StarfishEntry) []string {
-			return entry.GetTagsExplicit()
-		},
-		"getTagsInherited": func(entry StarfishEntry) []string {
-			return entry.GetTagsInherited()
-		},
-		"getAllTags": func(entry StarfishEntry) []string {
-			return entry.GetAllTags()
-		},
-
-		// Array/slice operations
-		"first": func(slice []string) string {
-			if len(slice) > 0 {
-				return slice[0]
-			}
-			return ""
-		},
-		"last": func(slice []string) string {
-			if len(slice) > 0 {
-				return slice[len(slice)-1]
-			}
-			return ""
-		},
-		"index": func(slice []string, i int) string {
-			if i >= 0 && i < len(slice) {
-				return slice[i]
-			}
-			return ""
-		},
-		"length": func(slice []string) int {
-			return len(slice)
-		},
-
-		// Conditional operations
-		"if": func(condition bool, trueVal, falseVal string) string {
-			if condition {
-				return trueVal
-			}
-			return falseVal
-		},
-		"default": func(value, defaultValue string) string {
-			if value == "" {
-				return defaultValue
-			}
-			return value
-		},
-
-		// Mathematical operations
-		"add": func(a, b int64) int64 {
-			return a + b
-		},
-		"sub": func(a, b int64) int64 {
-			return a - b
-		},
-		"mul": func(a, b int64) int64 {
-			return a * b
-		},
-		"div": func(a, b int64) int64 {
-			if b == 0 {
-				return 0
-			}
-			return a / b
-		},
-
-		// Type conversions
-		"toString": func(v interface{}) string {
-			return fmt.Sprintf("%v", v)
-		},
-		"toInt": func(v interface{}) int64 {
-			switch val := v.(type) {
-			case int64:
-				return val
-			case int:
-				return int64(val)
-			case string:
-				var result int64
-				fmt.Sscanf(val, "%d", &result)
-				return result
-			default:
-				return 0
-			}
-		},
-	}).Parse(templateStr)
-
-	if err != nil {
-		return "", fmt.Errorf("template parse error: %w", err)
+		Match:               match,
 	}
 
 	// Execute template
@@ -18,6 +18,12 @@
 package starfish
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -84,8 +90,6 @@ func TestPathRewrite(t *testing.T) {
 }
 
 func TestTemplateFunctions(t *testing.T) {
-	backend := &StarfishBackend{}
-
 	testTime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
 	entry := StarfishEntry{
 		Filename:        "document.pdf",
@@ -133,7 +137,7 @@ func TestTemplateFunctions(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		result, err := backend.executeTemplate(entry, test.template, "original/path")
+		result, err := executeTemplate(entry, test.template, "original/path")
 		if err != nil {
 			t.Errorf("Test %d: Template execution failed: %v", i, err)
 			continue
@@ -176,6 +180,77 @@ func TestPathRewriteConfigValidation(t *testing.T) {
 	if err := validatePathRewriteConfig(invalidConfig); err == nil {
 		t.Error("Invalid config should error")
 	}
+
+	// Test invalid pattern and template
+	for _, rule := range []PathRewriteRule{
+		{Bucket: "*", Pattern: "^(.*$", Template: "{{.OriginalKey}}"},
+		{Bucket: "*", Pattern: "^(.*)$", Template: "{{.OriginalKey"},
+		{Bucket: "*", Pattern: "^(.*)$", Template: "{{noSuchFunc .OriginalKey}}"},
+	} {
+		if err := validatePathRewriteConfig(&PathRewriteConfig{Rules: []PathRewriteRule{rule}}); err == nil {
+			t.Errorf("Invalid rule %+v should error", rule)
+		}
+	}
+}
+
+func TestReloadPathRewriteConfig(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]StarfishEntry{{Filename: "file.txt", ParentPath: "dir", Size: 1, Volume: "vol"}})
+	})
+	defer server.Close()
+
+	configFile := filepath.Join(t.TempDir(), "rewrite.json")
+	writeRules := func(template string) {
+		config := &PathRewriteConfig{Rules: []PathRewriteRule{{Bucket: "*", Pattern: "^(.*)$", Template: template}}}
+		if err := SavePathRewriteConfig(config, configFile); err != nil {
+			t.Fatalf("failed to save config: %v", err)
+		}
+	}
+	listKeys := func(backend *StarfishBackend) string {
+		res, err := listTestBucket(context.Background(), backend)
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		var keys []string
+		for _, obj := range res.Contents {
+			keys = append(keys, *obj.Key)
+		}
+		return strings.Join(keys, ",")
+	}
+
+	writeRules("old/{{.OriginalKey}}")
+	config, err := LoadPathRewriteConfig(configFile)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{
+		PathRewriteConfig:     config,
+		PathRewriteConfigFile: configFile,
+	})
+
+	if keys := listKeys(backend); keys != "old/dir/file.txt" {
+		t.Fatalf("expected old/dir/file.txt, got %q", keys)
+	}
+
+	// Reloaded rules apply at once, not after cached listings expire
+	writeRules("new/{{.OriginalKey}}")
+	if err := backend.ReloadConfig(); err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+	if keys := listKeys(backend); keys != "new/dir/file.txt" {
+		t.Errorf("expected new/dir/file.txt after reload, got %q", keys)
+	}
+
+	// An invalid file is rejected and the current rules are kept
+	if err := os.WriteFile(configFile, []byte(`{"rules": [{"bucket": "*", "pattern": "(", "template": "x"}]}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if err := backend.ReloadConfig(); err == nil {
+		t.Error("expected an invalid config to be rejected")
+	}
+	if keys := listKeys(backend); keys != "new/dir/file.txt" {
+		t.Errorf("expected the current rules to be kept, got %q", keys)
+	}
 }
 
 func TestFormatSize(t *testing.T) {
@@ -201,3 +276,112 @@ func TestFormatSize(t *testing.T) {
 		}
 	}
 }
+
+func TestExplainPathRewrite(t *testing.T) {
+	config := &PathRewriteConfig{
+		Rules: []PathRewriteRule{
+			{Bucket: "*", Pattern: `\.pdf$`, Template: "docs/{{.Entry.Filename}}", Priority: 10},
+			{Bucket: "archive", Pattern: "^(.*)$", Template: "{{formatTime .Entry.Filename \"2006\"}}", Priority: 20},
+		},
+	}
+	entries := []StarfishEntry{
+		{Filename: "a.pdf", ParentPath: "/x", Volume: "vol"},
+		{Filename: "a.pdf", ParentPath: "/y", Volume: "vol"},
+		{Filename: "b.txt", ParentPath: "/x", Volume: "vol"},
+	}
+
+	results := config.Explain("archive", entries)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	first := results[0]
+	if first.OriginalKey != "x/a.pdf" || first.Key != "docs/a.pdf" || first.Rule != 0 || first.CollidesWith != "" {
+		t.Errorf("unexpected result for the first entry: %+v", first)
+	}
+	if len(first.Errors) != 1 || first.Errors[0].Rule != 1 {
+		t.Errorf("expected the failing archive template to be reported, got %v", first.Errors)
+	}
+
+	if results[1].Key != "docs/a.pdf" || results[1].CollidesWith != "x/a.pdf" {
+		t.Errorf("expected y/a.pdf to collide with x/a.pdf, got %+v", results[1])
+	}
+
+	if results[2].Key != "x/b.txt" || results[2].Rule != -1 {
+		t.Errorf("expected x/b.txt to keep its key, got %+v", results[2])
+	}
+
+	// Rules for other buckets are not applied
+	if results := config.Explain("other", entries[2:]); len(results[0].Errors) != 0 {
+		t.Errorf("expected no errors from rules of other buckets, got %v", results[0].Errors)
+	}
+}
+
+func TestPathRewriteCaptureGroups(t *testing.T) {
+	backend := &StarfishBackend{
+		pathRewriteConfig: &PathRewriteConfig{
+			Rules: []PathRewriteRule{
+				{
+					Bucket:   "*",
+					Pattern:  `^projects/(?P<proj>[^/]+)/raw/(.*)$`,
+					Template: "{{.Match.proj}}/{{index .Match 2}}",
+					Priority: 100,
+				},
+				{
+					Bucket:   "*",
+					Pattern:  `^(scratch)(/tmp)?/(.*)$`,
+					Template: "{{index .Match 1}}{{index .Match 2}}-{{index .Match \"3\"}}",
+					Priority: 50,
+				},
+			},
+		},
+	}
+	entry := StarfishEntry{Filename: "scan.tif", Volume: "storage1"}
+
+	tests := []struct {
+		key, expected string
+	}{
+		{"projects/alpha/raw/2024/scan.tif", "alpha/2024/scan.tif"},
+		{"scratch/scan.tif", "scratch-scan.tif"},
+		{"scratch/tmp/scan.tif", "scratch/tmp-scan.tif"},
+		{"other/scan.tif", "other/scan.tif"},
+	}
+	for _, tt := range tests {
+		if result := backend.applyPathRewrite(entry, tt.key, "bucket"); result != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.key, tt.expected, result)
+		}
+	}
+}
+
+func TestPathRewriteRulesCompiledOnce(t *testing.T) {
+	config := &PathRewriteConfig{
+		Rules: []PathRewriteRule{
+			{Bucket: "*", Pattern: "^a", Template: "low/{{.OriginalKey}}", Priority: 1},
+			{Bucket: "*", Pattern: "(", Template: "bad", Priority: 5},
+			{Bucket: "*", Pattern: "^a", Template: "high/{{.OriginalKey}}", Priority: 10},
+		},
+	}
+
+	rules := config.compiledRules()
+	if len(rules) != 3 || rules[0].index != 2 || rules[1].index != 1 || rules[2].index != 0 {
+		t.Fatalf("expected rules sorted by priority, got %+v", rules)
+	}
+	if rules[0].pattern == nil || rules[0].template == nil {
+		t.Error("expected the pattern and template to be compiled")
+	}
+	if &config.compiledRules()[0] != &rules[0] {
+		t.Error("expected rules to be compiled only once")
+	}
+
+	// Rules that do not compile are skipped and reported
+	key, rule, ruleErrors := config.rewrite(StarfishEntry{}, "abc", "bucket")
+	if key != "high/abc" || rule != 2 {
+		t.Errorf("expected the highest priority rule to apply, got %s from rule %d", key, rule)
+	}
+	if ruleErrors != nil {
+		t.Errorf("expected rules after the match not to run, got %v", ruleErrors)
+	}
+	if _, _, ruleErrors := config.rewrite(StarfishEntry{}, "xyz", "bucket"); len(ruleErrors) != 1 || ruleErrors[0].Rule != 1 {
+		t.Errorf("expected the invalid rule to be reported, got %v", ruleErrors)
+	}
+}
@@ -24,30 +24,106 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
-// QueryStarfish executes a query against the Starfish API using Collections: tagset tags
+// QueryStarfish executes a query against the Starfish API for the files of a
+// bucket and returns the first page of results
 func (b *StarfishBackend) QueryStarfish(ctx context.Context, bucket, volumeAndPath, additionalQuery string) (*StarfishQueryResponse, error) {
-	// Get the Collections: tag for this bucket
+	return b.QueryStarfishPage(ctx, bucket, volumeAndPath, additionalQuery, 0)
+}
+
+// QueryStarfishPage executes a query against the Starfish API and returns up to
+// one page of results starting at offset in the query sort order
+func (b *StarfishBackend) QueryStarfishPage(ctx context.Context, bucket, volumeAndPath, additionalQuery string, offset int) (*StarfishQueryResponse, error) {
+	var entries []StarfishEntry
+	_, err := b.WalkStarfishPage(ctx, bucket, volumeAndPath, additionalQuery, offset, func(entry StarfishEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to our response format
+	result := &StarfishQueryResponse{
+		Entries: entries,
+		Total:   len(entries),
+	}
+
+	// Debug output
+	fmt.Printf("DEBUG: QueryStarfish returned %d entries\n", len(entries))
+
+	return result, nil
+}
+
+// WalkStarfishPage executes a query against the Starfish API and calls fn
+// for each entry of up to one page of results starting at offset, as the
+// entries are decoded from the response. The response is never held in
+// memory as a whole, and returning false from fn stops reading it. It
+// returns the number of entries passed to fn.
+func (b *StarfishBackend) WalkStarfishPage(ctx context.Context, bucket, volumeAndPath, additionalQuery string, offset int, fn func(StarfishEntry) bool) (int, error) {
+	// Get the tag, zone or volume of this bucket, or the query of a
+	// virtual bucket
 	collectionTag, exists := b.GetCollectionTag(bucket)
 	if !exists {
-		return nil, fmt.Errorf("no Collections: tag found for bucket: %s", bucket)
+		return 0, fmt.Errorf("no %s found for bucket: %s", b.bucketSource, bucket)
 	}
+	_, virtual := b.virtualBuckets[bucket]
 
-	// Build the query URL using the Collections: tag and volume path
-	queryURL, err := b.buildQueryURL(collectionTag, volumeAndPath, additionalQuery)
+	// Build the query URL using the bucket filter and volume path
+	queryURL, err := b.buildQueryURL(collectionTag, virtual, volumeAndPath, additionalQuery, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build query URL: %w", err)
+		return 0, fmt.Errorf("failed to build query URL: %w", err)
 	}
 
 	// Debug output
 	fmt.Printf("DEBUG: QueryStarfish URL: %s\n", queryURL)
 
+	// Fail fast while Starfish is known to be down instead of piling up
+	// requests on it
+	if !b.breaker.allow() {
+		return 0, &StarfishError{
+			Code:    "CIRCUIT_OPEN",
+			Message: "Starfish API is unavailable, circuit breaker is open",
+		}
+	}
+
+	n, err := b.queryWithRetry(ctx, queryURL, fn)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			// The client gave up, which says nothing about Starfish
+			b.breaker.abandon()
+		case isStarfishUnavailable(err):
+			b.breaker.failure()
+		default:
+			b.breaker.success()
+		}
+		return n, err
+	}
+	b.breaker.success()
+
+	return n, nil
+}
+
+// trimEntryPaths makes the paths of an entry relative to the volume root.
+// Starfish paths are used without a leading slash, both in queries and in
+// the entries handed to the backend.
+func trimEntryPaths(entry *StarfishEntry) {
+	entry.ParentPath = strings.Trim(entry.ParentPath, "/")
+	entry.FullPath = strings.TrimPrefix(entry.FullPath, "/")
+}
+
+// queryOnce sends a single query request to Starfish and calls fn for each
+// returned entry as it is decoded, until fn returns false. It returns the
+// number of entries passed to fn.
+func (b *StarfishBackend) queryOnce(ctx context.Context, queryURL string, fn func(StarfishEntry) bool) (int, error) {
 	// Create HTTP request
 	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
 	if err != nil {
-		return nil, &StarfishError{
+		return 0, &StarfishError{
 			Code:    "REQUEST_CREATION_FAILED",
 			Message: "Failed to create HTTP request",
 			Err:     err,
@@ -62,8 +138,10 @@ func (b *StarfishBackend) QueryStarfish(ctx context.Context, bucket, volumeAndPa
 	fmt.Printf("DEBUG: Making HTTP request to Starfish API...\n")
 	resp, err := b.httpClient.Do(req)
 	if err != nil {
-		fmt.Printf("DEBUG: HTTP request failed: %v\n", err)
-		return nil, &StarfishError{
+		if ctx.Err() == nil {
+			fmt.Printf("DEBUG: HTTP request failed: %v\n", err)
+		}
+		return 0, &StarfishError{
 			Code:    "API_UNAVAILABLE",
 			Message: "Starfish API is unavailable",
 			Err:     err,
@@ -81,14 +159,18 @@ func (b *StarfishBackend) QueryStarfish(ctx context.Context, bucket, volumeAndPa
 		switch resp.StatusCode {
 		case http.StatusUnauthorized:
 			errorCode = "AUTHENTICATION_FAILED"
+		case http.StatusForbidden:
+			errorCode = "ACCESS_DENIED"
 		case http.StatusNotFound:
 			errorCode = "COLLECTION_NOT_FOUND"
 		case http.StatusTooManyRequests:
 			errorCode = "RATE_LIMITED"
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			errorCode = "API_UNAVAILABLE"
 		default:
 			errorCode = "API_ERROR"
 		}
-		return nil, &StarfishError{
+		return 0, &StarfishError{
 			Code:    errorCode,
 			Message: fmt.Sprintf("API request failed with status %d: %s", resp.StatusCode, string(body)),
 		}
@@ -96,30 +178,62 @@ func (b *StarfishBackend) QueryStarfish(ctx context.Context, bucket, volumeAndPa
 
 	// Parse response - Starfish returns an array of entries directly
 	fmt.Printf("DEBUG: Parsing JSON response...\n")
-	var entries []StarfishEntry
-	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+	n, err := decodeEntries(resp.Body, fn)
+	if err != nil {
 		fmt.Printf("DEBUG: JSON decode failed: %v\n", err)
-		return nil, &StarfishError{
+		return n, &StarfishError{
 			Code:    "RESPONSE_DECODE_FAILED",
 			Message: "Failed to decode API response",
 			Err:     err,
 		}
 	}
 
-	// Convert to our response format
-	result := &StarfishQueryResponse{
-		Entries: entries,
-		Total:   len(entries),
+	return n, nil
+}
+
+// decodeEntries decodes a JSON array of Starfish entries one entry at a
+// time, calling fn for each entry with its paths trimmed until fn returns
+// false. Only the entry being decoded is held in memory, the rest of the
+// array is read as fn asks for it. It returns the number of entries passed
+// to fn.
+func decodeEntries(r io.Reader, fn func(StarfishEntry) bool) (int, error) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	if tok == nil {
+		return 0, nil // null, no entries
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return 0, fmt.Errorf("expected an array of entries, got %v", tok)
 	}
 
-	// Debug output
-	fmt.Printf("DEBUG: QueryStarfish returned %d entries\n", len(entries))
+	n := 0
+	for dec.More() {
+		var entry StarfishEntry
+		if err := dec.Decode(&entry); err != nil {
+			return n, err
+		}
+		trimEntryPaths(&entry)
+		n++
+		if !fn(entry) {
+			return n, nil
+		}
+	}
 
-	return result, nil
+	// Consume the closing bracket so truncated responses are detected
+	if _, err := dec.Token(); err != nil {
+		return n, err
+	}
+	return n, nil
 }
 
-// buildQueryURL constructs the Starfish query URL using the simple /query/ endpoint
-func (b *StarfishBackend) buildQueryURL(collectionTag, volumeAndPath, additionalQuery string) (string, error) {
+// buildQueryURL constructs the Starfish query URL using the simple /query/ endpoint.
+// The files of virtual buckets are selected by their query, collectionTag,
+// instead of the bucket source.
+func (b *StarfishBackend) buildQueryURL(collectionTag string, virtual bool, volumeAndPath, additionalQuery string, offset int) (string, error) {
 	// Build base URL: /query/
 	baseURL := fmt.Sprintf("%s/query/",
 		strings.TrimSuffix(b.apiEndpoint, "/"))
@@ -127,11 +241,26 @@ func (b *StarfishBackend) buildQueryURL(collectionTag, volumeAndPath, additional
 	// Build query parameters
 	params := url.Values{}
 
-	// Build query filter using Collections: tagset tag and additional filters
+	// Build query filter using the bucket filter and additional filters
 	var queryFilters []string
 
-	// Add Collections: tagset tag filter - use the full "Collections:TagName" format
-	queryFilters = append(queryFilters, fmt.Sprintf("tag=%s", collectionTag))
+	// Match the files of the bucket: by full "Tagset:TagName" tag, by
+	// zone, or by restricting the query to the volume
+	switch {
+	case virtual:
+		queryFilters = append(queryFilters, collectionTag)
+	case b.bucketSource == BucketSourceZone:
+		queryFilters = append(queryFilters, fmt.Sprintf("zone=%s", queryValue(collectionTag)))
+	case b.bucketSource == BucketSourceVolume:
+		params.Set("volumes_and_paths", collectionTag+":")
+	default:
+		queryFilters = append(queryFilters, fmt.Sprintf("tag=%s", collectionTag))
+	}
+
+	// Restrict the query to a volume, or a path on it
+	if volumeAndPath != "" {
+		params.Set("volumes_and_paths", volumeAndPath)
+	}
 
 	// Add additional query filters if provided
 	if additionalQuery != "" {
@@ -144,10 +273,19 @@ func (b *StarfishBackend) buildQueryURL(collectionTag, volumeAndPath, additional
 	}
 
 	// Set format to include necessary fields for S3 compatibility
-	params.Set("format", "parent_path fn type size ct mt at uid gid mode volume tags_explicit tags_inherited")
+	format := "parent_path fn type size ct mt at uid gid mode ino volume zones tags_explicit tags_inherited"
+	if b.hashCache != nil {
+		// Hashes Starfish already recorded save reading the file
+		format += " md5 sha256"
+	}
+	params.Set("format", format)
 
-	// Set reasonable limit (can be made configurable later)
-	params.Set("limit", "1000")
+	// Fetch one page of results, callers page through larger result
+	// sets by advancing the offset
+	params.Set("limit", strconv.Itoa(b.pageSize()))
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
 
 	// Set sort order for consistent results
 	params.Set("sort_by", "parent_path,fn")
@@ -160,6 +298,77 @@ func (b *StarfishBackend) buildQueryURL(collectionTag, volumeAndPath, additional
 	return baseURL, nil
 }
 
+// pageSize returns the number of entries requested per Starfish query
+func (b *StarfishBackend) pageSize() int {
+	if b.queryPageSize <= 0 {
+		return 1000
+	}
+	return b.queryPageSize
+}
+
+// prefixFilters translates an S3 listing prefix of Starfish paths into
+// Starfish query filters. Every file below the prefix is matched by one of
+// the returned filters, which may match a superset of the prefix, callers
+// must still check each key against the prefix. Starfish filters cannot be
+// combined with OR, so each filter is run as a separate query. A nil
+// result means the whole collection has to be queried.
+func prefixFilters(prefix string) []string {
+	if prefix == "" {
+		return nil
+	}
+
+	// Keys are built as parent_path/fn, so for "a/b/c" a matching file is
+	// either in a/b with fn starting with c, or anywhere below a
+	// directory a/b/c*
+	dir, base := "", prefix
+	if idx := strings.LastIndex(prefix, "/"); idx != -1 {
+		dir, base = prefix[:idx], prefix[idx+1:]
+	}
+
+	filesInDir := fmt.Sprintf("fn=%s", queryValue(globLiteral(base)+"*"))
+	if dir != "" {
+		filesInDir = fmt.Sprintf("parent_path=%s %s", queryValue(globLiteral(dir)), filesInDir)
+	}
+	if base == "" {
+		// Every file of the directory matches
+		filesInDir = fmt.Sprintf("parent_path=%s", queryValue(globLiteral(dir)))
+	}
+
+	below := dir + "/" + base
+	if dir == "" {
+		below = base
+	}
+
+	return []string{
+		filesInDir,
+		fmt.Sprintf("parent_path=%s", queryValue(globLiteral(below)+"*")),
+	}
+}
+
+// globLiteral turns a literal path into a Starfish glob pattern matching
+// it. Glob metacharacters, quotes and backslashes are replaced by ?, which
+// matches any single character, so the pattern may match a superset of
+// the path but never misses it.
+func globLiteral(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '*', '?', '[', ']', '\\', '"':
+			return '?'
+		}
+		return r
+	}, value)
+}
+
+// queryValue quotes a Starfish query filter value if it contains
+// whitespace that would otherwise split the filter. Values are built with
+// globLiteral and never contain quotes that would need escaping.
+func queryValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
 // QueryStarfishTags discovers all tags in the specified tagset using /tagset/{tagset_name}/ endpoint
 func (b *StarfishBackend) QueryStarfishTags(ctx context.Context, tagset string) (*StarfishTagsResponse, error) {
 	// Build the tagset query URL
@@ -0,0 +1,200 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDecodeEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []string
+		fail     bool
+	}{
+		{"entries", `[{"fn": "a", "parent_path": "/dir/"}, {"fn": "b"}]`, []string{"dir/a", "b"}, false},
+		{"empty", `[]`, nil, false},
+		{"null", `null`, nil, false},
+		{"object", `{"entries": []}`, nil, true},
+		{"truncated", `[{"fn": "a"}, {"fn": "b"`, []string{"a"}, true},
+		{"unterminated", `[{"fn": "a"}`, []string{"a"}, true},
+	}
+	for _, tt := range tests {
+		var keys []string
+		n, err := decodeEntries(strings.NewReader(tt.body), func(entry StarfishEntry) bool {
+			keys = append(keys, originalObjectKey(entry))
+			return true
+		})
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: expected failure %v, got %v", tt.name, tt.fail, err)
+		}
+		if n != len(keys) || strings.Join(keys, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("%s: expected %v, got %d entries %v", tt.name, tt.expected, n, keys)
+		}
+	}
+}
+
+func TestWalkStarfishPageStopsEarly(t *testing.T) {
+	var written atomic.Int64
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		// Write entries until the client stops reading
+		w.Write([]byte("["))
+		for i := 0; i < 1000000; i++ {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			if _, err := fmt.Fprintf(w, `{"fn": "file-%d.txt", "parent_path": "dir", "volume": "vol"}`, i); err != nil {
+				return
+			}
+			written.Add(1)
+		}
+		w.Write([]byte("]"))
+	})
+	defer server.Close()
+
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{})
+
+	var first StarfishEntry
+	n, err := backend.WalkStarfishPage(context.Background(), "test-bucket", "", "type=f", 0, func(entry StarfishEntry) bool {
+		first = entry
+		return false
+	})
+	if err != nil {
+		t.Fatalf("WalkStarfishPage failed: %v", err)
+	}
+	if n != 1 || first.Filename != "file-0.txt" {
+		t.Errorf("expected to stop after file-0.txt, got %d entries, first %q", n, first.Filename)
+	}
+
+	// The server notices the closed connection once its buffers fill up
+	time.Sleep(100 * time.Millisecond)
+	if written.Load() == 1000000 {
+		t.Error("expected the response to be abandoned once the walk stopped")
+	}
+}
+
+// benchmarkResponse returns a Starfish query response of n entries
+func benchmarkResponse(n int) []byte {
+	entries := make([]StarfishEntry, n)
+	for i := range entries {
+		entries[i] = StarfishEntry{
+			Filename:         fmt.Sprintf("file-%08d.dat", i),
+			ParentPath:       fmt.Sprintf("/projects/p%03d/raw/%04d", i%1000, i%9973),
+			Type:             32768,
+			Size:             int64(i) * 4096,
+			Mode:             "0644",
+			UID:              1000,
+			GID:              1000,
+			CreateTimeUnix:   1700000000,
+			ModifyTimeUnix:   1700000000 + int64(i),
+			AccessTimeUnix:   1700000000 + int64(i),
+			Volume:           "vol1",
+			Inode:            int64(i) + 1,
+			TagsInheritedStr: "Collections:Projects",
+		}
+	}
+	data, _ := json.Marshal(entries)
+	return data
+}
+
+// peakHeap runs fn and returns the largest growth of the heap sampled
+// while it ran
+func peakHeap(fn func()) uint64 {
+	runtime.GC()
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	read := func() uint64 {
+		metrics.Read(sample)
+		return sample[0].Value.Uint64()
+	}
+
+	base := read()
+	var peak atomic.Uint64
+	peak.Store(base)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(100 * time.Microsecond)
+		defer ticker.Stop()
+		for {
+			if heap := read(); heap > peak.Load() {
+				peak.Store(heap)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	fn()
+	if heap := read(); heap > peak.Load() {
+		peak.Store(heap)
+	}
+	close(done)
+	<-stopped
+	return peak.Load() - base
+}
+
+// BenchmarkDecodeEntries compares decoding a large query response as a
+// whole with walking it entry by entry, reporting the peak heap of each
+func BenchmarkDecodeEntries(b *testing.B) {
+	data := benchmarkResponse(100000)
+	runtime.GC()
+
+	b.Run("buffered", func(b *testing.B) {
+		var peak uint64
+		for i := 0; i < b.N; i++ {
+			peak = max(peak, peakHeap(func() {
+				var entries []StarfishEntry
+				if err := json.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil {
+					b.Fatal(err)
+				}
+				runtime.KeepAlive(entries)
+			}))
+		}
+		b.ReportMetric(float64(peak)/(1<<20), "peak-MiB")
+	})
+
+	b.Run("streamed", func(b *testing.B) {
+		var peak uint64
+		for i := 0; i < b.N; i++ {
+			peak = max(peak, peakHeap(func() {
+				var size int64
+				if _, err := decodeEntries(bytes.NewReader(data), func(entry StarfishEntry) bool {
+					size += entry.Size
+					return true
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}))
+		}
+		b.ReportMetric(float64(peak)/(1<<20), "peak-MiB")
+	})
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/versity/versitygw/metrics"
+	"github.com/versity/versitygw/s3event"
+)
+
+// defaultCollectionsRefreshInterval is used when no refresh interval is
+// configured
+const defaultCollectionsRefreshInterval = 10 * time.Minute
+
+// SetNotifiers sets where changes to the collections found by a refresh
+// are reported. The gateway calls it once its metrics and event
+// notifications are set up.
+func (b *StarfishBackend) SetNotifiers(metricsManager *metrics.Manager, eventSender s3event.S3EventSender) {
+	b.collectionsMux.Lock()
+	defer b.collectionsMux.Unlock()
+
+	if metricsManager != nil {
+		b.metricsManager = metricsManager
+	}
+	b.eventSender = eventSender
+}
+
+// StartCollectionsRefresh rediscovers the collections every
+// CollectionsRefreshInterval until Shutdown. If Starfish cannot be reached
+// the last known collections keep being served.
+func (b *StarfishBackend) StartCollectionsRefresh() {
+	interval := b.CollectionsRefreshInterval
+	if interval <= 0 {
+		interval = defaultCollectionsRefreshInterval
+	}
+
+	b.collectionsMux.Lock()
+	if b.refreshCancel != nil {
+		b.collectionsMux.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	b.refreshCancel, b.refreshDone = cancel, done
+	b.collectionsMux.Unlock()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := b.InitializeCollections(ctx)
+				if err == nil || ctx.Err() != nil {
+					continue
+				}
+				fmt.Printf("[WARN] Failed to refresh Starfish collections, serving the last known collections: %v\n", err)
+				if mm := b.refreshMetrics(); mm != nil {
+					mm.Add("starfish_collections_refresh_errors", 1)
+				}
+			}
+		}
+	}()
+}
+
+// stopCollectionsRefresh stops the refresh loop and waits for it to exit
+func (b *StarfishBackend) stopCollectionsRefresh() {
+	b.collectionsMux.Lock()
+	cancel, done := b.refreshCancel, b.refreshDone
+	b.refreshCancel, b.refreshDone = nil, nil
+	b.collectionsMux.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// refreshMetrics returns the metrics manager, which may be set while the
+// refresh loop runs
+func (b *StarfishBackend) refreshMetrics() *metrics.Manager {
+	b.collectionsMux.RLock()
+	defer b.collectionsMux.RUnlock()
+	return b.metricsManager
+}
+
+// diffCollections returns the sorted buckets added and removed between two
+// sets of collections
+func diffCollections(previous, current map[string]string) (added, removed []string) {
+	for bucket := range current {
+		if _, ok := previous[bucket]; !ok {
+			added = append(added, bucket)
+		}
+	}
+	for bucket := range previous {
+		if _, ok := current[bucket]; !ok {
+			removed = append(removed, bucket)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// reportCollectionChanges emits metrics and bucket event notifications for
+// collections that appeared or disappeared
+func (b *StarfishBackend) reportCollectionChanges(added, removed []string) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	fmt.Printf("Starfish collections changed: added %v, removed %v\n", added, removed)
+
+	b.collectionsMux.RLock()
+	mm, evs := b.metricsManager, b.eventSender
+	b.collectionsMux.RUnlock()
+
+	for _, bucket := range added {
+		if mm != nil {
+			mm.Add("starfish_collections_added", 1, metrics.Tag{Key: "bucket", Value: bucket})
+		}
+		if evs != nil {
+			evs.SendBucketEvent(s3event.BucketEventMeta{
+				BucketOwner: b.defaultOwner,
+				EventName:   s3event.EventBucketCreatedDiscovered,
+				Bucket:      bucket,
+			})
+		}
+	}
+	for _, bucket := range removed {
+		if mm != nil {
+			mm.Add("starfish_collections_removed", 1, metrics.Tag{Key: "bucket", Value: bucket})
+		}
+		if evs != nil {
+			evs.SendBucketEvent(s3event.BucketEventMeta{
+				BucketOwner: b.defaultOwner,
+				EventName:   s3event.EventBucketRemovedVanished,
+				Bucket:      bucket,
+			})
+		}
+	}
+}
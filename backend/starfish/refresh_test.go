@@ -0,0 +1,149 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/versity/versitygw/s3event"
+)
+
+// recordingEventSender records the bucket events it is sent
+type recordingEventSender struct {
+	mu     sync.Mutex
+	events []s3event.BucketEventMeta
+}
+
+func (r *recordingEventSender) SendEvent(*fiber.Ctx, s3event.EventMeta) {}
+
+func (r *recordingEventSender) SendBucketEvent(meta s3event.BucketEventMeta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, meta)
+}
+
+func (r *recordingEventSender) Close() error { return nil }
+
+func (r *recordingEventSender) recorded() []s3event.BucketEventMeta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]s3event.BucketEventMeta(nil), r.events...)
+}
+
+func TestCollectionsRefresh(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		tags     = []string{"Keep", "Gone"}
+		failing  bool
+		requests atomic.Int32
+	)
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(tags)
+	})
+	defer server.Close()
+
+	backend, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:                server.URL,
+		BearerToken:                "test-token",
+		CacheTTL:                   time.Minute,
+		CollectionsRefreshInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	if err := backend.InitializeCollections(context.Background()); err != nil {
+		t.Fatalf("InitializeCollections failed: %v", err)
+	}
+
+	events := &recordingEventSender{}
+	backend.SetNotifiers(nil, events)
+	backend.listCache.add("gone", "", []listEntry{{key: "file.txt"}})
+	backend.listCache.add("keep", "", []listEntry{{key: "file.txt"}})
+
+	mu.Lock()
+	tags = []string{"Keep", "New"}
+	mu.Unlock()
+
+	backend.StartCollectionsRefresh()
+	defer backend.Shutdown()
+
+	waitFor(t, func() bool { return len(events.recorded()) == 2 })
+
+	expected := []s3event.BucketEventMeta{
+		{EventName: s3event.EventBucketCreatedDiscovered, Bucket: "new"},
+		{EventName: s3event.EventBucketRemovedVanished, Bucket: "gone"},
+	}
+	if got := events.recorded(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected events %v, got %v", expected, got)
+	}
+	if _, ok := backend.listCache.get("gone", ""); ok {
+		t.Error("expected the listing of the removed bucket to be dropped")
+	}
+	if _, ok := backend.listCache.get("keep", ""); !ok {
+		t.Error("expected the listing of a kept bucket to stay cached")
+	}
+
+	// Unreachable Starfish keeps the last known collections
+	mu.Lock()
+	failing = true
+	mu.Unlock()
+	seen := requests.Load()
+	waitFor(t, func() bool { return requests.Load() > seen+1 })
+
+	expectedCollections := map[string]string{"keep": "Collections:Keep", "new": "Collections:New"}
+	if got := backend.GetAllCollections(); !reflect.DeepEqual(got, expectedCollections) {
+		t.Errorf("expected collections %v, got %v", expectedCollections, got)
+	}
+	if len(events.recorded()) != 2 {
+		t.Errorf("expected no events for a failed refresh, got %v", events.recorded())
+	}
+
+	// Shutdown stops the refresh loop
+	backend.Shutdown()
+	stopped := requests.Load()
+	time.Sleep(50 * time.Millisecond)
+	if requests.Load() != stopped {
+		t.Error("expected no refreshes after Shutdown")
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
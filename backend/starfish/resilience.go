@@ -0,0 +1,196 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/versity/versitygw/metrics"
+)
+
+// Defaults of the Starfish query retries and circuit breaker
+const (
+	defaultQueryRetries     = 2
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	maxRetryDelay           = 2 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// staleWarning is the Warning header of responses built from expired
+// cached query results
+const staleWarning = `110 - "Response is Stale"`
+
+// isStarfishUnavailable reports whether a query failed because Starfish is
+// down or overloaded, as opposed to rejecting the query
+func isStarfishUnavailable(err error) bool {
+	var starfishErr *StarfishError
+	if !errors.As(err, &starfishErr) {
+		return false
+	}
+	switch starfishErr.Code {
+	case "API_UNAVAILABLE", "RATE_LIMITED", "CIRCUIT_OPEN":
+		return true
+	}
+	return false
+}
+
+// queryWithRetry sends a query, retrying with jittered exponential backoff
+// while Starfish is unavailable. Queries are reads, so they are safe to
+// repeat, as long as none of the entries was passed to fn yet.
+func (b *StarfishBackend) queryWithRetry(ctx context.Context, queryURL string, fn func(StarfishEntry) bool) (int, error) {
+	for attempt := 0; ; attempt++ {
+		n, err := b.queryOnce(ctx, queryURL, fn)
+		if err == nil || n > 0 || !isStarfishUnavailable(err) || attempt >= b.queryRetries || ctx.Err() != nil {
+			return n, err
+		}
+
+		if b.metricsManager != nil {
+			b.metricsManager.Add("starfish_query_retries", 1)
+		}
+
+		timer := time.NewTimer(b.retryDelay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns a random delay of up to the base delay doubled for
+// each earlier attempt, so retrying clients do not hit Starfish in step
+func (b *StarfishBackend) retryDelay(attempt int) time.Duration {
+	ceiling := b.retryBaseDelay << attempt
+	if ceiling <= 0 || ceiling > maxRetryDelay {
+		ceiling = maxRetryDelay
+	}
+	return time.Duration(rand.Int64N(int64(ceiling))) + 1
+}
+
+// markStale adds a Warning header to the response of a request served
+// from expired cached query results
+func (b *StarfishBackend) markStale(ctx context.Context, bucket string) {
+	rctx, ok := ctx.(*fasthttp.RequestCtx)
+	if !ok {
+		// Queries run on behalf of the request by sharded listings
+		rctx, ok = ctx.Value(requestCtxKey{}).(*fasthttp.RequestCtx)
+	}
+	if ok {
+		b.staleMux.Lock()
+		rctx.Response.Header.Set("Warning", staleWarning)
+		b.staleMux.Unlock()
+	}
+	if b.metricsManager != nil {
+		b.metricsManager.Add("starfish_stale_responses", 1,
+			metrics.Tag{Key: "bucket", Value: bucket})
+	}
+}
+
+// circuitBreaker stops sending queries to Starfish after repeated
+// failures. Once the cooldown has passed a single probe query is let
+// through, closing the breaker if it succeeds and reopening it otherwise.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// newCircuitBreaker creates a breaker opening after threshold consecutive
+// failures for cooldown
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether a query may be sent to Starfish
+func (c *circuitBreaker) allow() bool {
+	if c == nil {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures < c.threshold {
+		return true
+	}
+	if time.Now().Before(c.openUntil) || c.probing {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+// success records a query Starfish answered, closing the breaker
+func (c *circuitBreaker) success() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures = 0
+	c.probing = false
+}
+
+// failure records a query that failed because Starfish is unavailable,
+// opening the breaker once the threshold is reached
+func (c *circuitBreaker) failure() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	c.probing = false
+	if c.failures >= c.threshold {
+		if c.failures == c.threshold {
+			fmt.Printf("[WARN] Starfish API unavailable after %d failed queries, pausing queries for %v\n",
+				c.failures, c.cooldown)
+		}
+		c.openUntil = time.Now().Add(c.cooldown)
+	}
+}
+
+// abandon records a query given up by the client, letting another probe
+// through if it was the probe
+func (c *circuitBreaker) abandon() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.probing = false
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/valyala/fasthttp"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+// newResilienceBackend returns a backend for test-bucket querying the
+// server, with fast retries
+func newResilienceBackend(t *testing.T, serverURL string, config StarfishConfig) *StarfishBackend {
+	t.Helper()
+	config.APIEndpoint = serverURL
+	config.BearerToken = "test-token"
+	if config.CacheTTL == 0 {
+		config.CacheTTL = time.Minute
+	}
+
+	backend, err := NewStarfishBackend(&config)
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	t.Cleanup(backend.Shutdown)
+	backend.AddCollection("test-bucket", "Collections:TestCollection")
+	backend.retryBaseDelay = time.Millisecond
+	return backend
+}
+
+// listTestBucket lists test-bucket with ListObjectsV2
+func listTestBucket(ctx context.Context, backend *StarfishBackend) (s3response.ListObjectsV2Result, error) {
+	bucket := "test-bucket"
+	return backend.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: &bucket})
+}
+
+func TestQueryRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode([]StarfishEntry{{Filename: "file.txt", Size: 1, Volume: "vol"}})
+	})
+	defer server.Close()
+
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{})
+
+	res, err := listTestBucket(context.Background(), backend)
+	if err != nil {
+		t.Fatalf("expected the query to succeed after retries, got %v", err)
+	}
+	if len(res.Contents) != 1 {
+		t.Errorf("expected 1 object, got %d", len(res.Contents))
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestRateLimitedIsSlowDown(t *testing.T) {
+	var requests atomic.Int32
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	defer server.Close()
+
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{QueryRetries: -1})
+
+	_, err := listTestBucket(context.Background(), backend)
+	if !errors.Is(err, s3err.GetAPIError(s3err.ErrSlowDown)) {
+		t.Errorf("expected SlowDown, got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected no retries when disabled, got %d requests", n)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		requests atomic.Int32
+		healthy  atomic.Bool
+	)
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode([]StarfishEntry{})
+	})
+	defer server.Close()
+
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{
+		QueryRetries:     -1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  20 * time.Millisecond,
+		StaleCacheTTL:    -1,
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := listTestBucket(context.Background(), backend); !errors.Is(err, s3err.GetAPIError(s3err.ErrServiceUnavailable)) {
+			t.Fatalf("expected ServiceUnavailable, got %v", err)
+		}
+	}
+
+	// Open: requests fail without reaching Starfish
+	if _, err := listTestBucket(context.Background(), backend); !errors.Is(err, s3err.GetAPIError(s3err.ErrServiceUnavailable)) {
+		t.Errorf("expected ServiceUnavailable while open, got %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected the open breaker to stop queries, got %d requests", n)
+	}
+
+	// After the cooldown a probe goes through and closes the breaker
+	healthy.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := listTestBucket(context.Background(), backend); err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+	if !backend.breaker.allow() {
+		t.Error("expected the breaker to close after a successful probe")
+	}
+}
+
+func TestServeStaleQueryResults(t *testing.T) {
+	var failing atomic.Bool
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode([]StarfishEntry{{Filename: "file.txt", Size: 1, Volume: "vol"}})
+	})
+	defer server.Close()
+
+	backend := newResilienceBackend(t, server.URL, StarfishConfig{QueryRetries: -1})
+
+	if _, err := listTestBucket(context.Background(), backend); err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+
+	// Expire the cached listing and query results
+	backend.listCache.clear("")
+	backend.cache.mutex.Lock()
+	for _, elem := range backend.cache.data {
+		elem.Value.(*CachedResult).ExpiresAt = time.Now().Add(-time.Minute)
+	}
+	backend.cache.mutex.Unlock()
+
+	failing.Store(true)
+
+	var rctx fasthttp.RequestCtx
+	rctx.Init(&fasthttp.Request{}, nil, nil)
+	res, err := listTestBucket(&rctx, backend)
+	if err != nil {
+		t.Fatalf("expected stale results while Starfish is unavailable, got %v", err)
+	}
+	if len(res.Contents) != 1 {
+		t.Errorf("expected 1 stale object, got %d", len(res.Contents))
+	}
+	if warning := string(rctx.Response.Header.Peek("Warning")); warning != staleWarning {
+		t.Errorf("expected stale warning header, got %q", warning)
+	}
+
+	// Without stale results the error is returned
+	backend.cache.Clear()
+	backend.listCache.clear("")
+	if _, err := listTestBucket(context.Background(), backend); !errors.Is(err, s3err.GetAPIError(s3err.ErrServiceUnavailable)) {
+		t.Errorf("expected ServiceUnavailable without cached results, got %v", err)
+	}
+}
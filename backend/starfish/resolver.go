@@ -0,0 +1,292 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/versity/versitygw/metrics"
+	"github.com/versity/versitygw/s3err"
+)
+
+// rewriteIndex maps object keys produced by path rewrite rules back to the
+// Starfish entries they were built from. It is filled with the keys
+// returned by listings, so a key returned by ListObjects can be fetched
+// without re-running the rewrite over the whole collection. The index is
+// bounded, the least recently used keys are dropped first.
+type rewriteIndex struct {
+	mu      sync.Mutex
+	entries map[indexKey]*list.Element
+	lru     *list.List
+	ttl     time.Duration
+	maxSize int
+}
+
+// indexKey identifies an object key within a bucket
+type indexKey struct {
+	bucket string
+	key    string
+}
+
+// indexedEntry is a Starfish entry along with the time it was indexed
+type indexedEntry struct {
+	id        indexKey
+	entry     StarfishEntry
+	indexedAt time.Time
+}
+
+// newRewriteIndex creates an empty index of up to maxSize keys whose
+// entries are trusted for ttl
+func newRewriteIndex(maxSize int, ttl time.Duration) *rewriteIndex {
+	return &rewriteIndex{
+		entries: make(map[indexKey]*list.Element),
+		lru:     list.New(),
+		ttl:     ttl,
+		maxSize: maxSize,
+	}
+}
+
+// add records the entry behind a rewritten key
+func (i *rewriteIndex) add(bucket, key string, entry StarfishEntry) {
+	if i == nil {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	id := indexKey{bucket: bucket, key: key}
+	if elem, ok := i.entries[id]; ok {
+		i.lru.Remove(elem)
+	}
+	i.entries[id] = i.lru.PushFront(&indexedEntry{
+		id:        id,
+		entry:     entry,
+		indexedAt: time.Now(),
+	})
+
+	// Drop the least recently used keys over the limit, along with any
+	// expired keys at the end of the list
+	for back := i.lru.Back(); back != nil; back = i.lru.Back() {
+		if i.lru.Len() <= i.maxSize && !i.expired(back.Value.(*indexedEntry)) {
+			break
+		}
+		i.remove(back)
+	}
+}
+
+// lookup returns the entry behind a rewritten key if it was indexed
+// recently enough to still be trusted
+func (i *rewriteIndex) lookup(bucket, key string) (StarfishEntry, bool) {
+	if i == nil {
+		return StarfishEntry{}, false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	elem, ok := i.entries[indexKey{bucket: bucket, key: key}]
+	if !ok {
+		return StarfishEntry{}, false
+	}
+
+	indexed := elem.Value.(*indexedEntry)
+	if i.expired(indexed) {
+		i.remove(elem)
+		return StarfishEntry{}, false
+	}
+
+	i.lru.MoveToFront(elem)
+	return indexed.entry, true
+}
+
+// clear drops all indexed keys for a bucket, or for every bucket if
+// bucket is empty
+func (i *rewriteIndex) clear(bucket string) {
+	if i == nil {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for elem := i.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if bucket == "" || elem.Value.(*indexedEntry).id.bucket == bucket {
+			i.remove(elem)
+		}
+		elem = next
+	}
+}
+
+// expired reports whether an indexed entry is too old to be trusted
+func (i *rewriteIndex) expired(indexed *indexedEntry) bool {
+	return i.ttl > 0 && time.Since(indexed.indexedAt) > i.ttl
+}
+
+// remove drops an indexed key, the caller must hold the lock
+func (i *rewriteIndex) remove(elem *list.Element) {
+	indexed := i.lru.Remove(elem).(*indexedEntry)
+	delete(i.entries, indexed.id)
+}
+
+// resolveObject finds the Starfish entry behind an object key exactly as
+// ListObjects presents it, including keys produced by path rewrite rules
+// and keys given to colliding entries
+func (b *StarfishBackend) resolveObject(ctx context.Context, operation, bucket, object string) (StarfishEntry, error) {
+	rewritten := b.hasPathRewriteRules(bucket)
+	if rewritten {
+		if entry, ok := b.rewriteIndex.lookup(bucket, object); ok {
+			return entry, nil
+		}
+	}
+
+	// The key is either the key of its entry or, for an entry that lost a
+	// collision, that key with the inode of the entry appended. Collisions
+	// are resolved over every entry of both keys, as listings do.
+	keys := []string{object}
+	if base, ok := b.collisionBase(object); ok && len(base)+len(collisionSeparator) < len(object) {
+		keys = append(keys, base)
+	}
+
+	var candidates []listEntry
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		entries, err := b.entriesForKey(ctx, operation, bucket, key)
+		if err != nil {
+			return StarfishEntry{}, err
+		}
+		for _, le := range entries {
+			if id := entryID(le.entry); !seen[id] {
+				seen[id] = true
+				candidates = append(candidates, le)
+			}
+		}
+	}
+
+	candidates, err := b.uniqueKeys(bucket, candidates)
+	if err != nil {
+		return StarfishEntry{}, err
+	}
+	for _, le := range candidates {
+		if le.key == object {
+			if rewritten {
+				b.rewriteIndex.add(bucket, object, le.entry)
+			}
+			return le.entry, nil
+		}
+	}
+
+	return StarfishEntry{}, s3err.GetAPIError(s3err.ErrNoSuchKey)
+}
+
+// entriesForKey returns every entry whose listing key, before collisions
+// are resolved, is key
+func (b *StarfishBackend) entriesForKey(ctx context.Context, operation, bucket, key string) ([]listEntry, error) {
+	// Without rewrite rules the object key is the Starfish path, so the
+	// entries can be fetched directly
+	if !b.hasPathRewriteRules(bucket) {
+		return b.lookupEntries(ctx, operation, bucket, key)
+	}
+
+	// When every rule keeps the original key behind a literal, the key can
+	// only come from a few Starfish paths, each of which is looked up
+	if originals, ok := b.originalKeys(bucket, key); ok {
+		var entries []listEntry
+		for _, original := range originals {
+			found, err := b.lookupEntries(ctx, operation, bucket, original)
+			if err != nil {
+				return nil, err
+			}
+			for _, le := range found {
+				if rewrittenKey := b.objectKeyForEntry(le.entry, bucket); rewrittenKey == key {
+					entries = append(entries, listEntry{key: rewrittenKey, entry: le.entry})
+				}
+			}
+		}
+		return entries, nil
+	}
+
+	// Other rewritten keys have no fixed relation to the Starfish path, so
+	// walk the collection and compare against the listing key of each
+	// entry. This is only needed for keys that were not listed recently.
+	if b.metricsManager != nil {
+		b.metricsManager.Add("starfish_rewrite_full_scans", 1,
+			metrics.Tag{Key: "bucket", Value: bucket},
+			metrics.Tag{Key: "operation", Value: operation})
+	}
+
+	return b.findEntries(ctx, operation, bucket, []string{"type=f"}, func(k string) bool {
+		return k == key
+	})
+}
+
+// lookupEntries fetches the Starfish entries at the path of an object key
+// that maps directly to a Starfish path, using a parent_path and fn query
+// instead of scanning the collection. Collections spanning volumes may
+// hold the path more than once.
+func (b *StarfishBackend) lookupEntries(ctx context.Context, operation, bucket, object string) ([]listEntry, error) {
+	if object == "" || strings.HasSuffix(object, "/") {
+		return nil, nil
+	}
+
+	// Top level files are matched on fn alone, which also finds files of
+	// the same name in every other directory, so page through all matches
+	// and confirm the key. Lookups are not cached.
+	var entries []listEntry
+	err := b.walkQuery(ctx, operation, bucket, buildLookupQuery(object), false, func(entry StarfishEntry) bool {
+		if b.buildObjectKeyFromEntryWithBucket(entry, bucket) == object {
+			entries = append(entries, listEntry{key: object, entry: entry})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// buildLookupQuery returns the Starfish query filters that select the
+// single file at the given path
+func buildLookupQuery(object string) string {
+	return "type=f " + pathFilters(object)
+}
+
+// pathFilters returns the Starfish query filters matching the entries at
+// a path
+func pathFilters(object string) string {
+	var filters []string
+
+	dir, name := "", object
+	if idx := strings.LastIndex(object, "/"); idx != -1 {
+		dir, name = object[:idx], object[idx+1:]
+	}
+
+	// Entries in the top level directory have no parent_path to match on
+	if dir != "" {
+		filters = append(filters, fmt.Sprintf("parent_path=%s", queryValue(globLiteral(dir))))
+	}
+	filters = append(filters, fmt.Sprintf("fn=%s", queryValue(globLiteral(name))))
+
+	return strings.Join(filters, " ")
+}
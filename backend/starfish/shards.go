@@ -0,0 +1,218 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultShardWorkers is the number of volumes a sharded listing queries
+// at once
+const defaultShardWorkers = 8
+
+// requestCtxKey is the context key of the request a sharded query runs
+// for, so stale results can still be reported in its response
+type requestCtxKey struct{}
+
+// volumeShards are the volumes holding files of a bucket
+type volumeShards struct {
+	volumes []string
+	foundAt time.Time
+}
+
+// shardsEnabled reports whether listing queries are split by volume.
+// Volume buckets hold a single volume.
+func (b *StarfishBackend) shardsEnabled() bool {
+	return b.shardVolumes && b.bucketSource != BucketSourceVolume
+}
+
+// workers returns the number of volumes queried at once
+func (b *StarfishBackend) workers() int {
+	if b.shardWorkers <= 0 {
+		return defaultShardWorkers
+	}
+	return b.shardWorkers
+}
+
+// findEntriesByVolume is findEntries running the queries on each volume
+// holding files of the bucket concurrently. The entries of each volume are
+// sorted as they arrive and merged into listing order.
+func (b *StarfishBackend) findEntriesByVolume(ctx context.Context, operation, bucket string, queries []string, match func(key string) bool) ([]listEntry, error) {
+	volumes, err := b.bucketVolumes(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) <= 1 {
+		volume := ""
+		if len(volumes) == 1 {
+			volume = volumes[0]
+		}
+		return b.collectEntries(ctx, operation, bucket, volume, queries, match)
+	}
+
+	shards := make([][]listEntry, len(volumes))
+	err = b.forEachVolume(ctx, volumes, func(ctx context.Context, i int, volume string) error {
+		entries, err := b.collectEntries(ctx, operation, bucket, volume, queries, match)
+		if err != nil {
+			return err
+		}
+		sortListEntries(entries)
+		shards[i] = entries
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeListEntries(shards), nil
+}
+
+// bucketVolumes returns the volumes holding files of a bucket. Every
+// Starfish volume is asked for a single file of the bucket, and the
+// volumes found are trusted for the cache TTL. The volumes found last are
+// used while they cannot be found again.
+func (b *StarfishBackend) bucketVolumes(ctx context.Context, bucket string) ([]string, error) {
+	b.volumeShardsMux.Lock()
+	shards, ok := b.volumeShards[bucket]
+	b.volumeShardsMux.Unlock()
+	if ok && time.Since(shards.foundAt) < b.shardTTL {
+		return shards.volumes, nil
+	}
+
+	volumes, err := b.findBucketVolumes(ctx, bucket)
+	if err != nil {
+		if ok && ctx.Err() == nil {
+			return shards.volumes, nil
+		}
+		return nil, starfishErrToS3Err(err)
+	}
+
+	b.volumeShardsMux.Lock()
+	b.volumeShards[bucket] = volumeShards{volumes: volumes, foundAt: time.Now()}
+	b.volumeShardsMux.Unlock()
+	return volumes, nil
+}
+
+// findBucketVolumes asks every Starfish volume for a file of a bucket and
+// returns the volumes holding one
+func (b *StarfishBackend) findBucketVolumes(ctx context.Context, bucket string) ([]string, error) {
+	found, err := b.discoverVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]string, 0, len(found))
+	for _, volume := range found {
+		all = append(all, volume)
+	}
+	sort.Strings(all)
+
+	hasFiles := make([]bool, len(all))
+	err = b.forEachVolume(ctx, all, func(ctx context.Context, i int, volume string) error {
+		// The walk stops reading the response at the first file
+		n, err := b.WalkStarfishPage(ctx, bucket, volume+":", "type=f", 0, func(StarfishEntry) bool {
+			return false
+		})
+		hasFiles[i] = n > 0
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []string
+	for i, volume := range all {
+		if hasFiles[i] {
+			volumes = append(volumes, volume)
+		}
+	}
+	return volumes, nil
+}
+
+// clearVolumeShards drops the volumes found for a bucket, or for every
+// bucket if bucket is empty
+func (b *StarfishBackend) clearVolumeShards(bucket string) {
+	b.volumeShardsMux.Lock()
+	defer b.volumeShardsMux.Unlock()
+
+	if bucket == "" {
+		clear(b.volumeShards)
+		return
+	}
+	delete(b.volumeShards, bucket)
+}
+
+// forEachVolume calls fn for each volume, running up to the worker limit
+// at once. The first error cancels the remaining calls and is returned.
+func (b *StarfishBackend) forEachVolume(ctx context.Context, volumes []string, fn func(ctx context.Context, i int, volume string) error) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(b.workers())
+
+	// Stale results are reported in the response of the request
+	gctx = context.WithValue(gctx, requestCtxKey{}, ctx)
+	for i, volume := range volumes {
+		g.Go(func() error {
+			return fn(gctx, i, volume)
+		})
+	}
+	return g.Wait()
+}
+
+// mergeListEntries merges lists of entries sorted in listing order into a
+// single sorted list
+func mergeListEntries(lists [][]listEntry) []listEntry {
+	total := 0
+	h := make(listEntryHeap, 0, len(lists))
+	for _, entries := range lists {
+		total += len(entries)
+		if len(entries) > 0 {
+			h = append(h, entries)
+		}
+	}
+	heap.Init(&h)
+
+	merged := make([]listEntry, 0, total)
+	for h.Len() > 0 {
+		merged = append(merged, h[0][0])
+		if h[0] = h[0][1:]; len(h[0]) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return merged
+}
+
+// listEntryHeap is a heap of sorted lists of entries, ordered by their
+// first entry
+type listEntryHeap [][]listEntry
+
+func (h listEntryHeap) Len() int           { return len(h) }
+func (h listEntryHeap) Less(i, j int) bool { return listEntryLess(h[i][0], h[j][0]) }
+func (h listEntryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *listEntryHeap) Push(x any)        { *h = append(*h, x.([]listEntry)) }
+
+func (h *listEntryHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// volumeServer serves the files of several volumes, paged by limit and
+// offset, and records the queries sent to each volume
+type volumeServer struct {
+	volumes  map[string][]StarfishEntry
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+
+	mu      sync.Mutex
+	queries map[string][]string // volume, "" for all volumes -> queries
+}
+
+func newVolumeServer(t *testing.T, volumes map[string][]StarfishEntry) (*volumeServer, string) {
+	t.Helper()
+	vs := &volumeServer{volumes: volumes, queries: make(map[string][]string)}
+	server := newTestServer(vs.serveHTTP)
+	t.Cleanup(server.Close)
+	return vs, server.URL
+}
+
+func (vs *volumeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/volume/" {
+		var volumes []StarfishVolume
+		for name := range vs.volumes {
+			volumes = append(volumes, StarfishVolume{Vol: name})
+		}
+		json.NewEncoder(w).Encode(volumes)
+		return
+	}
+
+	n := vs.inFlight.Add(1)
+	defer vs.inFlight.Add(-1)
+	for {
+		seen := vs.maxSeen.Load()
+		if n <= seen || vs.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	volume := strings.TrimSuffix(r.URL.Query().Get("volumes_and_paths"), ":")
+	vs.mu.Lock()
+	vs.queries[volume] = append(vs.queries[volume], r.URL.Query().Get("query"))
+	vs.mu.Unlock()
+
+	// Pages of the same query must not change order
+	var all []StarfishEntry
+	for _, name := range slices.Sorted(maps.Keys(vs.volumes)) {
+		if volume == "" || volume == name {
+			all = append(all, vs.volumes[name]...)
+		}
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	offset = min(offset, len(all))
+	json.NewEncoder(w).Encode(all[offset:min(offset+limit, len(all))])
+}
+
+func (vs *volumeServer) volumeQueries(volume string) []string {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	return append([]string(nil), vs.queries[volume]...)
+}
+
+// volumeEntries returns files on a volume, inodes are unique across
+// volumes
+func volumeEntries(volume string, firstInode int64, paths ...string) []StarfishEntry {
+	var entries []StarfishEntry
+	for i, p := range paths {
+		dir, name := "", p
+		if idx := strings.LastIndex(p, "/"); idx != -1 {
+			dir, name = p[:idx], p[idx+1:]
+		}
+		entries = append(entries, StarfishEntry{
+			Filename: name, ParentPath: dir, Type: testFileType, Size: int64(len(p)),
+			Volume: volume, Inode: firstInode + int64(i),
+		})
+	}
+	return entries
+}
+
+func TestShardedListing(t *testing.T) {
+	volumes := map[string][]StarfishEntry{
+		"vol1":  volumeEntries("vol1", 100, "b/2.txt", "a/1.txt", "shared.txt", "a/3.txt"),
+		"vol2":  volumeEntries("vol2", 200, "c.txt", "shared.txt", "a/2.txt"),
+		"vol3":  volumeEntries("vol3", 300, "z/9.txt", "a/0.txt"),
+		"empty": nil,
+	}
+	vs, serverURL := newVolumeServer(t, volumes)
+
+	// Sharded and unsharded listings return the same keys
+	unsharded := newResilienceBackend(t, serverURL, StarfishConfig{QueryPageSize: 2})
+	expected, err := listKeys(t, unsharded, "", "")
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if expected != "a/0.txt,a/1.txt,a/2.txt,a/3.txt,b/2.txt,c.txt,shared.txt,shared.txt~201,z/9.txt" {
+		t.Fatalf("unexpected unsharded listing %q", expected)
+	}
+
+	sharded := newResilienceBackend(t, serverURL, StarfishConfig{QueryPageSize: 2, ShardVolumes: true})
+	vs.maxSeen.Store(0)
+	for _, prefix := range []string{"", "a/", "shared"} {
+		want, err := listKeys(t, unsharded, prefix, "")
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		got, err := listKeys(t, sharded, prefix, "")
+		if err != nil {
+			t.Fatalf("sharded ListObjectsV2 failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("prefix %q: expected %q, got %q", prefix, want, got)
+		}
+	}
+
+	if vs.maxSeen.Load() < 2 {
+		t.Errorf("expected volumes to be queried concurrently, at most %d queries ran at once", vs.maxSeen.Load())
+	}
+
+	// Volumes without files of the bucket are only asked once
+	if queries := vs.volumeQueries("empty"); len(queries) != 1 {
+		t.Errorf("expected a single probe of the empty volume, got %q", queries)
+	}
+	if queries := vs.volumeQueries("vol3"); len(queries) < 2 {
+		t.Errorf("expected listing queries on vol3, got %q", queries)
+	}
+}
+
+func TestShardWorkers(t *testing.T) {
+	volumes := make(map[string][]StarfishEntry)
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("vol%d", i)
+		volumes[name] = volumeEntries(name, int64(i*100), fmt.Sprintf("file-%d.txt", i))
+	}
+	vs, serverURL := newVolumeServer(t, volumes)
+
+	backend := newResilienceBackend(t, serverURL, StarfishConfig{ShardVolumes: true, ShardWorkers: 2})
+	keys, err := listKeys(t, backend, "", "")
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if strings.Count(keys, ",") != 5 {
+		t.Errorf("expected 6 keys, got %q", keys)
+	}
+	if seen := vs.maxSeen.Load(); seen > 2 {
+		t.Errorf("expected at most 2 concurrent queries, got %d", seen)
+	}
+}
+
+func TestMergeListEntries(t *testing.T) {
+	entry := func(key, volume string) listEntry {
+		return listEntry{key: key, entry: StarfishEntry{Filename: key, Volume: volume}}
+	}
+	merged := mergeListEntries([][]listEntry{
+		{entry("a", "vol2"), entry("d", "vol2")},
+		nil,
+		{entry("a", "vol1"), entry("b", "vol1"), entry("e", "vol1")},
+		{entry("c", "vol3")},
+	})
+
+	var got []string
+	for _, le := range merged {
+		got = append(got, le.key+"@"+le.entry.Volume)
+	}
+	if strings.Join(got, ",") != "a@vol1,a@vol2,b@vol1,c@vol3,d@vol2,e@vol1" {
+		t.Errorf("unexpected merge order %v", got)
+	}
+}
@@ -20,17 +20,20 @@ package starfish
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"path"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/versity/versitygw/backend"
-	"github.com/versity/versitygw/metrics"
 	"github.com/versity/versitygw/s3err"
 	"github.com/versity/versitygw/s3response"
 )
@@ -56,57 +59,99 @@ func (e *StarfishError) Unwrap() error {
 	return e.Err
 }
 
-// Convert Starfish errors to S3 API errors
+// starfishErrorCodes maps StarfishError codes to S3 errors
+var starfishErrorCodes = map[string]s3err.ErrorCode{
+	"COLLECTION_NOT_FOUND":  s3err.ErrNoSuchBucket,
+	"OBJECT_NOT_FOUND":      s3err.ErrNoSuchKey,
+	"AUTHENTICATION_FAILED": s3err.ErrAccessDenied,
+	"ACCESS_DENIED":         s3err.ErrAccessDenied,
+	"RATE_LIMITED":          s3err.ErrSlowDown,
+	"API_UNAVAILABLE":       s3err.ErrServiceUnavailable,
+	"CIRCUIT_OPEN":          s3err.ErrServiceUnavailable,
+}
+
+// starfishStatusCodes maps Starfish API response statuses to S3 errors
+var starfishStatusCodes = map[int]s3err.ErrorCode{
+	http.StatusNotFound:           s3err.ErrNoSuchBucket,
+	http.StatusUnauthorized:       s3err.ErrAccessDenied,
+	http.StatusForbidden:          s3err.ErrAccessDenied,
+	http.StatusTooManyRequests:    s3err.ErrSlowDown,
+	http.StatusBadGateway:         s3err.ErrServiceUnavailable,
+	http.StatusServiceUnavailable: s3err.ErrServiceUnavailable,
+	http.StatusGatewayTimeout:     s3err.ErrServiceUnavailable,
+}
+
+// starfishErrToS3Err converts a Starfish API error to the S3 error
+// returned to the client. Errors without an S3 equivalent are returned
+// unchanged, so they are logged and answered with an InternalError.
 func starfishErrToS3Err(err error) error {
 	if err == nil {
 		return nil
 	}
 
-	// Check if it's already an S3 API error
-	if _, ok := err.(s3err.APIError); ok {
-		return err
+	var apiErr s3err.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	// The client went away or the request ran out of time, whichever
+	// Starfish call was in flight
+	if errors.Is(err, context.Canceled) {
+		return s3err.GetAPIError(s3err.ErrClientClosedRequest)
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return s3err.GetAPIError(s3err.ErrRequestTimeout)
 	}
 
-	// Check if it's a Starfish error
 	var starfishErr *StarfishError
-	if fmt.Errorf("", err).Error() == err.Error() {
-		// Try to extract Starfish error information
-		errStr := err.Error()
-		if strings.Contains(errStr, "Starfish error") {
-			// Parse Starfish error
-			if strings.Contains(errStr, "API_UNAVAILABLE") {
-				return s3err.GetAPIError(s3err.ErrInternalError)
-			}
-			if strings.Contains(errStr, "COLLECTION_NOT_FOUND") {
-				return s3err.GetAPIError(s3err.ErrNoSuchBucket)
-			}
-			if strings.Contains(errStr, "OBJECT_NOT_FOUND") {
-				return s3err.GetAPIError(s3err.ErrNoSuchKey)
-			}
-			if strings.Contains(errStr, "AUTHENTICATION_FAILED") {
-				return s3err.GetAPIError(s3err.ErrAccessDenied)
-			}
-			if strings.Contains(errStr, "RATE_LIMITED") {
-				return s3err.GetAPIError(s3err.ErrInternalError)
-			}
+	if errors.As(err, &starfishErr) {
+		if code, ok := starfishErrorCodes[starfishErr.Code]; ok {
+			return s3err.GetAPIError(code)
+		}
+	}
+
+	var accessErr *ErrStarfishAPIAccess
+	if errors.As(err, &accessErr) {
+		if code, ok := starfishStatusCodes[accessErr.StatusCode]; ok {
+			return s3err.GetAPIError(code)
 		}
 	}
 
-	// Handle HTTP errors
-	if strings.Contains(err.Error(), "connection refused") ||
-		strings.Contains(err.Error(), "no such host") {
-		return s3err.GetAPIError(s3err.ErrInternalError)
+	// Starfish could not be reached at all
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return s3err.GetAPIError(s3err.ErrServiceUnavailable)
 	}
 
-	// Default to internal error
-	return s3err.GetAPIError(s3err.ErrInternalError)
+	return err
 }
 
 // Shutdown cleans up resources
 func (b *StarfishBackend) Shutdown() {
+	b.stopCollectionsRefresh()
 	if b.cache != nil {
+		b.cache.Close()
 		b.cache.Clear()
 	}
+	b.invalidateBucket("")
+}
+
+// invalidateBucket drops the listings and resolved keys kept for a bucket,
+// or for every bucket if bucket is empty
+func (b *StarfishBackend) invalidateBucket(bucket string) {
+	b.listCache.clear(bucket)
+	b.rewriteIndex.clear(bucket)
+	b.clearVolumeShards(bucket)
+	if b.cache != nil {
+		if bucket == "" {
+			b.cache.Clear()
+		} else {
+			b.cache.InvalidatePrefix(bucket + "\x00")
+		}
+	}
 }
 
 // String returns a description of the backend
@@ -116,28 +161,6 @@ func (b *StarfishBackend) String() string {
 
 // ========== BUCKET OPERATIONS ==========
 
-// ListBuckets returns available buckets based on discovered Collection tags
-func (b *StarfishBackend) ListBuckets(_ context.Context,
-	_ *s3.ListBucketsInput) (s3response.ListBucketsResult, error) {
-	b.collectionsMux.RLock()
-	defer b.collectionsMux.RUnlock()
-
-	var buckets []s3response.Bucket
-	for bucketName := range b.collections {
-		// Create a default creation time for collections
-		// In a real implementation, you might want to get this from Starfish metadata
-		creationDate := time.Now()
-		buckets = append(buckets, s3response.Bucket{
-			Name:         &bucketName,
-			CreationDate: &creationDate,
-		})
-	}
-
-	return s3response.ListBucketsResult{
-		Buckets: buckets,
-	}, nil
-}
-
 // HeadBucket checks if a bucket exists
 func (b *StarfishBackend) HeadBucket(ctx context.Context, input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
 	bucket := *input.Bucket
@@ -160,7 +183,7 @@ func (b *StarfishBackend) ListObjects(ctx context.Context, input *s3.ListObjects
 	bucket := *input.Bucket
 	prefix := ""
 	delimiter := ""
-	startAfter := ""
+	marker := ""
 	maxKeys := 1000
 
 	if input.Prefix != nil {
@@ -170,7 +193,7 @@ func (b *StarfishBackend) ListObjects(ctx context.Context, input *s3.ListObjects
 		delimiter = *input.Delimiter
 	}
 	if input.Marker != nil {
-		startAfter = *input.Marker
+		marker = *input.Marker
 	}
 	if input.MaxKeys != nil {
 		maxKeys = int(*input.MaxKeys)
@@ -179,62 +202,13 @@ func (b *StarfishBackend) ListObjects(ctx context.Context, input *s3.ListObjects
 	// Debug output
 	fmt.Printf("DEBUG: ListObjects called for bucket=%s, prefix=%s, delimiter=%s\n", bucket, prefix, delimiter)
 
-	// Generate cache key
-	cacheKey := fmt.Sprintf("v1:%s:%s:%s", bucket, prefix, delimiter)
-
-	// Check cache first
-	if cached := b.cache.Get(cacheKey); cached != nil {
-		return b.convertToListObjectsResult(cached, bucket, prefix, delimiter, startAfter, maxKeys), nil
-	}
-
-	// Build additional query filters
-	var additionalFilters []string
-
-	// Only files (f is the type code for regular files)
-	additionalFilters = append(additionalFilters, "type=f")
-
-	// Add path/prefix filtering if specified
-	if prefix != "" {
-		// Add path filtering using parent_path or similar field
-		// For now, we'll get all files and filter in post-processing
-		// TODO: Optimize with better Starfish query filters for paths
-	}
-
-	additionalQuery := strings.Join(additionalFilters, " ")
-
-	// Query Starfish API (volumeAndPath not needed with simplified query endpoint)
-	startTime := time.Now()
-	result, err := b.QueryStarfish(ctx, bucket, "", additionalQuery)
-
-	// Record metrics
-	if b.metricsManager != nil {
-		duration := time.Since(startTime).Milliseconds()
-		b.metricsManager.Add("starfish_query_duration_ms", duration,
-			metrics.Tag{Key: "bucket", Value: bucket},
-			metrics.Tag{Key: "operation", Value: "ListObjects"})
-
-		if err != nil {
-			b.metricsManager.Add("starfish_query_errors", 1,
-				metrics.Tag{Key: "bucket", Value: bucket},
-				metrics.Tag{Key: "operation", Value: "ListObjects"})
-		} else {
-			b.metricsManager.Add("starfish_query_success", 1,
-				metrics.Tag{Key: "bucket", Value: bucket},
-				metrics.Tag{Key: "operation", Value: "ListObjects"})
-			b.metricsManager.Add("starfish_objects_returned", int64(len(result.Entries)),
-				metrics.Tag{Key: "bucket", Value: bucket})
-		}
-	}
-
+	page, err := b.listObjects(ctx, "ListObjects", bucket, prefix, delimiter, marker, maxKeys)
 	if err != nil {
-		return s3response.ListObjectsResult{}, starfishErrToS3Err(err)
+		return s3response.ListObjectsResult{}, err
 	}
 
-	// Cache the result
-	b.cache.Set(cacheKey, result, bucket)
-
 	// Convert to S3 ListObjects result
-	return b.convertToListObjectsResult(result, bucket, prefix, delimiter, startAfter, maxKeys), nil
+	return b.convertToListObjectsResult(page, bucket, prefix, delimiter, marker, maxKeys), nil
 }
 
 // ListObjectsV2 implements the S3 ListObjectsV2 operation
@@ -243,6 +217,7 @@ func (b *StarfishBackend) ListObjectsV2(ctx context.Context, input *s3.ListObjec
 	prefix := ""
 	delimiter := ""
 	startAfter := ""
+	continuationToken := ""
 	maxKeys := 1000
 
 	if input.Prefix != nil {
@@ -254,6 +229,9 @@ func (b *StarfishBackend) ListObjectsV2(ctx context.Context, input *s3.ListObjec
 	if input.StartAfter != nil {
 		startAfter = *input.StartAfter
 	}
+	if input.ContinuationToken != nil {
+		continuationToken = *input.ContinuationToken
+	}
 	if input.MaxKeys != nil {
 		maxKeys = int(*input.MaxKeys)
 	}
@@ -261,173 +239,61 @@ func (b *StarfishBackend) ListObjectsV2(ctx context.Context, input *s3.ListObjec
 	// Debug output
 	fmt.Printf("DEBUG: ListObjectsV2 called for bucket=%s, prefix=%s, delimiter=%s\n", bucket, prefix, delimiter)
 
-	// Generate cache key
-	cacheKey := fmt.Sprintf("v2:%s:%s:%s", bucket, prefix, delimiter)
-
-	// Check cache first
-	if cached := b.cache.Get(cacheKey); cached != nil {
-		return b.convertToListObjectsV2Result(cached, bucket, prefix, delimiter, startAfter, maxKeys), nil
+	// The continuation token carries the last key returned and takes
+	// precedence over StartAfter
+	marker, err := parseContinuationToken(continuationToken, bucket, prefix, delimiter)
+	if err != nil {
+		return s3response.ListObjectsV2Result{}, err
 	}
-
-	// Build additional query filters
-	var additionalFilters []string
-
-	// Only files (f is the type code for regular files)
-	additionalFilters = append(additionalFilters, "type=f")
-
-	// Add path/prefix filtering if specified
-	if prefix != "" {
-		// Add path filtering using parent_path or similar field
-		// For now, we'll get all files and filter in post-processing
-		// TODO: Optimize with better Starfish query filters for paths
-	}
-
-	additionalQuery := strings.Join(additionalFilters, " ")
-
-	// Query Starfish API (volumeAndPath not needed with simplified query endpoint)
-	startTime := time.Now()
-	result, err := b.QueryStarfish(ctx, bucket, "", additionalQuery)
-
-	// Record metrics
-	if b.metricsManager != nil {
-		duration := time.Since(startTime).Milliseconds()
-		b.metricsManager.Add("starfish_query_duration_ms", duration,
-			metrics.Tag{Key: "bucket", Value: bucket},
-			metrics.Tag{Key: "operation", Value: "ListObjectsV2"})
-
-		if err != nil {
-			b.metricsManager.Add("starfish_query_errors", 1,
-				metrics.Tag{Key: "bucket", Value: bucket},
-				metrics.Tag{Key: "operation", Value: "ListObjectsV2"})
-		} else {
-			b.metricsManager.Add("starfish_query_success", 1,
-				metrics.Tag{Key: "bucket", Value: bucket},
-				metrics.Tag{Key: "operation", Value: "ListObjectsV2"})
-			b.metricsManager.Add("starfish_objects_returned", int64(len(result.Entries)),
-				metrics.Tag{Key: "bucket", Value: bucket})
-		}
+	if continuationToken == "" {
+		marker = startAfter
 	}
 
+	page, err := b.listObjects(ctx, "ListObjectsV2", bucket, prefix, delimiter, marker, maxKeys)
 	if err != nil {
-		return s3response.ListObjectsV2Result{}, starfishErrToS3Err(err)
+		return s3response.ListObjectsV2Result{}, err
 	}
 
-	// Cache the result
-	b.cache.Set(cacheKey, result, bucket)
-
 	// Convert to S3 ListObjectsV2 result
-	return b.convertToListObjectsV2Result(result, bucket, prefix, delimiter, startAfter, maxKeys), nil
+	return b.convertToListObjectsV2Result(page, bucket, prefix, delimiter, startAfter, continuationToken, maxKeys), nil
 }
 
-// convertToListObjectsResult converts Starfish entries to S3 ListObjects format
-func (b *StarfishBackend) convertToListObjectsResult(starfishResult *StarfishQueryResponse, bucket, prefix, delimiter, startAfter string, maxKeys int) s3response.ListObjectsResult {
-	var contents []s3response.Object
-	var commonPrefixes []types.CommonPrefix
-	isTruncated := false
-
-	count := 0
-	for _, entry := range starfishResult.Entries {
-		if maxKeys > 0 && count >= maxKeys {
-			isTruncated = true
-			break
-		}
-
-		// Build S3 object key from Starfish entry with bucket context
-		objectKey := b.buildObjectKeyFromEntryWithBucket(entry, bucket)
-
-		// Skip if before startAfter
-		if startAfter != "" && objectKey <= startAfter {
-			continue
-		}
-
-		// Handle delimiter logic for common prefixes
-		if delimiter != "" && b.shouldBeCommonPrefix(objectKey, prefix, delimiter) {
-			commonPrefix := b.getCommonPrefix(objectKey, prefix, delimiter)
-			if !b.containsCommonPrefix(commonPrefixes, commonPrefix) {
-				commonPrefixes = append(commonPrefixes, types.CommonPrefix{
-					Prefix: &commonPrefix,
-				})
-			}
-			continue
-		}
-
-		// Add as regular object
-		eTag := b.generateETag(entry)
-		modifyTime := entry.GetModifyTime()
-		contents = append(contents, s3response.Object{
-			Key:          &objectKey,
-			Size:         &entry.Size,
-			LastModified: &modifyTime,
-			ETag:         &eTag,
-		})
-		count++
-	}
-
+// convertToListObjectsResult converts a collected listing page to S3 ListObjects format
+func (b *StarfishBackend) convertToListObjectsResult(page listPage, bucket, prefix, delimiter, marker string, maxKeys int) s3response.ListObjectsResult {
 	bucketName := bucket
-
+	isTruncated := page.IsTruncated
 	maxKeysPtr := int32(maxKeys)
-	return s3response.ListObjectsResult{
-		Contents:       contents,
-		CommonPrefixes: commonPrefixes,
+
+	result := s3response.ListObjectsResult{
+		Contents:       page.Contents,
+		CommonPrefixes: page.CommonPrefixes,
 		IsTruncated:    &isTruncated,
 		MaxKeys:        &maxKeysPtr,
 		Name:           &bucketName,
 		Prefix:         &prefix,
 		Delimiter:      &delimiter,
+		Marker:         &marker,
 	}
-}
-
-// convertToListObjectsV2Result converts Starfish entries to S3 ListObjectsV2 format
-func (b *StarfishBackend) convertToListObjectsV2Result(starfishResult *StarfishQueryResponse, bucket, prefix, delimiter, startAfter string, maxKeys int) s3response.ListObjectsV2Result {
-	var contents []s3response.Object
-	var commonPrefixes []types.CommonPrefix
-	isTruncated := false
-
-	count := 0
-	for _, entry := range starfishResult.Entries {
-		if maxKeys > 0 && count >= maxKeys {
-			isTruncated = true
-			break
-		}
-
-		// Build S3 object key from Starfish entry with bucket context
-		objectKey := b.buildObjectKeyFromEntryWithBucket(entry, bucket)
-
-		// Skip if before startAfter
-		if startAfter != "" && objectKey <= startAfter {
-			continue
-		}
-
-		// Handle delimiter logic for common prefixes
-		if delimiter != "" && b.shouldBeCommonPrefix(objectKey, prefix, delimiter) {
-			commonPrefix := b.getCommonPrefix(objectKey, prefix, delimiter)
-			if !b.containsCommonPrefix(commonPrefixes, commonPrefix) {
-				commonPrefixes = append(commonPrefixes, types.CommonPrefix{
-					Prefix: &commonPrefix,
-				})
-			}
-			continue
-		}
 
-		// Add as regular object
-		eTag := b.generateETag(entry)
-		modifyTime := entry.GetModifyTime()
-		contents = append(contents, s3response.Object{
-			Key:          &objectKey,
-			Size:         &entry.Size,
-			LastModified: &modifyTime,
-			ETag:         &eTag,
-		})
-		count++
+	// Clients pass NextMarker back as the marker for the next request
+	if page.IsTruncated {
+		nextMarker := page.NextMarker
+		result.NextMarker = &nextMarker
 	}
 
+	return result
+}
+
+// convertToListObjectsV2Result converts a collected listing page to S3 ListObjectsV2 format
+func (b *StarfishBackend) convertToListObjectsV2Result(page listPage, bucket, prefix, delimiter, startAfter, continuationToken string, maxKeys int) s3response.ListObjectsV2Result {
 	bucketName := bucket
+	isTruncated := page.IsTruncated
 	maxKeysPtr := int32(maxKeys)
-	keyCount := int32(len(contents))
+	keyCount := int32(len(page.Contents) + len(page.CommonPrefixes))
 
-	return s3response.ListObjectsV2Result{
-		Contents:       contents,
-		CommonPrefixes: commonPrefixes,
+	result := s3response.ListObjectsV2Result{
+		Contents:       page.Contents,
+		CommonPrefixes: page.CommonPrefixes,
 		IsTruncated:    &isTruncated,
 		MaxKeys:        &maxKeysPtr,
 		Name:           &bucketName,
@@ -436,6 +302,21 @@ func (b *StarfishBackend) convertToListObjectsV2Result(starfishResult *StarfishQ
 		KeyCount:       &keyCount,
 		StartAfter:     &startAfter,
 	}
+
+	if continuationToken != "" {
+		result.ContinuationToken = &continuationToken
+	}
+	if page.IsTruncated {
+		nextToken := listToken{
+			Bucket:    bucket,
+			Prefix:    prefix,
+			Delimiter: delimiter,
+			Marker:    page.NextMarker,
+		}.encode()
+		result.NextContinuationToken = &nextToken
+	}
+
+	return result
 }
 
 // HeadObject retrieves metadata for a single object
@@ -443,40 +324,56 @@ func (b *StarfishBackend) HeadObject(ctx context.Context, input *s3.HeadObjectIn
 	bucket := *input.Bucket
 	object := *input.Key
 
-	// Query Starfish to get file metadata
-	additionalQuery := "type=f"
-
-	result, err := b.QueryStarfish(ctx, bucket, "", additionalQuery)
+	// Find the entry behind the key, which may have been rewritten
+	entry, err := b.resolveObject(ctx, "HeadObject", bucket, object)
 	if err != nil {
-		return nil, starfishErrToS3Err(err)
+		return nil, err
 	}
 
-	// Find the matching file by object key in the results
-	var foundEntry *StarfishEntry
-	for _, entry := range result.Entries {
-		entryKey := b.buildObjectKeyFromEntryWithBucket(entry, bucket)
-		if entryKey == object {
-			foundEntry = &entry
-			break
-		}
+	// Build response
+	eTag, err := b.objectETag(ctx, entry, bucket)
+	if err != nil {
+		return nil, err
 	}
+	modifyTime := entry.GetModifyTime()
 
-	if foundEntry == nil {
-		return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
+	if err := checkConditions(eTag, modifyTime, input.IfMatch, input.IfNoneMatch,
+		input.IfModifiedSince, input.IfUnmodifiedSince); err != nil {
+		return nil, err
 	}
 
-	entry := *foundEntry
+	startOffset, length, isValid, err := backend.ParseObjectRange(entry.Size, backend.GetStringFromPtr(input.Range))
+	if err != nil {
+		return nil, err
+	}
 
-	// Build response
-	eTag := b.generateETag(entry)
-	modifyTime := entry.GetModifyTime()
-	contentLength := entry.Size
+	var contentRange *string
+	if isValid {
+		contentRange = backend.GetPtrFromString(fmt.Sprintf("bytes %v-%v/%v",
+			startOffset, startOffset+length-1, entry.Size))
+	}
 
-	return &s3.HeadObjectOutput{
+	output := &s3.HeadObjectOutput{
 		ETag:          &eTag,
 		LastModified:  &modifyTime,
-		ContentLength: &contentLength,
-	}, nil
+		ContentLength: &length,
+		ContentRange:  contentRange,
+		AcceptRanges:  backend.GetPtrFromString("bytes"),
+		TagCount:      b.tagCount(entry),
+		ContentType:   contentType(entry),
+		Metadata:      objectMetadata(entry),
+	}
+
+	if input.ChecksumMode == types.ChecksumModeEnabled && b.hashCache != nil {
+		hashes, err := b.contentHashes(ctx, entry, bucket)
+		if err != nil {
+			return nil, err
+		}
+		output.ChecksumSHA256 = &hashes.SHA256
+		output.ChecksumCRC32C = &hashes.CRC32C
+	}
+
+	return output, nil
 }
 
 // GetObject retrieves object content via the starfish file server
@@ -489,47 +386,33 @@ func (b *StarfishBackend) GetObject(ctx context.Context, input *s3.GetObjectInpu
 		return nil, s3err.GetAPIError(s3err.ErrNotImplemented)
 	}
 
-	// Get file metadata first using HeadObject
-	headInput := &s3.HeadObjectInput{
-		Bucket: input.Bucket,
-		Key:    input.Key,
-	}
-
-	headResult, err := b.HeadObject(ctx, headInput)
+	// Find the entry behind the key to get its metadata, volume and path
+	entry, err := b.resolveObject(ctx, "GetObject", bucket, object)
 	if err != nil {
 		return nil, err
 	}
-
-	// Query Starfish to get volume and path information for the file
-	additionalQuery := "type=f"
-
-	result, err := b.QueryStarfish(ctx, bucket, "", additionalQuery)
+	eTag, err := b.objectETag(ctx, entry, bucket)
 	if err != nil {
-		return nil, starfishErrToS3Err(err)
+		return nil, err
 	}
+	modifyTime := entry.GetModifyTime()
 
-	// Find the matching file by object key in the results
-	var foundEntry *StarfishEntry
-	for _, entry := range result.Entries {
-		entryKey := b.buildObjectKeyFromEntryWithBucket(entry, bucket)
-		if entryKey == object {
-			foundEntry = &entry
-			break
-		}
+	// Evaluate conditions against the Starfish metadata first, so requests
+	// that would fail never reach the file server
+	if err := checkConditions(eTag, modifyTime, input.IfMatch, input.IfNoneMatch,
+		input.IfModifiedSince, input.IfUnmodifiedSince); err != nil {
+		return nil, err
 	}
 
-	if foundEntry == nil {
-		return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
+	startOffset, length, isValid, err := backend.ParseObjectRange(entry.Size, backend.GetStringFromPtr(input.Range))
+	if err != nil {
+		return nil, err
 	}
 
-	entry := *foundEntry
-
 	// Get the file content from the file server
 	// URL format: {fileServerURL}/{volume}/{path}
-	filePath := object
-	if entry.FullPath != "" {
-		filePath = strings.TrimPrefix(entry.FullPath, "/")
-	}
+	// The object key may be rewritten, so always use the Starfish path
+	filePath := b.buildObjectKeyFromEntryWithBucket(entry, bucket)
 
 	fileURL := fmt.Sprintf("%s/%s/%s", b.fileServerURL, entry.Volume, filePath)
 
@@ -542,172 +425,121 @@ func (b *StarfishBackend) GetObject(ctx context.Context, input *s3.GetObjectInpu
 	// Add internal security header for file server authentication
 	req.Header.Set("X-Internal-Token", b.bearerToken)
 
+	// Forward the range and conditions, the file server checks them again
+	// against the file itself in case it changed since Starfish indexed it
+	var contentRange *string
+	if isValid {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-%v", startOffset, startOffset+length-1))
+		contentRange = backend.GetPtrFromString(fmt.Sprintf("bytes %v-%v/%v",
+			startOffset, startOffset+length-1, entry.Size))
+	}
+	if b.hashCache == nil {
+		setConditionalHeaders(req.Header, input.IfMatch, input.IfNoneMatch,
+			input.IfModifiedSince, input.IfUnmodifiedSince)
+	} else {
+		// The file server only knows size-mtime ETags, content ETags were
+		// checked above
+		setConditionalHeaders(req.Header, nil, nil,
+			input.IfModifiedSince, input.IfUnmodifiedSince)
+	}
+
 	resp, err := b.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch file from file server: %w", err)
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
+	expectedStatus := http.StatusOK
+	if isValid {
+		expectedStatus = http.StatusPartialContent
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != expectedStatus {
 		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
+		case http.StatusNotModified:
+			return nil, s3err.GetAPIError(s3err.ErrNotModified)
+		case http.StatusPreconditionFailed:
+			return nil, s3err.GetAPIError(s3err.ErrPreconditionFailed)
+		case http.StatusRequestedRangeNotSatisfiable:
+			return nil, s3err.GetAPIError(s3err.ErrInvalidRange)
+		}
 		return nil, fmt.Errorf("file server returned status %d", resp.StatusCode)
 	}
 
 	// Return the response body as the object content
 	return &s3.GetObjectOutput{
 		Body:          resp.Body,
-		ETag:          headResult.ETag,
-		LastModified:  headResult.LastModified,
-		ContentLength: headResult.ContentLength,
+		ETag:          &eTag,
+		LastModified:  &modifyTime,
+		ContentLength: &length,
+		ContentRange:  contentRange,
+		AcceptRanges:  backend.GetPtrFromString("bytes"),
+		TagCount:      b.tagCount(entry),
+		ContentType:   contentType(entry),
+		Metadata:      objectMetadata(entry),
 	}, nil
 }
 
-// ========== ACCESS CONTROL INTEGRATION ==========
-
-// GetBucketAcl retrieves the ACL for a bucket (collection)
-func (b *StarfishBackend) GetBucketAcl(ctx context.Context, input *s3.GetBucketAclInput) ([]byte, error) {
-	bucket := *input.Bucket
-
-	// Check if bucket exists
-	b.collectionsMux.RLock()
-	_, exists := b.collections[bucket]
-	b.collectionsMux.RUnlock()
-
-	if !exists {
-		return nil, s3err.GetAPIError(s3err.ErrNoSuchBucket)
-	}
-
-	// For now, return a default ACL that grants full control to the bucket owner
-	// In a real implementation, you might want to store ACLs in Starfish metadata
-	defaultACL := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<AccessControlPolicy xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
-  <Owner>
-    <ID>starfish-collection-owner</ID>
-    <DisplayName>Starfish Collection Owner</DisplayName>
-  </Owner>
-  <AccessControlList>
-    <Grant>
-      <Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser">
-        <ID>starfish-collection-owner</ID>
-        <DisplayName>Starfish Collection Owner</DisplayName>
-      </Grantee>
-      <Permission>FULL_CONTROL</Permission>
-    </Grant>
-  </AccessControlList>
-</AccessControlPolicy>`)
-
-	return []byte(defaultACL), nil
-}
-
-// PutBucketAcl sets the ACL for a bucket (collection)
-func (b *StarfishBackend) PutBucketAcl(ctx context.Context, bucket string, data []byte) error {
-	// Check if bucket exists
-	b.collectionsMux.RLock()
-	_, exists := b.collections[bucket]
-	b.collectionsMux.RUnlock()
-
-	if !exists {
-		return s3err.GetAPIError(s3err.ErrNoSuchBucket)
-	}
-
-	// For now, we'll just validate that the ACL is well-formed XML
-	// In a real implementation, you might want to store ACLs in Starfish metadata
-	if len(data) == 0 {
-		return fmt.Errorf("empty ACL data")
-	}
-
-	// Basic XML validation - check if it contains required elements
-	aclStr := string(data)
-	if !strings.Contains(aclStr, "<AccessControlPolicy>") {
-		return fmt.Errorf("invalid ACL format: missing AccessControlPolicy")
+// GetObjectAttributes retrieves the attributes of a single object
+func (b *StarfishBackend) GetObjectAttributes(ctx context.Context, input *s3.GetObjectAttributesInput) (s3response.GetObjectAttributesResponse, error) {
+	// Checksums are only available with content hashes enabled
+	var checksumMode types.ChecksumMode
+	if b.hashCache != nil && slices.Contains(input.ObjectAttributes, types.ObjectAttributesChecksum) {
+		checksumMode = types.ChecksumModeEnabled
 	}
 
-	// TODO: Store ACL in Starfish metadata or external storage
-	// For now, we'll just accept the ACL without storing it
-	fmt.Printf("DEBUG: ACL for bucket %s would be stored: %s\n", bucket, string(data))
-
-	return nil
-}
-
-// GetBucketPolicy retrieves the bucket policy for a collection
-func (b *StarfishBackend) GetBucketPolicy(ctx context.Context, input *s3.GetBucketPolicyInput) ([]byte, error) {
-	bucket := *input.Bucket
-
-	// Check if bucket exists
-	b.collectionsMux.RLock()
-	_, exists := b.collections[bucket]
-	b.collectionsMux.RUnlock()
-
-	if !exists {
-		return nil, s3err.GetAPIError(s3err.ErrNoSuchBucket)
-	}
-
-	// For now, return no policy (which means no bucket policy exists)
-	// In a real implementation, you might want to store policies in Starfish metadata
-	return nil, s3err.GetAPIError(s3err.ErrNoSuchBucketPolicy)
-}
-
-// PutBucketPolicy sets the bucket policy for a collection
-func (b *StarfishBackend) PutBucketPolicy(ctx context.Context, bucket string, data []byte) error {
-	// Check if bucket exists
-	b.collectionsMux.RLock()
-	_, exists := b.collections[bucket]
-	b.collectionsMux.RUnlock()
-
-	if !exists {
-		return s3err.GetAPIError(s3err.ErrNoSuchBucket)
-	}
-
-	// Validate JSON policy
-	var policy map[string]interface{}
-	if err := json.Unmarshal(data, &policy); err != nil {
-		return fmt.Errorf("invalid bucket policy JSON: %w", err)
+	data, err := b.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       input.Bucket,
+		Key:          input.Key,
+		ChecksumMode: checksumMode,
+	})
+	if err != nil {
+		return s3response.GetObjectAttributesResponse{}, err
 	}
 
-	// TODO: Store policy in Starfish metadata or external storage
-	// For now, we'll just accept the policy without storing it
-	fmt.Printf("DEBUG: Policy for bucket %s would be stored: %s\n", bucket, string(data))
-
-	return nil
-}
-
-// DeleteBucketPolicy deletes the bucket policy for a collection
-func (b *StarfishBackend) DeleteBucketPolicy(ctx context.Context, input *s3.DeleteBucketPolicyInput) error {
-	bucket := *input.Bucket
-
-	// Check if bucket exists
-	b.collectionsMux.RLock()
-	_, exists := b.collections[bucket]
-	b.collectionsMux.RUnlock()
-
-	if !exists {
-		return s3err.GetAPIError(s3err.ErrNoSuchBucket)
+	var checksum *types.Checksum
+	if data.ChecksumSHA256 != nil {
+		checksum = &types.Checksum{
+			ChecksumSHA256: data.ChecksumSHA256,
+			ChecksumCRC32C: data.ChecksumCRC32C,
+			ChecksumType:   types.ChecksumTypeFullObject,
+		}
 	}
 
-	// TODO: Remove policy from Starfish metadata or external storage
-	fmt.Printf("DEBUG: Policy for bucket %s would be deleted\n", bucket)
-
-	return nil
+	return s3response.GetObjectAttributesResponse{
+		ETag:         backend.TrimEtag(data.ETag),
+		ObjectSize:   data.ContentLength,
+		LastModified: data.LastModified,
+		Checksum:     checksum,
+	}, nil
 }
 
 // ========== HELPER METHODS ==========
 
 // buildObjectKeyFromEntryWithBucket builds an S3 object key from a Starfish entry
 func (b *StarfishBackend) buildObjectKeyFromEntryWithBucket(entry StarfishEntry, bucket string) string {
+	return originalObjectKey(entry)
+}
+
+// originalObjectKey returns the object key of a Starfish entry before any
+// path rewrite rules are applied
+func originalObjectKey(entry StarfishEntry) string {
 	// If we have a full path, use it
 	if entry.FullPath != "" {
-		return strings.TrimPrefix(entry.FullPath, "/")
+		return entry.FullPath
 	}
 
 	// Otherwise, build from parent path and filename
-	if entry.ParentPath != "" {
-		return filepath.Join(entry.ParentPath, entry.Filename)
-	}
+	return path.Join(entry.ParentPath, entry.Filename)
+}
 
-	return entry.Filename
+// objectKeyForEntry returns the S3 object key presented in listings for a
+// Starfish entry, with any path rewrite rules for the bucket applied
+func (b *StarfishBackend) objectKeyForEntry(entry StarfishEntry, bucket string) string {
+	originalKey := b.buildObjectKeyFromEntryWithBucket(entry, bucket)
+	return b.applyPathRewrite(entry, originalKey, bucket)
 }
 
 // shouldBeCommonPrefix determines if an object should be treated as a common prefix
@@ -738,16 +570,59 @@ func (b *StarfishBackend) getCommonPrefix(objectKey, prefix, delimiter string) s
 	return prefix + afterPrefix[:delimiterIndex+len(delimiter)]
 }
 
-// containsCommonPrefix checks if a common prefix already exists in the list
-func (b *StarfishBackend) containsCommonPrefix(commonPrefixes []types.CommonPrefix, newPrefix string) bool {
-	for _, cp := range commonPrefixes {
-		if *cp.Prefix == newPrefix {
+// checkConditions evaluates the conditional request headers of a GET or
+// HEAD against the object ETag and modification time. If-Match and
+// If-None-Match take precedence over the date based conditions.
+func checkConditions(eTag string, modTime time.Time, ifMatch, ifNoneMatch *string, ifModifiedSince, ifUnmodifiedSince *time.Time) error {
+	if ifMatch != nil && *ifMatch != "" {
+		if !etagMatches(eTag, *ifMatch) {
+			return s3err.GetAPIError(s3err.ErrPreconditionFailed)
+		}
+	} else if ifUnmodifiedSince != nil && modTime.After(*ifUnmodifiedSince) {
+		return s3err.GetAPIError(s3err.ErrPreconditionFailed)
+	}
+
+	if ifNoneMatch != nil && *ifNoneMatch != "" {
+		if etagMatches(eTag, *ifNoneMatch) {
+			return s3err.GetAPIError(s3err.ErrNotModified)
+		}
+	} else if ifModifiedSince != nil && !modTime.After(*ifModifiedSince) {
+		return s3err.GetAPIError(s3err.ErrNotModified)
+	}
+
+	return nil
+}
+
+// etagMatches reports whether an ETag matches a comma separated list of
+// ETags from a conditional header, ignoring quotes
+func etagMatches(eTag, header string) bool {
+	eTag = strings.Trim(eTag, "\"")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.Trim(strings.TrimSpace(candidate), "\"")
+		if candidate == "*" || candidate == eTag {
 			return true
 		}
 	}
 	return false
 }
 
+// setConditionalHeaders copies the conditions of a GET request onto the
+// request sent to the file server
+func setConditionalHeaders(header http.Header, ifMatch, ifNoneMatch *string, ifModifiedSince, ifUnmodifiedSince *time.Time) {
+	if ifMatch != nil && *ifMatch != "" {
+		header.Set("If-Match", *ifMatch)
+	}
+	if ifNoneMatch != nil && *ifNoneMatch != "" {
+		header.Set("If-None-Match", *ifNoneMatch)
+	}
+	if ifModifiedSince != nil {
+		header.Set("If-Modified-Since", ifModifiedSince.UTC().Format(http.TimeFormat))
+	}
+	if ifUnmodifiedSince != nil {
+		header.Set("If-Unmodified-Since", ifUnmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+}
+
 // generateETag generates an ETag for a Starfish entry
 func (b *StarfishBackend) generateETag(entry StarfishEntry) string {
 	// For now, use a simple ETag based on file size and modification time
@@ -755,69 +630,172 @@ func (b *StarfishBackend) generateETag(entry StarfishEntry) string {
 	return fmt.Sprintf("\"%d-%d\"", entry.Size, entry.ModifyTimeUnix)
 }
 
-// InitializeCollections discovers Collections: tagset tags from Starfish
-func (b *StarfishBackend) InitializeCollections(ctx context.Context) error {
-	// Query Starfish for all Collections: tags
-	queryURL := fmt.Sprintf("%s/tagsets/Collections:/tags", b.apiEndpoint)
+// Sources of the buckets served by the gateway
+const (
+	BucketSourceTagset = "tagset" // tags of a tagset, files are matched by tag
+	BucketSourceZone   = "zone"   // Starfish zones, files are matched by zone
+	BucketSourceVolume = "volume" // Starfish volumes, files are matched by volume
 
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	defaultBucketTagset = "Collections"
+)
+
+// InitializeCollections discovers the buckets of the configured bucket
+// source from Starfish
+func (b *StarfishBackend) InitializeCollections(ctx context.Context) error {
+	var (
+		found map[string]string
+		err   error
+	)
+	switch b.bucketSource {
+	case BucketSourceZone:
+		found, err = b.discoverZones(ctx)
+	case BucketSourceVolume:
+		found, err = b.discoverVolumes(ctx)
+	default:
+		found, err = b.discoverTagsetTags(ctx)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create collections request: %w", err)
+		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+b.bearerToken)
-	req.Header.Set("Content-Type", "application/json")
+	collections, warnings := assignBucketNames(found, b.bucketAliases)
+	warnings = append(warnings, addVirtualBuckets(collections, b.virtualBuckets)...)
 
-	resp, err := b.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to fetch collections: %w", err)
+	// Update the collections map
+	b.collectionsMux.Lock()
+	previous, loaded := b.collections, b.collectionsLoaded
+	previousWarnings := b.bucketNameWarnings
+	b.collections = collections
+	b.collectionsLoaded = true
+	b.bucketNameWarnings = warnings
+	b.collectionsMux.Unlock()
+
+	// Report names that could not be served once, not on every refresh
+	if !slices.Equal(warnings, previousWarnings) {
+		for _, warning := range warnings {
+			fmt.Printf("[WARN] %s\n", warning)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("collections API returned status %d: %s", resp.StatusCode, string(body))
+	fmt.Printf("DEBUG: Discovered %d collections from %s source\n", len(collections), b.bucketSource)
+
+	if !loaded {
+		b.invalidateBucket("")
+		return nil
 	}
 
-	// Parse the response - expect an array of tag names
-	var tagNames []string
-	if err := json.NewDecoder(resp.Body).Decode(&tagNames); err != nil {
-		return fmt.Errorf("failed to decode collections response: %w", err)
+	// Cached listings may belong to collections that are gone or now map
+	// to another tag, zone or volume
+	added, removed := diffCollections(previous, collections)
+	for _, bucket := range removed {
+		b.invalidateBucket(bucket)
+	}
+	for bucket, source := range collections {
+		if prev, ok := previous[bucket]; ok && prev != source {
+			b.invalidateBucket(bucket)
+		}
 	}
+	b.reportCollectionChanges(added, removed)
+	return nil
+}
 
-	// Update the collections map
-	b.collectionsMux.Lock()
-	defer b.collectionsMux.Unlock()
+// discoverTagsetTags returns the full tag of each tag of the bucket
+// tagset by tag name
+func (b *StarfishBackend) discoverTagsetTags(ctx context.Context) (map[string]string, error) {
+	body, err := b.fetchBucketSource(ctx, fmt.Sprintf("/tagsets/%s:/tags", url.PathEscape(b.bucketTagset)))
+	if err != nil {
+		return nil, err
+	}
 
-	// Clear existing collections and add new ones
-	b.collections = make(map[string]string)
+	// Expect an array of tag names, older Starfish releases wrap the
+	// array in a "tags" object
+	var tagNames []string
+	if err := json.Unmarshal(body, &tagNames); err != nil {
+		var legacy StarfishTagsResponse
+		if err := json.Unmarshal(body, &legacy); err != nil {
+			return nil, fmt.Errorf("failed to decode collections response: %w", err)
+		}
+		tagNames = legacy.Tags
+	}
+
+	found := make(map[string]string, len(tagNames))
 	for _, tagName := range tagNames {
-		// The tag name becomes the bucket name
-		b.collections[tagName] = fmt.Sprintf("Collections:%s", tagName)
+		found[tagName] = fmt.Sprintf("%s:%s", b.bucketTagset, tagName)
 	}
+	return found, nil
+}
 
-	fmt.Printf("DEBUG: Discovered %d collections: %v\n", len(b.collections), tagNames)
-	return nil
+// discoverZones returns the Starfish zones by name
+func (b *StarfishBackend) discoverZones(ctx context.Context) (map[string]string, error) {
+	body, err := b.fetchBucketSource(ctx, "/zone/")
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []StarfishZone
+	if err := json.Unmarshal(body, &zones); err != nil {
+		return nil, fmt.Errorf("failed to decode zones response: %w", err)
+	}
+
+	found := make(map[string]string, len(zones))
+	for _, zone := range zones {
+		if zone.Name == "" {
+			continue
+		}
+		found[zone.Name] = zone.Name
+	}
+	return found, nil
 }
 
-// GetCollectionTag returns the Collections: tagset tag for a given bucket name
-func (b *StarfishBackend) GetCollectionTag(bucketName string) (string, bool) {
-	b.collectionsMux.RLock()
-	defer b.collectionsMux.RUnlock()
+// discoverVolumes returns the Starfish volumes by name
+func (b *StarfishBackend) discoverVolumes(ctx context.Context) (map[string]string, error) {
+	body, err := b.fetchBucketSource(ctx, "/volume/")
+	if err != nil {
+		return nil, err
+	}
 
-	tag, exists := b.collections[bucketName]
-	return tag, exists
+	var volumes []StarfishVolume
+	if err := json.Unmarshal(body, &volumes); err != nil {
+		return nil, fmt.Errorf("failed to decode volumes response: %w", err)
+	}
+
+	found := make(map[string]string, len(volumes))
+	for _, volume := range volumes {
+		if volume.Vol == "" {
+			continue
+		}
+		found[volume.Vol] = volume.Vol
+	}
+	return found, nil
 }
 
-// GetAllCollections returns all discovered collections
-func (b *StarfishBackend) GetAllCollections() map[string]string {
-	b.collectionsMux.RLock()
-	defer b.collectionsMux.RUnlock()
+// fetchBucketSource returns the body of a Starfish API request listing
+// the buckets of the bucket source
+func (b *StarfishBackend) fetchBucketSource(ctx context.Context, apiPath string) ([]byte, error) {
+	queryURL := strings.TrimSuffix(b.apiEndpoint, "/") + apiPath
+
+	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create collections request: %w", err)
+	}
 
-	// Return a copy to avoid race conditions
-	result := make(map[string]string)
-	for k, v := range b.collections {
-		result[k] = v
+	req.Header.Set("Authorization", "Bearer "+b.bearerToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch collections: %w", err)
 	}
-	return result
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("collections API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collections response: %w", err)
+	}
+	return body, nil
 }
@@ -19,14 +19,28 @@ package starfish
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/versity/versitygw/s3err"
 	"github.com/versity/versitygw/s3response"
 )
 
@@ -410,3 +424,1093 @@ func TestInitializeCollections(t *testing.T) {
 		}
 	}
 }
+
+func TestBucketSources(t *testing.T) {
+	tests := []struct {
+		source     string
+		tagset     string
+		apiPath    string
+		response   string
+		bucket     string
+		mapsTo     string
+		query      string
+		volumePath string
+	}{
+		{
+			source:   BucketSourceTagset,
+			tagset:   "Projects",
+			apiPath:  "/tagsets/Projects:/tags",
+			response: `["Genome"]`,
+			bucket:   "genome",
+			mapsTo:   "Projects:Genome",
+			query:    "tag=Projects:Genome",
+		},
+		{
+			source:   BucketSourceZone,
+			apiPath:  "/zone/",
+			response: `[{"id": 1, "name": "Lab Data", "relative_path": "lab"}]`,
+			bucket:   "lab-data",
+			mapsTo:   "Lab Data",
+			query:    `zone="Lab Data"`,
+		},
+		{
+			source:     BucketSourceVolume,
+			apiPath:    "/volume/",
+			response:   `[{"id": 1, "vol": "Archive", "display_name": "Archive Volume"}]`,
+			bucket:     "archive",
+			mapsTo:     "Archive",
+			volumePath: "Archive:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			var query, volumePath string
+			server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/query/" {
+					query = r.URL.Query().Get("query")
+					volumePath = r.URL.Query().Get("volumes_and_paths")
+					io.WriteString(w, "[]")
+					return
+				}
+				if r.URL.Path != tt.apiPath {
+					t.Errorf("expected buckets from %s, got %s", tt.apiPath, r.URL.Path)
+					http.NotFound(w, r)
+					return
+				}
+				io.WriteString(w, tt.response)
+			})
+			defer server.Close()
+
+			backend, err := NewStarfishBackend(&StarfishConfig{
+				APIEndpoint:  server.URL,
+				BearerToken:  "test-token",
+				CacheTTL:     time.Minute,
+				BucketSource: tt.source,
+				BucketTagset: tt.tagset,
+			})
+			if err != nil {
+				t.Fatalf("failed to create backend: %v", err)
+			}
+
+			if err := backend.InitializeCollections(context.Background()); err != nil {
+				t.Fatalf("InitializeCollections failed: %v", err)
+			}
+			collections := backend.GetAllCollections()
+			if len(collections) != 1 || collections[tt.bucket] != tt.mapsTo {
+				t.Fatalf("expected bucket %s -> %s, got %v", tt.bucket, tt.mapsTo, collections)
+			}
+
+			if _, err := backend.QueryStarfish(context.Background(), tt.bucket, "", ""); err != nil {
+				t.Fatalf("QueryStarfish failed: %v", err)
+			}
+			if query != tt.query {
+				t.Errorf("expected query %q, got %q", tt.query, query)
+			}
+			if volumePath != tt.volumePath {
+				t.Errorf("expected volumes_and_paths %q, got %q", tt.volumePath, volumePath)
+			}
+		})
+	}
+
+	if _, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:  "http://localhost",
+		BearerToken:  "test-token",
+		BucketSource: "directory",
+	}); err == nil {
+		t.Error("expected an error for an unsupported bucket source")
+	}
+}
+
+func TestListObjectsPrefixFilter(t *testing.T) {
+	var queries []string
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+		// Starfish filters may return a superset of the prefix
+		entries := []StarfishEntry{
+			{Filename: "a.txt", ParentPath: "data/run1", Size: 1, Volume: "test-volume"},
+			{Filename: "b.txt", ParentPath: "data/run1/sub", Size: 2, Volume: "test-volume"},
+			{Filename: "c.txt", ParentPath: "data/run10", Size: 3, Volume: "test-volume"},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+
+	bucket := "test-bucket"
+	prefix := "data/run1/"
+	result, err := backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	})
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+
+	expectedQueries := []string{
+		"tag=Collections:TestCollection type=f parent_path=data/run1",
+		"tag=Collections:TestCollection type=f parent_path=data/run1/*",
+	}
+	if strings.Join(queries, ",") != strings.Join(expectedQueries, ",") {
+		t.Errorf("expected queries %q, got %q", expectedQueries, queries)
+	}
+
+	var keys []string
+	for _, obj := range result.Contents {
+		keys = append(keys, *obj.Key)
+	}
+	expected := []string{"data/run1/a.txt", "data/run1/sub/b.txt"}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+}
+
+func TestPrefixFilters(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"", nil},
+		{"top", []string{"fn=top*", "parent_path=top*"}},
+		{"a/", []string{"parent_path=a", "parent_path=a/*"}},
+		{"a/b/c", []string{"parent_path=a/b fn=c*", "parent_path=a/b/c*"}},
+		{"my dir/", []string{`parent_path="my dir"`, `parent_path="my dir/*"`}},
+		// Glob metacharacters in the prefix must not narrow the match
+		{"run[1]/x*", []string{"parent_path=run?1? fn=x?*", "parent_path=run?1?/x?*"}},
+	}
+
+	for _, tt := range tests {
+		result := prefixFilters(tt.prefix)
+		if strings.Join(result, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("prefixFilters(%q) = %q, expected %q", tt.prefix, result, tt.expected)
+		}
+	}
+}
+
+func TestListQueriesWithRewriteRules(t *testing.T) {
+	backend, err := newTestBackend("http://test.example.com")
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+
+	// Templates that keep the original key behind a literal map prefixes
+	// back to Starfish paths
+	backend.pathRewriteConfig = &PathRewriteConfig{
+		Rules: []PathRewriteRule{{Bucket: "*", Pattern: "^raw/", Template: "archive/{{.OriginalKey}}"}},
+	}
+	expected := []string{
+		"type=f parent_path=archive/raw fn=x*",
+		"type=f parent_path=archive/raw/x*",
+		"type=f parent_path=raw fn=x*",
+		"type=f parent_path=raw/x*",
+	}
+	if result := backend.listQueries("test-bucket", "archive/raw/x"); strings.Join(result, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected queries %q, got %q", expected, result)
+	}
+
+	// A prefix of the literal matches every key the rule renders
+	if result := backend.listQueries("test-bucket", "arch"); strings.Join(result, ",") != "type=f" {
+		t.Errorf("expected the whole collection to be queried, got %q", result)
+	}
+
+	// Any other template makes the original path unknown
+	backend.pathRewriteConfig = &PathRewriteConfig{
+		Rules: []PathRewriteRule{{Bucket: "*", Pattern: "^(.*)$", Template: "{{.Entry.Filename}}"}},
+	}
+	if result := backend.listQueries("test-bucket", "a/"); strings.Join(result, ",") != "type=f" {
+		t.Errorf("expected the whole collection to be queried, got %q", result)
+	}
+}
+
+func TestListObjectsV2Pagination(t *testing.T) {
+	var all []StarfishEntry
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		all = append(all, StarfishEntry{Filename: name, ParentPath: "dir", Size: 1, Volume: "test-volume"})
+	}
+
+	server := newPagingServer(all)
+	defer server.Close()
+
+	backend, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:   server.URL,
+		BearerToken:   "test-token",
+		QueryPageSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.AddCollection("test-bucket", "Collections:TestCollection")
+
+	bucket := "test-bucket"
+	maxKeys := int32(3)
+	var keys []string
+	token := ""
+	for pages := 0; pages < 5; pages++ {
+		result, err := backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+			Bucket:            &bucket,
+			MaxKeys:           &maxKeys,
+			ContinuationToken: &token,
+		})
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, *obj.Key)
+		}
+		if !*result.IsTruncated {
+			if result.NextContinuationToken != nil {
+				t.Errorf("unexpected continuation token on last page")
+			}
+			break
+		}
+		token = *result.NextContinuationToken
+	}
+
+	expected := "dir/a,dir/b,dir/c,dir/d,dir/e"
+	if strings.Join(keys, ",") != expected {
+		t.Errorf("expected keys %s, got %s", expected, strings.Join(keys, ","))
+	}
+
+	bad := "not-a-token"
+	_, err = backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket:            &bucket,
+		ContinuationToken: &bad,
+	})
+	if err == nil {
+		t.Error("expected error for invalid continuation token")
+	}
+}
+
+// newPagingServer serves entries in the order given, honouring limit and
+// offset like the Starfish query API
+func newPagingServer(all []StarfishEntry) *httptest.Server {
+	return newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset > len(all) {
+			offset = len(all)
+		}
+		end := offset + limit
+		if end > len(all) {
+			end = len(all)
+		}
+		json.NewEncoder(w).Encode(all[offset:end])
+	})
+}
+
+func TestListObjectsKeyOrderAndDelimiter(t *testing.T) {
+	// Starfish order (parent_path, fn) differs from key order: dir/z.txt
+	// comes before dir-x/a.txt and dir/sub/b.txt
+	server := newPagingServer([]StarfishEntry{
+		{Filename: "top.txt", ParentPath: "", Size: 1, Volume: "test-volume"},
+		{Filename: "z.txt", ParentPath: "dir", Size: 1, Volume: "test-volume"},
+		{Filename: "a.txt", ParentPath: "dir-x", Size: 1, Volume: "test-volume"},
+		{Filename: "b.txt", ParentPath: "dir/sub", Size: 1, Volume: "test-volume"},
+	})
+	defer server.Close()
+
+	backend, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:   server.URL,
+		BearerToken:   "test-token",
+		QueryPageSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.AddCollection("test-bucket", "Collections:TestCollection")
+
+	bucket := "test-bucket"
+	maxKeys := int32(1)
+
+	// Without a delimiter every key is returned once, in key order
+	var keys []string
+	token := ""
+	for pages := 0; pages < 10; pages++ {
+		result, err := backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+			Bucket:            &bucket,
+			MaxKeys:           &maxKeys,
+			ContinuationToken: &token,
+		})
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, *obj.Key)
+		}
+		if !*result.IsTruncated {
+			break
+		}
+		token = *result.NextContinuationToken
+	}
+	expected := "dir-x/a.txt,dir/sub/b.txt,dir/z.txt,top.txt"
+	if strings.Join(keys, ",") != expected {
+		t.Errorf("expected keys %s, got %s", expected, strings.Join(keys, ","))
+	}
+
+	// With a delimiter each common prefix is returned once across pages,
+	// following the V1 NextMarker
+	delimiter := "/"
+	var items []string
+	marker := ""
+	for pages := 0; pages < 10; pages++ {
+		result, err := backend.ListObjects(context.Background(), &s3.ListObjectsInput{
+			Bucket:    &bucket,
+			Delimiter: &delimiter,
+			MaxKeys:   &maxKeys,
+			Marker:    &marker,
+		})
+		if err != nil {
+			t.Fatalf("ListObjects failed: %v", err)
+		}
+		for _, cp := range result.CommonPrefixes {
+			items = append(items, *cp.Prefix)
+		}
+		for _, obj := range result.Contents {
+			items = append(items, *obj.Key)
+		}
+		if !*result.IsTruncated {
+			break
+		}
+		marker = *result.NextMarker
+	}
+	expected = "dir-x/,dir/,top.txt"
+	if strings.Join(items, ",") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(items, ","))
+	}
+}
+
+func TestListObjectsV2TokenBoundToListing(t *testing.T) {
+	server := newPagingServer([]StarfishEntry{
+		{Filename: "a", ParentPath: "dir", Size: 1, Volume: "test-volume"},
+		{Filename: "b", ParentPath: "dir", Size: 1, Volume: "test-volume"},
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+
+	bucket := "test-bucket"
+	maxKeys := int32(1)
+	result, err := backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket:  &bucket,
+		MaxKeys: &maxKeys,
+	})
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if !*result.IsTruncated {
+		t.Fatal("expected a truncated listing")
+	}
+
+	prefix := "dir/"
+	_, err = backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket:            &bucket,
+		Prefix:            &prefix,
+		ContinuationToken: result.NextContinuationToken,
+	})
+	if !errors.Is(err, s3err.GetAPIError(s3err.ErrInvalidContinuationToken)) {
+		t.Errorf("expected InvalidContinuationToken for a different prefix, got %v", err)
+	}
+}
+
+func TestListObjectsOffsetIgnored(t *testing.T) {
+	// A server that ignores offset keeps returning the same full page
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]StarfishEntry{
+			{Filename: "a", ParentPath: "dir", Size: 1, Volume: "test-volume"},
+			{Filename: "b", ParentPath: "dir", Size: 1, Volume: "test-volume"},
+		})
+	})
+	defer server.Close()
+
+	backend, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:   server.URL,
+		BearerToken:   "test-token",
+		QueryPageSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.AddCollection("test-bucket", "Collections:TestCollection")
+
+	bucket := "test-bucket"
+	_, err = backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+	})
+	if err == nil {
+		t.Error("expected an error when Starfish ignores the offset")
+	}
+}
+
+func TestHeadObjectRewrittenKey(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		entries := []StarfishEntry{
+			{Filename: "file.dat", ParentPath: "raw/run1", Size: 10, ModifyTimeUnix: modTime.Unix(), Volume: "test-volume"},
+			{Filename: "other.dat", ParentPath: "raw/run2", Size: 20, ModifyTimeUnix: modTime.Unix(), Volume: "test-volume"},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.pathRewriteConfig = &PathRewriteConfig{
+		Rules: []PathRewriteRule{
+			{
+				Bucket:   "test-bucket",
+				Pattern:  "^(.*)$",
+				Template: "{{getModifyTimeFormatted .Entry \"2006/01/02\"}}/{{.Entry.Filename}}",
+			},
+		},
+	}
+
+	bucket := "test-bucket"
+	key := "2024/05/01/other.dat"
+	result, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if *result.ContentLength != 20 {
+		t.Errorf("expected size 20, got %d", *result.ContentLength)
+	}
+
+	// Keys found by scanning are served from the rewrite index afterwards,
+	// other entries seen during the scan are not indexed
+	entry, ok := backend.rewriteIndex.lookup(bucket, key)
+	if !ok || entry.ParentPath != "raw/run2" {
+		t.Errorf("expected rewritten key to be indexed, got %v %v", entry, ok)
+	}
+	if _, ok := backend.rewriteIndex.lookup(bucket, "2024/05/01/file.dat"); ok {
+		t.Error("expected scanned but unrequested key not to be indexed")
+	}
+
+	// The original Starfish path is no longer a valid key
+	original := "raw/run2/other.dat"
+	_, err = backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &original,
+	})
+	if err == nil {
+		t.Error("expected error for original key of rewritten object")
+	}
+}
+
+func TestListObjectsIndexesRewrittenKeys(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var queries int
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		entries := []StarfishEntry{
+			{Filename: "file.dat", ParentPath: "raw/run1", Size: 10, ModifyTimeUnix: modTime.Unix(), Volume: "test-volume"},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.pathRewriteConfig = &PathRewriteConfig{
+		Rules: []PathRewriteRule{
+			{
+				Bucket:   "test-bucket",
+				Pattern:  "^(.*)$",
+				Template: "{{getModifyTimeFormatted .Entry \"2006/01/02\"}}/{{.Entry.Filename}}",
+			},
+		},
+	}
+
+	bucket := "test-bucket"
+	_, err = backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+	})
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+
+	// The listed key is fetched from the index without another query
+	listed := queries
+	key := "2024/05/01/file.dat"
+	_, err = backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if queries != listed {
+		t.Errorf("expected listed key to be served from the index, got %d more queries", queries-listed)
+	}
+
+	// Changing the collections drops the index
+	backend.invalidateBucket("")
+	if _, ok := backend.rewriteIndex.lookup(bucket, key); ok {
+		t.Error("expected index to be cleared")
+	}
+}
+
+func TestHeadObjectInvertibleRewrite(t *testing.T) {
+	var queries []string
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+		entries := []StarfishEntry{
+			{Filename: "file1.txt", ParentPath: "data/run1", Size: 1024, Volume: "test-volume"},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.pathRewriteConfig = &PathRewriteConfig{
+		Rules: []PathRewriteRule{
+			{
+				Bucket:   "test-bucket",
+				Pattern:  "^data/",
+				Template: "archive/{{.OriginalKey}}",
+			},
+		},
+	}
+
+	bucket := "test-bucket"
+	key := "archive/data/run1/file1.txt"
+	result, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if *result.ContentLength != 1024 {
+		t.Errorf("expected size 1024, got %d", *result.ContentLength)
+	}
+
+	// The key maps back to Starfish paths, so no collection scan is needed
+	for _, query := range queries {
+		if !strings.Contains(query, "fn=") {
+			t.Errorf("expected point lookups only, got query %q", query)
+		}
+	}
+}
+
+func TestLeadingSlashParentPath(t *testing.T) {
+	var queries []string
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+		entries := []StarfishEntry{
+			{Filename: "file1.txt", ParentPath: "/data/run1", Size: 1024, Volume: "test-volume"},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+
+	bucket := "test-bucket"
+	prefix := "data/"
+	list, err := backend.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	})
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if len(list.Contents) != 1 || *list.Contents[0].Key != "data/run1/file1.txt" {
+		t.Fatalf("expected key data/run1/file1.txt, got %v", list.Contents)
+	}
+
+	// The listed key can be fetched and is queried in the same form
+	queries = nil
+	_, err = backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    list.Contents[0].Key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if len(queries) != 1 || !strings.Contains(queries[0], "parent_path=data/run1 ") {
+		t.Errorf("expected relative parent_path in lookup, got %v", queries)
+	}
+}
+
+func TestHeadObjectTopLevelKey(t *testing.T) {
+	// More files named file.txt in subdirectories than fit on one page,
+	// sorted ahead of the top level file
+	var all []StarfishEntry
+	for i := 0; i < 5; i++ {
+		all = append(all, StarfishEntry{
+			Filename:   "file.txt",
+			ParentPath: fmt.Sprintf("dir%d", i),
+			Size:       1,
+			Volume:     "test-volume",
+		})
+	}
+	all = append(all, StarfishEntry{Filename: "file.txt", Size: 42, Volume: "test-volume"})
+
+	server := newPagingServer(all)
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.queryPageSize = 2
+
+	bucket := "test-bucket"
+	key := "file.txt"
+	result, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if *result.ContentLength != 42 {
+		t.Errorf("expected top level file of size 42, got %d", *result.ContentLength)
+	}
+	if len(backend.cache.data) != 0 || backend.listCache.size != 0 {
+		t.Errorf("expected lookups not to be cached, got %d queries and %d listed entries",
+			len(backend.cache.data), backend.listCache.size)
+	}
+
+	missing := "missing.txt"
+	_, err = backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &missing,
+	})
+	if err == nil {
+		t.Error("expected error for missing top level key")
+	}
+}
+
+func TestRewriteIndexBounded(t *testing.T) {
+	index := newRewriteIndex(2, time.Hour)
+	index.add("bucket", "a", StarfishEntry{Filename: "a"})
+	index.add("bucket", "b", StarfishEntry{Filename: "b"})
+
+	// Looking up a keeps it, so adding c drops b
+	if _, ok := index.lookup("bucket", "a"); !ok {
+		t.Fatal("expected a to be indexed")
+	}
+	index.add("bucket", "c", StarfishEntry{Filename: "c"})
+	if _, ok := index.lookup("bucket", "b"); ok {
+		t.Error("expected least recently used key to be evicted")
+	}
+	if _, ok := index.lookup("bucket", "c"); !ok {
+		t.Error("expected c to be indexed")
+	}
+
+	expiring := newRewriteIndex(10, time.Millisecond)
+	expiring.add("bucket", "a", StarfishEntry{Filename: "a"})
+	time.Sleep(5 * time.Millisecond)
+	expiring.add("bucket", "b", StarfishEntry{Filename: "b"})
+	if expiring.lru.Len() != 1 {
+		t.Errorf("expected expired key to be evicted, got %d keys", expiring.lru.Len())
+	}
+}
+
+func TestHeadObjectPointLookup(t *testing.T) {
+	var queries []string
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+		entries := []StarfishEntry{
+			{Filename: "file1.txt", ParentPath: "data/run1", Size: 1024, Volume: "test-volume"},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+
+	bucket := "test-bucket"
+	key := "data/run1/file1.txt"
+	result, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if *result.ContentLength != 1024 {
+		t.Errorf("expected size 1024, got %d", *result.ContentLength)
+	}
+
+	if len(queries) != 1 {
+		t.Fatalf("expected a single Starfish query, got %d", len(queries))
+	}
+	expected := "tag=Collections:TestCollection type=f parent_path=data/run1 fn=file1.txt"
+	if queries[0] != expected {
+		t.Errorf("expected query %q, got %q", expected, queries[0])
+	}
+}
+
+func TestGetObjectRangeAndConditions(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	content := "hello, starfish"
+
+	api := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		entries := []StarfishEntry{
+			{Filename: "file1.txt", ParentPath: "data", Size: int64(len(content)), ModifyTimeUnix: modTime.Unix(), Volume: "vol1"},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer api.Close()
+
+	fileServer := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/vol1/data/file1.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf("\"%d-%d\"", len(content), modTime.Unix()))
+		http.ServeContent(w, r, "file1.txt", modTime, strings.NewReader(content))
+	})
+	defer fileServer.Close()
+
+	backend, err := newTestBackend(api.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.fileServerURL = fileServer.URL
+
+	bucket := "test-bucket"
+	key := "data/file1.txt"
+	rng := "bytes=7-14"
+	result, err := backend.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Range:  &rng,
+	})
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	defer result.Body.Close()
+
+	body, _ := io.ReadAll(result.Body)
+	if string(body) != "starfish" {
+		t.Errorf("expected body %q, got %q", "starfish", string(body))
+	}
+	if *result.ContentLength != 8 {
+		t.Errorf("expected content length 8, got %d", *result.ContentLength)
+	}
+	if result.ContentRange == nil || *result.ContentRange != "bytes 7-14/15" {
+		t.Errorf("unexpected content range %v", result.ContentRange)
+	}
+
+	// A matching If-None-Match is answered without a body
+	_, err = backend.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket:      &bucket,
+		Key:         &key,
+		IfNoneMatch: result.ETag,
+	})
+	if !errors.Is(err, s3err.GetAPIError(s3err.ErrNotModified)) {
+		t.Errorf("expected NotModified, got %v", err)
+	}
+
+	// A stale If-Match fails the precondition
+	stale := "\"1-1\""
+	_, err = backend.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket:  &bucket,
+		Key:     &key,
+		IfMatch: &stale,
+	})
+	if !errors.Is(err, s3err.GetAPIError(s3err.ErrPreconditionFailed)) {
+		t.Errorf("expected PreconditionFailed, got %v", err)
+	}
+}
+
+func TestGetObjectTagging(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		entries := []StarfishEntry{
+			{
+				Filename:         "file1.txt",
+				ParentPath:       "data/run1",
+				Size:             1024,
+				Volume:           "test-volume",
+				TagsExplicitStr:  "Collections:TestCollection,Project:b,Project:a,reviewed",
+				TagsInheritedStr: "Project:old,Site:hq",
+			},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+
+	tags, err := backend.GetObjectTagging(context.Background(), "test-bucket", "data/run1/file1.txt")
+	if err != nil {
+		t.Fatalf("GetObjectTagging failed: %v", err)
+	}
+	expected := map[string]string{
+		"Collections": "TestCollection",
+		"Project":     "a/b",
+		"reviewed":    "",
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, tags)
+	}
+
+	// Inherited tags are added, explicit tags of the same tagset win
+	backend.includeInheritedTags = true
+	tags, err = backend.GetObjectTagging(context.Background(), "test-bucket", "data/run1/file1.txt")
+	if err != nil {
+		t.Fatalf("GetObjectTagging failed: %v", err)
+	}
+	expected["Site"] = "hq"
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, tags)
+	}
+
+	bucket := "test-bucket"
+	key := "data/run1/file1.txt"
+	head, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if head.TagCount == nil || *head.TagCount != 4 {
+		t.Errorf("expected tag count 4, got %v", head.TagCount)
+	}
+
+	if _, err := backend.GetObjectTagging(context.Background(), "missing", key); err == nil {
+		t.Error("expected error for missing bucket")
+	}
+}
+
+func TestHeadObjectMetadata(t *testing.T) {
+	ctime := time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)
+	atime := time.Date(2024, 1, 20, 9, 30, 0, 0, time.UTC)
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		entries := []StarfishEntry{
+			{
+				Filename:       "report.PDF",
+				ParentPath:     "data/run1",
+				Size:           1024,
+				Volume:         "test-volume",
+				UID:            1000,
+				GID:            0,
+				Mode:           "0644",
+				Inode:          4242,
+				CreateTimeUnix: ctime.Unix(),
+				AccessTimeUnix: atime.Unix(),
+				Zones:          []StarfishZone{{ID: 1, Name: "genomics"}, {ID: 2, Name: "archive"}},
+			},
+			{Filename: "data.unknownext", ParentPath: "data/run1", Size: 1, Volume: "test-volume"},
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := newTestBackend(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+
+	bucket := "test-bucket"
+	key := "data/run1/report.PDF"
+	head, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"starfish-uid":    "1000",
+		"starfish-gid":    "0",
+		"starfish-mode":   "0644",
+		"starfish-inode":  "4242",
+		"starfish-volume": "test-volume",
+		"starfish-ctime":  "2024-01-10T08:00:00Z",
+		"starfish-atime":  "2024-01-20T09:30:00Z",
+		"starfish-zones":  "genomics,archive",
+	}
+	if !reflect.DeepEqual(head.Metadata, expected) {
+		t.Errorf("expected metadata %v, got %v", expected, head.Metadata)
+	}
+	if head.ContentType == nil || *head.ContentType != "application/pdf" {
+		t.Errorf("expected content type application/pdf, got %v", head.ContentType)
+	}
+
+	// Unknown extensions leave the content type to the gateway default
+	key = "data/run1/data.unknownext"
+	head, err = backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if head.ContentType != nil {
+		t.Errorf("expected no content type, got %q", *head.ContentType)
+	}
+	if _, ok := head.Metadata["starfish-zones"]; ok {
+		t.Error("expected no zones metadata for entry without zones")
+	}
+}
+
+func TestQueryRequestsMetadataFields(t *testing.T) {
+	backend, err := newTestBackend("http://localhost")
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+
+	queryURL, err := backend.buildQueryURL("Collections:TestCollection", false, "", "", 0)
+	if err != nil {
+		t.Fatalf("buildQueryURL failed: %v", err)
+	}
+	parsed, err := url.Parse(queryURL)
+	if err != nil {
+		t.Fatalf("parse query URL: %v", err)
+	}
+
+	fields := strings.Fields(parsed.Query().Get("format"))
+	for _, field := range []string{"uid", "gid", "mode", "ino", "volume", "ct", "at", "zones"} {
+		if !slices.Contains(fields, field) {
+			t.Errorf("expected format to request %q, got %v", field, fields)
+		}
+	}
+}
+
+func TestContentETags(t *testing.T) {
+	content := "hello starfish"
+	md5Sum := md5.Sum([]byte(content))
+	sha256Sum := sha256.Sum256([]byte(content))
+	crc32cSum := crc32.Checksum([]byte(content), crc32.MakeTable(crc32.Castagnoli))
+	crc32cBytes := []byte{byte(crc32cSum >> 24), byte(crc32cSum >> 16), byte(crc32cSum >> 8), byte(crc32cSum)}
+
+	var fileReads int
+	fileServer := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fileReads++
+		if r.Header.Get("If-Match") != "" {
+			t.Errorf("expected content ETag conditions not to reach the file server")
+		}
+		io.WriteString(w, content)
+	})
+	defer fileServer.Close()
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Unix()
+	entries := []StarfishEntry{
+		{Filename: "file1.txt", ParentPath: "data", Size: int64(len(content)), ModifyTimeUnix: modTime, Inode: 11, Volume: "vol"},
+		{Filename: "file2.txt", ParentPath: "data", Size: int64(len(content)), ModifyTimeUnix: modTime, Inode: 12, Volume: "vol", MD5: "0123456789abcdef0123456789abcdef"},
+	}
+	var format string
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		format = r.URL.Query().Get("format")
+		json.NewEncoder(w).Encode(entries)
+	})
+	defer server.Close()
+
+	backend, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:   server.URL,
+		BearerToken:   "test-token",
+		FileServerURL: fileServer.URL,
+		ContentETags:  true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.AddCollection("test-bucket", "Collections:TestCollection")
+
+	ctx := context.Background()
+	bucket := "test-bucket"
+	key := "data/file1.txt"
+	contentETag := "\"" + hex.EncodeToString(md5Sum[:]) + "\""
+
+	// Listings do not read files, so the MD5 is not known yet
+	list, err := backend.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: &bucket})
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if *list.Contents[0].ETag != backend.generateETag(entries[0]) {
+		t.Errorf("expected size-mtime ETag before hashing, got %s", *list.Contents[0].ETag)
+	}
+	if !strings.Contains(format, "md5") {
+		t.Errorf("expected query to request stored hashes, got format %q", format)
+	}
+
+	for i := 0; i < 2; i++ {
+		head, err := backend.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &bucket, Key: &key})
+		if err != nil {
+			t.Fatalf("HeadObject failed: %v", err)
+		}
+		if *head.ETag != contentETag {
+			t.Errorf("expected ETag %s, got %s", contentETag, *head.ETag)
+		}
+	}
+	if fileReads != 1 {
+		t.Errorf("expected the file to be read once, got %d reads", fileReads)
+	}
+
+	// Conditions are checked against the content ETag
+	_, err = backend.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key, IfNoneMatch: &contentETag})
+	if !errors.Is(err, s3err.GetAPIError(s3err.ErrNotModified)) {
+		t.Errorf("expected NotModified, got %v", err)
+	}
+	out, err := backend.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key, IfMatch: &contentETag})
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	out.Body.Close()
+
+	list, err = backend.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: &bucket})
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if *list.Contents[0].ETag != contentETag {
+		t.Errorf("expected listing to return the known content ETag, got %s", *list.Contents[0].ETag)
+	}
+	if *list.Contents[1].ETag != "\"0123456789abcdef0123456789abcdef\"" {
+		t.Errorf("expected the MD5 stored in Starfish, got %s", *list.Contents[1].ETag)
+	}
+
+	attrs, err := backend.GetObjectAttributes(ctx, &s3.GetObjectAttributesInput{
+		Bucket:           &bucket,
+		Key:              &key,
+		ObjectAttributes: []types.ObjectAttributes{types.ObjectAttributesChecksum},
+	})
+	if err != nil {
+		t.Fatalf("GetObjectAttributes failed: %v", err)
+	}
+	if attrs.Checksum == nil ||
+		*attrs.Checksum.ChecksumSHA256 != base64.StdEncoding.EncodeToString(sha256Sum[:]) ||
+		*attrs.Checksum.ChecksumCRC32C != base64.StdEncoding.EncodeToString(crc32cBytes) {
+		t.Errorf("unexpected checksums %+v", attrs.Checksum)
+	}
+
+	// A modified file is hashed again
+	entries[0].ModifyTimeUnix++
+	backend.invalidateBucket("")
+	if _, err := backend.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &bucket, Key: &key}); err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if fileReads != 3 {
+		t.Errorf("expected modified file to be read again, got %d reads", fileReads)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// GetObjectTagging returns the Starfish tags of an object as S3 tags
+func (b *StarfishBackend) GetObjectTagging(ctx context.Context, bucket, object string) (map[string]string, error) {
+	if err := b.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	entry, err := b.resolveObject(ctx, "GetObjectTagging", bucket, object)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.objectTags(entry), nil
+}
+
+// objectTags maps the Starfish tags of an entry to S3 tags. A Starfish
+// tag "tagset:tag" becomes the S3 tag tagset=tag, tags in the default
+// tagset have an empty value. Several tags in one tagset are joined with
+// "/" in sorted order, since S3 tag keys are unique. Explicit tags of a
+// tagset replace the tags it inherits from parent directories.
+func (b *StarfishBackend) objectTags(entry StarfishEntry) map[string]string {
+	explicit := groupTags(entry.GetTagsExplicit())
+
+	tags := make(map[string]string)
+	if b.includeInheritedTags {
+		for tagset, values := range groupTags(entry.GetTagsInherited()) {
+			tags[tagset] = strings.Join(values, "/")
+		}
+	}
+	for tagset, values := range explicit {
+		tags[tagset] = strings.Join(values, "/")
+	}
+
+	return tags
+}
+
+// groupTags groups Starfish tags by tagset, with the tag names of each
+// tagset sorted and unique
+func groupTags(tags []string) map[string][]string {
+	grouped := make(map[string][]string)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		tagset, name, found := strings.Cut(tag, ":")
+		if !found {
+			tagset, name = tag, ""
+		}
+		grouped[tagset] = append(grouped[tagset], name)
+	}
+
+	for tagset, names := range grouped {
+		sort.Strings(names)
+		unique := names[:0]
+		for i, name := range names {
+			if i == 0 || name != names[i-1] {
+				unique = append(unique, name)
+			}
+		}
+		grouped[tagset] = unique
+	}
+
+	return grouped
+}
+
+// tagCount returns the number of S3 tags of an entry for the
+// x-amz-tagging-count header, or nil if it has none
+func (b *StarfishBackend) tagCount(entry StarfishEntry) *int32 {
+	count := int32(len(b.objectTags(entry)))
+	if count == 0 {
+		return nil
+	}
+	return &count
+}
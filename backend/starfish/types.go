@@ -18,26 +18,63 @@
 package starfish
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/versity/versitygw/backend"
+	"github.com/versity/versitygw/backend/meta"
 	"github.com/versity/versitygw/metrics"
+	"github.com/versity/versitygw/s3event"
 )
 
 // StarfishBackend implements the backend.Backend interface for Starfish API
 type StarfishBackend struct {
+	backend.BackendUnsupported
+
 	apiEndpoint                string
 	bearerToken                string
 	fileServerURL              string // URL to the starfish file server for GetObject operations
 	cache                      *QueryCache
 	httpClient                 *http.Client
-	collections                map[string]string  // maps bucket name -> Collection:* tag
-	collectionsMux             sync.RWMutex       // protects collections map
-	CollectionsRefreshInterval time.Duration      // interval for refreshing collections
-	pathRewriteConfig          *PathRewriteConfig // path rewriting configuration
-	metricsManager             *metrics.Manager   // Metrics manager for monitoring
+	writeClient                *http.Client            // file server writes, bounded by the request context only
+	collections                map[string]string       // maps bucket name -> tag, zone or volume of the bucket source
+	bucketSource               string                  // what buckets are mapped from, one of the BucketSource* values
+	bucketTagset               string                  // tagset whose tags are buckets in tagset mode
+	collectionsMux             sync.RWMutex            // protects collections map and the refresh state
+	collectionsLoaded          bool                    // collections were discovered at least once
+	bucketNameWarnings         []string                // collections without a usable bucket name in the last discovery
+	bucketAliases              map[string]string       // bucket name -> tag, zone or volume, overriding derived names
+	virtualBuckets             map[string]string       // bucket name -> Starfish query selecting the files of the bucket
+	refreshCancel              context.CancelFunc      // stops the collections refresh loop
+	refreshDone                chan struct{}           // closed when the collections refresh loop exits
+	eventSender                s3event.S3EventSender   // notified of added and removed collections
+	CollectionsRefreshInterval time.Duration           // interval for refreshing collections
+	pathRewriteConfig          *PathRewriteConfig      // path rewriting configuration
+	pathRewriteConfigFile      string                  // file the path rewriting configuration is reloaded from
+	collisionPolicy            string                  // handling of entries whose object keys collide
+	rewriteMux                 sync.RWMutex            // guards pathRewriteConfig
+	metricsManager             *metrics.Manager        // Metrics manager for monitoring
+	queryPageSize              int                     // entries fetched per Starfish query
+	rewriteIndex               *rewriteIndex           // rewritten object key -> Starfish entry
+	listCache                  *listCache              // sorted entries of recent listings
+	meta                       meta.MetadataStorer     // bucket ACLs, policies and settings
+	defaultOwner               string                  // owner of collections without a stored ACL
+	startTime                  time.Time               // reported as the creation date of collections
+	includeInheritedTags       bool                    // include inherited Starfish tags in object tagging
+	hashCache                  *hashCache              // content hashes, nil unless content ETags are enabled
+	writeConfig                *WriteConfig            // collections that accept writes
+	breaker                    *circuitBreaker         // stops queries while Starfish is unavailable, nil if disabled
+	queryRetries               int                     // retries of queries failing because Starfish is unavailable
+	retryBaseDelay             time.Duration           // backoff before the first retry of a query
+	staleMux                   sync.Mutex              // serializes stale warnings of concurrent queries of a request
+	shardVolumes               bool                    // split listing queries by volume and run them concurrently
+	shardWorkers               int                     // volumes queried at once by a sharded listing
+	shardTTL                   time.Duration           // how long the volumes holding files of a bucket are trusted
+	volumeShards               map[string]volumeShards // bucket -> volumes holding files of the bucket
+	volumeShardsMux            sync.Mutex              // guards volumeShards
 }
 
 // StarfishConfig holds configuration for the backend
@@ -46,8 +83,31 @@ type StarfishConfig struct {
 	BearerToken                string
 	FileServerURL              string // URL to the starfish file server for GetObject operations
 	CacheTTL                   time.Duration
+	QueryCacheEntries          int                // query results kept in the query cache (default: 10000)
+	QueryCacheBytes            int64              // approximate memory budget of the query cache (default: 256MiB)
+	StaleCacheTTL              time.Duration      // how long expired query results are served while Starfish is unavailable (default: 1h, negative disables)
+	QueryRetries               int                // retries of queries while Starfish is unavailable (default: 2, negative disables)
+	BreakerThreshold           int                // consecutive failed queries opening the circuit breaker (default: 5, negative disables)
+	BreakerCooldown            time.Duration      // time queries are paused once the circuit breaker opens (default: 30s)
 	CollectionsRefreshInterval time.Duration      // interval for refreshing collections
 	PathRewriteConfig          *PathRewriteConfig // path rewriting configuration
+	PathRewriteConfigFile      string             // file PathRewriteConfig was loaded from, reloaded by ReloadConfig
+	CollisionPolicy            string             // handling of entries whose object keys collide: suffix, first-wins or error (default: suffix)
+	QueryPageSize              int                // entries fetched per Starfish query (default: 1000)
+	ListCacheEntries           int                // entries kept in the listing cache (default: 1000000)
+	RewriteIndexSize           int                // rewritten keys remembered for lookups (default: 100000)
+	MetadataDir                string             // directory storing bucket ACLs, policies and settings
+	DefaultOwner               string             // owner of collections without a stored ACL
+	IncludeInheritedTags       bool               // include inherited Starfish tags in object tagging
+	ContentETags               bool               // use MD5 ETags and content checksums computed via the file server
+	HashCacheEntries           int                // files whose content hashes are cached (default: 100000)
+	WriteConfig                *WriteConfig       // collections that accept writes, read-only if nil
+	BucketSource               string             // what buckets are mapped from: tagset (default), zone or volume
+	BucketTagset               string             // tagset whose tags are buckets in tagset mode (default: Collections)
+	BucketAliases              map[string]string  // bucket name -> tag, zone or volume, overriding derived names
+	VirtualBuckets             map[string]string  // bucket name -> Starfish query selecting the files of the bucket
+	ShardVolumes               bool               // split listing queries by volume and run them concurrently
+	ShardWorkers               int                // volumes queried at once by a sharded listing (default: 8)
 
 	// TLS Configuration
 	TLSCertFile           string // Path to TLS certificate file
@@ -62,21 +122,6 @@ type StarfishConfig struct {
 	IdleConnTimeout     time.Duration    // Idle connection timeout (default: 90s)
 }
 
-// QueryCache manages cached query results
-type QueryCache struct {
-	data       map[string]*CachedResult
-	mutex      sync.RWMutex
-	defaultTTL time.Duration
-}
-
-// CachedResult stores a Starfish query result with metadata
-type CachedResult struct {
-	Data          *StarfishQueryResponse
-	CachedAt      time.Time
-	ExpiresAt     time.Time
-	VolumeAndPath string
-}
-
 // StarfishQueryResponse represents the response from Starfish query API
 type StarfishQueryResponse struct {
 	Entries []StarfishEntry `json:"entries"`
@@ -103,6 +148,8 @@ type StarfishEntry struct {
 	TagsExplicitStr  string         `json:"tags_explicit,omitempty"`
 	TagsInheritedStr string         `json:"tags_inherited,omitempty"`
 	Zones            []StarfishZone `json:"zones,omitempty"`
+	MD5              string         `json:"md5,omitempty"`    // content MD5 if recorded by Starfish, hex encoded
+	SHA256           string         `json:"sha256,omitempty"` // content SHA256 if recorded by Starfish, hex encoded
 }
 
 // GetCreateTime converts Unix timestamp to time.Time
@@ -134,6 +181,11 @@ func (e *StarfishEntry) IsFile() bool {
 	return e.Type == 32768
 }
 
+// IsDir checks if the entry is a directory (type 16384)
+func (e *StarfishEntry) IsDir() bool {
+	return e.Type == 16384
+}
+
 // GetTagsExplicit parses the tags_explicit string into a slice
 func (e *StarfishEntry) GetTagsExplicit() []string {
 	if e.TagsExplicitStr == "" {
@@ -157,6 +209,13 @@ type StarfishZone struct {
 	RelativePath string `json:"relative_path"`
 }
 
+// StarfishVolume represents a volume from the Starfish /volume/ API
+type StarfishVolume struct {
+	ID          int    `json:"id"`
+	Vol         string `json:"vol"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
 // StarfishTagsResponse represents the response from the tags API (legacy)
 type StarfishTagsResponse struct {
 	Tags []string `json:"tags"`
@@ -0,0 +1,249 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+// WriteConfig holds the collections that accept writes
+type WriteConfig struct {
+	Collections map[string]WriteTarget `json:"collections"` // bucket name -> write target
+}
+
+// WriteTarget is where objects written to a collection are stored. Object
+// keys are Starfish paths, so only keys below Path can be written, and
+// they are stored on Volume at the path given by the key.
+type WriteTarget struct {
+	Volume   string `json:"volume"`
+	Path     string `json:"path"`
+	Writable bool   `json:"writable"`
+}
+
+// writeTarget returns where an object of a collection is written, or
+// AccessDenied if the collection is read-only or the key is outside the
+// writable path
+func (b *StarfishBackend) writeTarget(bucket, object string) (WriteTarget, error) {
+	if err := b.checkBucket(bucket); err != nil {
+		return WriteTarget{}, err
+	}
+
+	if b.writeConfig == nil {
+		return WriteTarget{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+	target, ok := b.writeConfig.Collections[bucket]
+	if !ok || !target.Writable {
+		return WriteTarget{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+
+	if b.fileServerURL == "" {
+		return WriteTarget{}, s3err.GetAPIError(s3err.ErrNotImplemented)
+	}
+
+	// Files on another volume would never be listed in the bucket
+	if b.bucketSource == BucketSourceVolume {
+		if volume, _ := b.GetCollectionTag(bucket); volume != target.Volume {
+			return WriteTarget{}, fmt.Errorf("write target volume %s is not the volume %s of bucket %s",
+				target.Volume, volume, bucket)
+		}
+	}
+
+	// Keys name files below the writable path, never directories or
+	// multipart uploads staged by the file server
+	if object == multipartStagingDir || strings.HasPrefix(object, multipartStagingDir+"/") {
+		return WriteTarget{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+	for _, part := range strings.Split(object, "/") {
+		if part == "" || part == "." || part == ".." {
+			return WriteTarget{}, s3err.GetAPIError(s3err.ErrInvalidRequest)
+		}
+	}
+	if dir := strings.Trim(target.Path, "/"); dir != "" && !strings.HasPrefix(object, dir+"/") {
+		return WriteTarget{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+
+	return target, nil
+}
+
+// fileURL returns the file server URL of a Starfish path
+func (b *StarfishBackend) fileURL(volume, filePath string) string {
+	escaped := make([]string, 0, strings.Count(filePath, "/")+1)
+	for _, part := range strings.Split(filePath, "/") {
+		escaped = append(escaped, url.PathEscape(part))
+	}
+	return fmt.Sprintf("%s/%s/%s", b.fileServerURL, url.PathEscape(volume), strings.Join(escaped, "/"))
+}
+
+// PutObject stores an object in a writable collection through the file
+// server and tags it with the collection tag, so it is listed once
+// Starfish has indexed it
+func (b *StarfishBackend) PutObject(ctx context.Context, input s3response.PutObjectInput) (s3response.PutObjectOutput, error) {
+	if input.Bucket == nil || input.Key == nil {
+		return s3response.PutObjectOutput{}, s3err.GetAPIError(s3err.ErrInvalidRequest)
+	}
+	bucket, object := *input.Bucket, *input.Key
+
+	target, err := b.writeTarget(bucket, object)
+	if err != nil {
+		return s3response.PutObjectOutput{}, err
+	}
+
+	body := input.Body
+	if body == nil {
+		body = http.NoBody
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, b.fileURL(target.Volume, object), body)
+	if err != nil {
+		return s3response.PutObjectOutput{}, fmt.Errorf("failed to create file server request: %w", err)
+	}
+	req.Header.Set("X-Internal-Token", b.bearerToken)
+	if input.ContentLength != nil {
+		req.ContentLength = *input.ContentLength
+	}
+
+	resp, err := b.writeClient.Do(req)
+	if err != nil {
+		return s3response.PutObjectOutput{}, fmt.Errorf("failed to upload file to file server: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+	case http.StatusBadRequest:
+		return s3response.PutObjectOutput{}, s3err.GetAPIError(s3err.ErrInvalidRequest)
+	case http.StatusForbidden, http.StatusMethodNotAllowed:
+		return s3response.PutObjectOutput{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	case http.StatusConflict:
+		return s3response.PutObjectOutput{}, s3err.GetAPIError(s3err.ErrObjectParentIsFile)
+	default:
+		return s3response.PutObjectOutput{}, fmt.Errorf("file server returned status %d", resp.StatusCode)
+	}
+
+	if err := b.tagWrittenObject(ctx, bucket, target.Volume, object); err != nil {
+		return s3response.PutObjectOutput{}, err
+	}
+
+	b.invalidateBucket(bucket)
+
+	return s3response.PutObjectOutput{
+		ETag: resp.Header.Get("ETag"),
+	}, nil
+}
+
+// DeleteObject removes an object of a writable collection through the
+// file server
+func (b *StarfishBackend) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	if input.Bucket == nil || input.Key == nil {
+		return nil, s3err.GetAPIError(s3err.ErrInvalidRequest)
+	}
+	bucket, object := *input.Bucket, *input.Key
+
+	target, err := b.writeTarget(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, b.fileURL(target.Volume, object), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file server request: %w", err)
+	}
+	req.Header.Set("X-Internal-Token", b.bearerToken)
+
+	resp, err := b.writeClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete file on file server: %w", err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK, http.StatusNotFound:
+	case http.StatusForbidden, http.StatusMethodNotAllowed:
+		return nil, s3err.GetAPIError(s3err.ErrAccessDenied)
+	default:
+		return nil, fmt.Errorf("file server returned status %d", resp.StatusCode)
+	}
+
+	b.invalidateBucket(bucket)
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// tagRequest is the body of a Starfish tag request
+type tagRequest struct {
+	Paths []string `json:"paths"`
+	Tags  []string `json:"tags"`
+}
+
+// tagWrittenObject tags a file written to a bucket with the bucket tag, so
+// it is listed in the bucket. Files of zone and volume buckets belong to
+// the bucket by where they are stored and are not tagged.
+func (b *StarfishBackend) tagWrittenObject(ctx context.Context, bucket, volume, object string) error {
+	if b.bucketSource == BucketSourceZone || b.bucketSource == BucketSourceVolume {
+		return nil
+	}
+	collectionTag, _ := b.GetCollectionTag(bucket)
+	return b.tagPath(ctx, volume, object, collectionTag)
+}
+
+// tagPath adds a tag to a path in Starfish
+func (b *StarfishBackend) tagPath(ctx context.Context, volume, filePath, tag string) error {
+	body, err := json.Marshal(tagRequest{
+		Paths: []string{volume + ":" + filePath},
+		Tags:  []string{tag},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode tag request: %w", err)
+	}
+
+	tagURL := fmt.Sprintf("%s/tag/add/", strings.TrimSuffix(b.apiEndpoint, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tagURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create tag request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+b.bearerToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return starfishErrToS3Err(&StarfishError{
+			Code:    "API_UNAVAILABLE",
+			Message: "Starfish API is unavailable",
+			Err:     err,
+		})
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to tag %s:%s with %s: status %d: %s",
+			volume, filePath, tag, resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+//
+// This file is part of the VersityGW project developed by Starfish Storage, Inc.
+//
+// The VersityGW project is licensed under the Apache License, version 2.0
+// (the "License"); you may not use this file except in compliance with the
+// License. You may obtain a copy of the License at:
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starfish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+func TestPutAndDeleteObject(t *testing.T) {
+	files := make(map[string]string)
+	fileServer := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Internal-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			files[r.URL.Path] = string(data)
+			w.Header().Set("ETag", "\"5-1714564800\"")
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			delete(files, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	defer fileServer.Close()
+
+	var tagged []tagRequest
+	var queries int
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tag/add/" {
+			var req tagRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			tagged = append(tagged, req)
+			return
+		}
+		queries++
+		json.NewEncoder(w).Encode([]StarfishEntry{})
+	})
+	defer server.Close()
+
+	backend, err := NewStarfishBackend(&StarfishConfig{
+		APIEndpoint:   server.URL,
+		BearerToken:   "test-token",
+		FileServerURL: fileServer.URL,
+		WriteConfig: &WriteConfig{
+			Collections: map[string]WriteTarget{
+				"test-bucket":     {Volume: "vol1", Path: "uploads", Writable: true},
+				"readonly-bucket": {Volume: "vol1", Path: "uploads"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create test backend: %v", err)
+	}
+	backend.AddCollection("test-bucket", "Collections:TestCollection")
+	backend.AddCollection("readonly-bucket", "Collections:ReadOnly")
+	backend.AddCollection("other-bucket", "Collections:Other")
+
+	ctx := context.Background()
+	put := func(bucket, key, body string) (s3response.PutObjectOutput, error) {
+		size := int64(len(body))
+		return backend.PutObject(ctx, s3response.PutObjectInput{
+			Bucket:        &bucket,
+			Key:           &key,
+			Body:          strings.NewReader(body),
+			ContentLength: &size,
+		})
+	}
+
+	// Listings are cached until a write invalidates them
+	bucket := "test-bucket"
+	if _, err := backend.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: &bucket}); err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+
+	out, err := put("test-bucket", "uploads/a file.txt", "hello")
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if out.ETag != "\"5-1714564800\"" {
+		t.Errorf("expected file server ETag, got %q", out.ETag)
+	}
+	if files["/vol1/uploads/a file.txt"] != "hello" {
+		t.Errorf("expected file to be uploaded, got %v", files)
+	}
+	if len(tagged) != 1 || tagged[0].Paths[0] != "vol1:uploads/a file.txt" || tagged[0].Tags[0] != "Collections:TestCollection" {
+		t.Errorf("expected file to be tagged with the collection tag, got %+v", tagged)
+	}
+
+	if _, err := backend.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: &bucket}); err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	if queries != 2 {
+		t.Errorf("expected listing to be queried again after the write, got %d queries", queries)
+	}
+
+	for _, tt := range []struct {
+		bucket string
+		key    string
+		err    s3err.ErrorCode
+	}{
+		{"readonly-bucket", "uploads/file.txt", s3err.ErrAccessDenied},
+		{"other-bucket", "uploads/file.txt", s3err.ErrAccessDenied},
+		{"test-bucket", "elsewhere/file.txt", s3err.ErrAccessDenied},
+		{"test-bucket", "uploadsfile.txt", s3err.ErrAccessDenied},
+		{"test-bucket", "uploads/dir/", s3err.ErrInvalidRequest},
+		{"test-bucket", "uploads/../etc/passwd", s3err.ErrInvalidRequest},
+		{"missing", "uploads/file.txt", s3err.ErrNoSuchBucket},
+	} {
+		if _, err := put(tt.bucket, tt.key, "x"); !errors.Is(err, s3err.GetAPIError(tt.err)) {
+			t.Errorf("%s/%s: expected %v, got %v", tt.bucket, tt.key, tt.err, err)
+		}
+	}
+
+	key := "uploads/a file.txt"
+	if _, err := backend.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &bucket, Key: &key}); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if _, ok := files["/vol1/uploads/a file.txt"]; ok {
+		t.Error("expected file to be deleted")
+	}
+
+	readonly := "readonly-bucket"
+	if _, err := backend.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &readonly, Key: &key}); !errors.Is(err, s3err.GetAPIError(s3err.ErrAccessDenied)) {
+		t.Errorf("expected AccessDenied for a read-only collection, got %v", err)
+	}
+}
+
+func TestLoadWriteConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(content string) string {
+		path := filepath.Join(dir, "write.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		return path
+	}
+
+	config, err := LoadWriteConfig(write(`{"collections": {"test-bucket": {"volume": "vol1", "path": "uploads", "writable": true}}}`))
+	if err != nil {
+		t.Fatalf("LoadWriteConfig failed: %v", err)
+	}
+	if target := config.Collections["test-bucket"]; target.Volume != "vol1" || target.Path != "uploads" || !target.Writable {
+		t.Errorf("unexpected write target %+v", target)
+	}
+
+	for _, content := range []string{
+		`{"collections": {"test-bucket": {"path": "uploads"}}}`,
+		`{"collections": {"test-bucket": {"volume": "vol1", "path": "uploads/../etc"}}}`,
+		`{"collections": [}`,
+	} {
+		if _, err := LoadWriteConfig(write(content)); err == nil {
+			t.Errorf("expected error for %s", content)
+		}
+	}
+
+	if config, err := LoadWriteConfig(""); config != nil || err != nil {
+		t.Errorf("expected no configuration, got %v, %v", config, err)
+	}
+}
@@ -4,7 +4,9 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -35,6 +37,7 @@ type FileServer struct {
 	volumes          map[string]*VolumeInfo // vol name -> VolumeInfo
 	volumesMux       sync.RWMutex
 	port             int
+	allowWrites      bool // accept uploads and deletes from the gateway
 }
 
 // NewFileServer creates a new file server instance
@@ -123,9 +126,10 @@ func (fs *FileServer) ResolvePath(volumeName, filePath string) (string, error) {
 	return "", fmt.Errorf("no mounts available for volume: %s", volumeName)
 }
 
-// ServeFile handles file serving requests
+// ServeFile handles file serving requests. GET and HEAD are supported,
+// including byte ranges and conditional requests.
 func (fs *FileServer) ServeFile(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -181,19 +185,177 @@ func (fs *FileServer) ServeFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Set appropriate headers
+	// Set appropriate headers. The ETag uses the same size-mtime format
+	// as the gateway so If-Match and If-None-Match from S3 clients can be
+	// checked against the file as it is now.
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+	w.Header().Set("ETag", fmt.Sprintf("\"%d-%d\"", fileInfo.Size(), fileInfo.ModTime().Unix()))
+
+	// ServeContent handles Range, the If-* conditions and HEAD, replying
+	// with 206, 304, 412 or 416 as appropriate
+	http.ServeContent(w, r, filepath.Base(localPath), fileInfo.ModTime(), file)
+
+	log.Printf("Served file: %s %s (%d bytes, range %q)", r.Method, localPath, fileInfo.Size(), r.Header.Get("Range"))
+}
+
+// HandleFile dispatches file requests by method. Uploads, deletes and
+// multipart uploads are only accepted when writes are enabled.
+func (fs *FileServer) HandleFile(w http.ResponseWriter, r *http.Request) {
+	if isMultipartRequest(r) {
+		fs.HandleMultipart(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		fs.UploadFile(w, r)
+	case http.MethodDelete:
+		fs.DeleteFile(w, r)
+	default:
+		fs.ServeFile(w, r)
+	}
+}
+
+// authorizeWrite checks that writes are enabled and that the request
+// carries the internal token shared with the gateway
+func (fs *FileServer) authorizeWrite(w http.ResponseWriter, r *http.Request) bool {
+	if !fs.allowWrites {
+		http.Error(w, "Writes are not enabled", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	token := r.Header.Get("X-Internal-Token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(fs.starfishToken)) != 1 {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// resolveRequestPath resolves the /volume/path/to/file request path to a
+// local filesystem path
+func (fs *FileServer) resolveRequestPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	pathParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(pathParts) < 2 || pathParts[1] == "" || strings.HasSuffix(pathParts[1], "/") {
+		http.Error(w, "Invalid path format. Expected: /volume/path/to/file", http.StatusBadRequest)
+		return "", false
+	}
+
+	localPath, err := fs.ResolvePath(pathParts[0], "/"+pathParts[1])
+	if err != nil {
+		log.Printf("Path resolution failed: %v", err)
+		http.Error(w, fmt.Sprintf("Path resolution failed: %v", err), http.StatusNotFound)
+		return "", false
+	}
+
+	return localPath, true
+}
+
+// UploadFile writes the request body to a file. The body is written to a
+// temporary file in the target directory and renamed into place, so
+// readers never see a partial file.
+func (fs *FileServer) UploadFile(w http.ResponseWriter, r *http.Request) {
+	if !fs.authorizeWrite(w, r) {
+		return
+	}
+
+	localPath, ok := fs.resolveRequestPath(w, r)
+	if !ok {
+		return
+	}
+
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create directory %s: %v", dir, err)
+		http.Error(w, "Failed to create directory", http.StatusConflict)
+		return
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		log.Printf("Failed to create temporary file in %s: %v", dir, err)
+		http.Error(w, "Failed to create file", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r.Body)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Failed to write %s: %v", localPath, err)
+		http.Error(w, "Failed to write file", http.StatusInternalServerError)
+		return
+	}
+
+	if r.ContentLength >= 0 && n != r.ContentLength {
+		http.Error(w, "Incomplete body", http.StatusBadRequest)
+		return
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		log.Printf("Failed to set mode of %s: %v", localPath, err)
+		http.Error(w, "Failed to write file", http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		log.Printf("Failed to rename upload to %s: %v", localPath, err)
+		http.Error(w, "Failed to write file", http.StatusConflict)
+		return
+	}
+
+	fileInfo, err := os.Stat(localPath)
+	if err != nil {
+		http.Error(w, "File access error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf("\"%d-%d\"", fileInfo.Size(), fileInfo.ModTime().Unix()))
 	w.Header().Set("Last-Modified", fileInfo.ModTime().UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+
+	log.Printf("Stored file: %s (%d bytes)", localPath, n)
+}
+
+// DeleteFile removes a file. Deleting a file that does not exist
+// succeeds, as in S3.
+func (fs *FileServer) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	if !fs.authorizeWrite(w, r) {
+		return
+	}
+
+	localPath, ok := fs.resolveRequestPath(w, r)
+	if !ok {
+		return
+	}
 
-	// Copy file content to response
-	_, err = io.Copy(w, file)
+	fileInfo, err := os.Lstat(localPath)
+	if errors.Is(err, os.ErrNotExist) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to send file content: %v", err)
+		http.Error(w, "File access error", http.StatusInternalServerError)
+		return
+	}
+	if !fileInfo.Mode().IsRegular() {
+		http.Error(w, "Not a regular file", http.StatusBadRequest)
+		return
+	}
+
+	if err := os.Remove(localPath); err != nil {
+		log.Printf("Failed to delete %s: %v", localPath, err)
+		http.Error(w, "Failed to delete file", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully served file: %s (%d bytes)", localPath, fileInfo.Size())
+	w.WriteHeader(http.StatusNoContent)
+	log.Printf("Deleted file: %s", localPath)
 }
 
 // HealthCheck handles health check requests
@@ -212,8 +374,8 @@ func (fs *FileServer) HealthCheck(w http.ResponseWriter, r *http.Request) {
 func (fs *FileServer) Start() error {
 	mux := http.NewServeMux()
 
-	// File serving endpoint
-	mux.HandleFunc("/", fs.ServeFile)
+	// File serving endpoint, and uploads and deletes if enabled
+	mux.HandleFunc("/", fs.HandleFile)
 
 	// Health check endpoint
 	mux.HandleFunc("/health", fs.HealthCheck)
@@ -231,6 +393,7 @@ func main() {
 		endpoint = flag.String("endpoint", "", "Starfish API endpoint (required)")
 		token    = flag.String("token", "", "Starfish API token (required)")
 		port     = flag.Int("port", 8080, "Port to listen on")
+		writes   = flag.Bool("allow-writes", false, "Accept uploads and deletes authenticated with the API token")
 	)
 	flag.Parse()
 
@@ -243,6 +406,7 @@ func main() {
 
 	// Create file server
 	fs := NewFileServer(*endpoint, *token, *port)
+	fs.allowWrites = *writes
 
 	// Load volume information
 	log.Printf("Loading volume information from Starfish API...")
@@ -0,0 +1,452 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFileServer(t *testing.T) (*FileServer, string, time.Time) {
+	t.Helper()
+
+	mount := t.TempDir()
+	dir := filepath.Join(mount, "data")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	path := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	fs := NewFileServer("", "", 0)
+	fs.volumes["vol1"] = &VolumeInfo{
+		Vol:    "vol1",
+		Mounts: map[string]string{"agent1": mount},
+	}
+
+	eTag := fmt.Sprintf("\"%d-%d\"", 10, modTime.Unix())
+	return fs, eTag, modTime
+}
+
+func TestServeFile(t *testing.T) {
+	fs, eTag, modTime := newTestFileServer(t)
+
+	before := modTime.Add(-time.Hour).Format(http.TimeFormat)
+	after := modTime.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name         string
+		method       string
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{
+			name:   "get",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			body:   "0123456789",
+		},
+		{
+			name:   "head",
+			method: http.MethodHead,
+			status: http.StatusOK,
+		},
+		{
+			name:         "range",
+			method:       http.MethodGet,
+			headers:      map[string]string{"Range": "bytes=2-5"},
+			status:       http.StatusPartialContent,
+			body:         "2345",
+			contentRange: "bytes 2-5/10",
+		},
+		{
+			name:    "range not satisfiable",
+			method:  http.MethodGet,
+			headers: map[string]string{"Range": "bytes=20-30"},
+			status:  http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:    "if-none-match",
+			method:  http.MethodGet,
+			headers: map[string]string{"If-None-Match": eTag},
+			status:  http.StatusNotModified,
+		},
+		{
+			name:    "if-none-match head",
+			method:  http.MethodHead,
+			headers: map[string]string{"If-None-Match": eTag},
+			status:  http.StatusNotModified,
+		},
+		{
+			name:    "if-modified-since",
+			method:  http.MethodGet,
+			headers: map[string]string{"If-Modified-Since": after},
+			status:  http.StatusNotModified,
+		},
+		{
+			name:    "if-match",
+			method:  http.MethodGet,
+			headers: map[string]string{"If-Match": eTag},
+			status:  http.StatusOK,
+			body:    "0123456789",
+		},
+		{
+			name:    "if-match failed",
+			method:  http.MethodGet,
+			headers: map[string]string{"If-Match": "\"other\""},
+			status:  http.StatusPreconditionFailed,
+		},
+		{
+			name:    "if-unmodified-since failed",
+			method:  http.MethodGet,
+			headers: map[string]string{"If-Unmodified-Since": before},
+			status:  http.StatusPreconditionFailed,
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodPut,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/vol1/data/file.txt", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+
+			fs.ServeFile(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, rec.Body.String())
+			}
+			if tt.contentRange != "" && rec.Header().Get("Content-Range") != tt.contentRange {
+				t.Errorf("expected Content-Range %q, got %q", tt.contentRange, rec.Header().Get("Content-Range"))
+			}
+
+			switch tt.status {
+			case http.StatusOK, http.StatusPartialContent:
+				if rec.Header().Get("ETag") != eTag {
+					t.Errorf("expected ETag %s, got %s", eTag, rec.Header().Get("ETag"))
+				}
+			}
+			if tt.method == http.MethodHead {
+				if rec.Body.Len() != 0 {
+					t.Errorf("expected no body for HEAD, got %q", rec.Body.String())
+				}
+				if tt.status == http.StatusOK && rec.Header().Get("Content-Length") != "10" {
+					t.Errorf("expected Content-Length 10, got %q", rec.Header().Get("Content-Length"))
+				}
+			}
+			if tt.status == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("expected no body for 304, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServeFileNotFound(t *testing.T) {
+	fs, _, _ := newTestFileServer(t)
+
+	for _, path := range []string{"/vol1/data/missing.txt", "/unknown/data/file.txt"} {
+		rec := httptest.NewRecorder()
+		fs.ServeFile(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	fs, _, _ := newTestFileServer(t)
+	fs.starfishToken = "secret"
+	mount := fs.volumes["vol1"].Mounts["agent1"]
+
+	upload := func(path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("X-Internal-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		fs.HandleFile(rec, req)
+		return rec
+	}
+
+	// Writes are refused until enabled
+	if rec := upload("/vol1/data/new.txt", "secret", "hello"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405 with writes disabled, got %d", rec.Code)
+	}
+
+	fs.allowWrites = true
+
+	for _, token := range []string{"", "wrong"} {
+		if rec := upload("/vol1/data/new.txt", token, "hello"); rec.Code != http.StatusForbidden {
+			t.Errorf("token %q: expected status 403, got %d", token, rec.Code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(mount, "data", "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected unauthorized upload not to create a file, got %v", err)
+	}
+
+	rec := upload("/vol1/data/sub/new.txt", "secret", "hello")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(mount, "data", "sub", "new.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("expected uploaded content, got %q, %v", data, err)
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Error("expected ETag of the stored file")
+	}
+
+	// Overwrites replace the file
+	if rec := upload("/vol1/data/file.txt", "secret", "new content"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", rec.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(mount, "data", "file.txt")); string(data) != "new content" {
+		t.Errorf("expected overwritten content, got %q", data)
+	}
+
+	// Paths cannot escape the volume mount
+	if rec := upload("/vol1/../../escape.txt", "secret", "x"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(mount, "escape.txt")); err != nil {
+		t.Errorf("expected upload to stay below the mount: %v", err)
+	}
+
+	if rec := upload("/vol1/data/", "secret", "x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a directory, got %d", rec.Code)
+	}
+	if rec := upload("/unknown/data/new.txt", "secret", "x"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown volume, got %d", rec.Code)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Join(mount, "data"))
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".upload-") {
+			t.Errorf("unexpected temporary file %s", entry.Name())
+		}
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	fs, _, _ := newTestFileServer(t)
+	fs.starfishToken = "secret"
+	mount := fs.volumes["vol1"].Mounts["agent1"]
+
+	remove := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("X-Internal-Token", token)
+		rec := httptest.NewRecorder()
+		fs.HandleFile(rec, req)
+		return rec.Code
+	}
+
+	if code := remove("/vol1/data/file.txt", "secret"); code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405 with writes disabled, got %d", code)
+	}
+
+	fs.allowWrites = true
+
+	if code := remove("/vol1/data/file.txt", "wrong"); code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", code)
+	}
+	if code := remove("/vol1/data/file.txt", "secret"); code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(mount, "data", "file.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected file to be deleted, got %v", err)
+	}
+
+	// Deleting a missing file succeeds, directories are never removed
+	if code := remove("/vol1/data/file.txt", "secret"); code != http.StatusNoContent {
+		t.Errorf("expected status 204 for a missing file, got %d", code)
+	}
+	if code := remove("/vol1/data", "secret"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a directory, got %d", code)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	fs, _, _ := newTestFileServer(t)
+	fs.starfishToken = "secret"
+	fs.allowWrites = true
+	mount := fs.volumes["vol1"].Mounts["agent1"]
+
+	do := func(method, target string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-Internal-Token", "secret")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		fs.HandleFile(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/vol1/data/big.bin?uploads", `{"checksumAlgorithm":"CRC32"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var upload uploadInfo
+	if err := json.NewDecoder(rec.Body).Decode(&upload); err != nil {
+		t.Fatalf("decode upload: %v", err)
+	}
+	uploadURL := "/vol1/data/big.bin?uploadId=" + upload.UploadID
+
+	crc := func(data string) string {
+		sum := crc32.ChecksumIEEE([]byte(data))
+		return base64.StdEncoding.EncodeToString([]byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+	}
+
+	// A part whose checksum does not match is not staged
+	rec = do(http.MethodPut, uploadURL+"&partNumber=1", "hello ", map[string]string{
+		"X-Checksum-Algorithm": "CRC32",
+		"X-Checksum":           crc("other"),
+	})
+	if rec.Code != http.StatusBadRequest || strings.TrimSpace(rec.Body.String()) != "BadDigest" {
+		t.Fatalf("expected BadDigest, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for i, data := range []string{"hello ", "world"} {
+		rec = do(http.MethodPut, fmt.Sprintf("%s&partNumber=%d", uploadURL, i+1), data, map[string]string{
+			"X-Checksum-Algorithm": "CRC32",
+			"X-Checksum":           crc(data),
+		})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("part %d: expected status 201, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+		var part partInfo
+		json.NewDecoder(rec.Body).Decode(&part)
+		md5Sum := md5.Sum([]byte(data))
+		if part.ETag != fmt.Sprintf("\"%x\"", md5Sum) || part.Checksum != crc(data) {
+			t.Errorf("part %d: unexpected ETag %s or checksum %s", i+1, part.ETag, part.Checksum)
+		}
+	}
+
+	if rec := do(http.MethodPut, uploadURL+"&partNumber=10001", "x", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid part number, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodGet, uploadURL, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var described uploadInfo
+	json.NewDecoder(rec.Body).Decode(&described)
+	if len(described.Parts) != 2 || described.Parts[0].PartNumber != 1 || described.Parts[1].Size != 5 {
+		t.Errorf("unexpected parts %+v", described.Parts)
+	}
+	if string(described.Metadata) != `{"checksumAlgorithm":"CRC32"}` {
+		t.Errorf("expected upload metadata to be kept, got %s", described.Metadata)
+	}
+
+	// A full object checksum mismatch leaves the upload in place
+	rec = do(http.MethodPost, uploadURL, `{"parts":[1,2],"checksumAlgorithm":"CRC32","checksum":"`+crc("other")+`"}`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(mount, "data", "big.bin")); !os.IsNotExist(err) {
+		t.Fatalf("expected no file after a failed complete, got %v", err)
+	}
+
+	rec = do(http.MethodPost, uploadURL, `{"parts":[1,2],"checksumAlgorithm":"CRC32","checksum":"`+crc("hello world")+`"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var completed completeResponse
+	json.NewDecoder(rec.Body).Decode(&completed)
+	if completed.Size != 11 || completed.Checksum != crc("hello world") {
+		t.Errorf("unexpected complete response %+v", completed)
+	}
+	if data, _ := os.ReadFile(filepath.Join(mount, "data", "big.bin")); string(data) != "hello world" {
+		t.Errorf("expected assembled file, got %q", data)
+	}
+
+	// The upload is gone once completed
+	if rec := do(http.MethodGet, uploadURL, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after complete, got %d", rec.Code)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(mount, multipartDir)); len(entries) != 0 {
+		t.Errorf("expected staging directory to be cleaned up, got %d entries", len(entries))
+	}
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	fs, _, _ := newTestFileServer(t)
+	fs.starfishToken = "secret"
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		var body io.Reader
+		if method == http.MethodPut {
+			body = strings.NewReader("data")
+		}
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set("X-Internal-Token", "secret")
+		rec := httptest.NewRecorder()
+		fs.HandleFile(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/vol1/data/big.bin?uploads"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405 with writes disabled, got %d", rec.Code)
+	}
+
+	fs.allowWrites = true
+
+	rec := do(http.MethodPost, "/vol1/data/big.bin?uploads")
+	var upload uploadInfo
+	json.NewDecoder(rec.Body).Decode(&upload)
+	uploadURL := "/vol1/data/big.bin?uploadId=" + upload.UploadID
+
+	if rec := do(http.MethodPut, uploadURL+"&partNumber=1"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", rec.Code)
+	}
+
+	// Uploads belong to one file
+	if rec := do(http.MethodGet, "/vol1/data/other.bin?uploadId="+upload.UploadID); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for another file, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/vol1/data/big.bin?uploadId=../../data"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an invalid upload id, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodDelete, uploadURL); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, uploadURL+"&partNumber=2"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after abort, got %d", rec.Code)
+	}
+}
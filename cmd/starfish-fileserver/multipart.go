@@ -0,0 +1,497 @@
+// Copyright (c) 2025 Starfish Storage, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"github.com/versity/versitygw/s3api/utils"
+	"github.com/versity/versitygw/s3err"
+)
+
+// multipartDir is where uploads are staged, relative to the volume mount.
+// Parts are staged on the volume of the target file so they can be
+// assembled in place.
+const multipartDir = ".sgwtmp/multipart"
+
+// maxPartNumber is the highest part number S3 allows
+const maxPartNumber = 10000
+
+// uploadInfo describes a staged multipart upload. Metadata is kept for the
+// gateway as it was given when the upload was created.
+type uploadInfo struct {
+	UploadID  string          `json:"uploadId"`
+	Path      string          `json:"path"`
+	Initiated time.Time       `json:"initiated"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	Parts     []partInfo      `json:"parts,omitempty"`
+}
+
+// partInfo describes a staged part. Checksum is computed with the
+// algorithm requested when the part was uploaded.
+type partInfo struct {
+	PartNumber   int       `json:"partNumber"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	ETag         string    `json:"etag"`
+	Checksum     string    `json:"checksum,omitempty"`
+}
+
+// completeRequest lists the parts assembled into the file, in order. If
+// ChecksumAlgorithm is set the checksum of the whole file is computed, and
+// checked against Checksum if that is set.
+type completeRequest struct {
+	Parts             []int  `json:"parts"`
+	ChecksumAlgorithm string `json:"checksumAlgorithm,omitempty"`
+	Checksum          string `json:"checksum,omitempty"`
+}
+
+// completeResponse describes the assembled file
+type completeResponse struct {
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// isMultipartRequest reports whether a request is for a multipart upload
+func isMultipartRequest(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("uploads") || query.Has("uploadId")
+}
+
+// HandleMultipart dispatches multipart upload requests:
+//
+//	POST   /volume/path?uploads                     create an upload
+//	PUT    /volume/path?uploadId=ID&partNumber=N    stage a part
+//	GET    /volume/path?uploadId=ID                 describe an upload and its parts
+//	POST   /volume/path?uploadId=ID                 assemble the parts into the file
+//	DELETE /volume/path?uploadId=ID                 abort an upload
+func (fs *FileServer) HandleMultipart(w http.ResponseWriter, r *http.Request) {
+	if !fs.authorizeWrite(w, r) {
+		return
+	}
+
+	volume, filePath, ok := splitRequestPath(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("uploads") {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fs.createUpload(w, r, volume, filePath)
+		return
+	}
+
+	uploadDir, ok := fs.uploadDir(w, volume, filePath, query.Get("uploadId"))
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		fs.uploadPart(w, r, uploadDir)
+	case http.MethodGet:
+		fs.describeUpload(w, uploadDir)
+	case http.MethodPost:
+		fs.completeUpload(w, r, volume, filePath, uploadDir)
+	case http.MethodDelete:
+		fs.abortUpload(w, uploadDir)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// splitRequestPath splits a /volume/path/to/file request path
+func splitRequestPath(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	pathParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(pathParts) < 2 || pathParts[1] == "" || strings.HasSuffix(pathParts[1], "/") {
+		http.Error(w, "Invalid path format. Expected: /volume/path/to/file", http.StatusBadRequest)
+		return "", "", false
+	}
+	return pathParts[0], strings.TrimPrefix(filepath.Clean("/"+pathParts[1]), "/"), true
+}
+
+// uploadRoot returns the staging directory of all uploads of a file
+func (fs *FileServer) uploadRoot(volume, filePath string) (string, error) {
+	mount, err := fs.ResolvePath(volume, "/")
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(filePath))
+	return filepath.Join(mount, multipartDir, hex.EncodeToString(sum[:])), nil
+}
+
+// uploadDir returns the staging directory of an existing upload
+func (fs *FileServer) uploadDir(w http.ResponseWriter, volume, filePath, uploadID string) (string, bool) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		http.Error(w, s3err.GetAPIError(s3err.ErrNoSuchUpload).Code, http.StatusNotFound)
+		return "", false
+	}
+
+	root, err := fs.uploadRoot(volume, filePath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Path resolution failed: %v", err), http.StatusNotFound)
+		return "", false
+	}
+
+	dir := filepath.Join(root, uploadID)
+	if _, err := os.Stat(filepath.Join(dir, "info.json")); err != nil {
+		http.Error(w, s3err.GetAPIError(s3err.ErrNoSuchUpload).Code, http.StatusNotFound)
+		return "", false
+	}
+
+	return dir, true
+}
+
+// createUpload creates the staging directory of a new upload
+func (fs *FileServer) createUpload(w http.ResponseWriter, r *http.Request, volume, filePath string) {
+	root, err := fs.uploadRoot(volume, filePath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Path resolution failed: %v", err), http.StatusNotFound)
+		return
+	}
+
+	metadata, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+	if len(metadata) > 0 && !json.Valid(metadata) {
+		http.Error(w, "Upload metadata must be JSON", http.StatusBadRequest)
+		return
+	}
+
+	info := uploadInfo{
+		UploadID:  uuid.New().String(),
+		Path:      filePath,
+		Initiated: time.Now().UTC(),
+		Metadata:  metadata,
+	}
+
+	dir := filepath.Join(root, info.UploadID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create upload directory %s: %v", dir, err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+	if err := writeJSONFile(filepath.Join(dir, "info.json"), info); err != nil {
+		log.Printf("Failed to store upload info in %s: %v", dir, err)
+		os.RemoveAll(dir)
+		os.Remove(root)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Created upload %s for %s:%s", info.UploadID, volume, filePath)
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// uploadPart stages a part. Its MD5 is returned as the ETag, and the
+// checksum of the algorithm in X-Checksum-Algorithm is computed and
+// compared with X-Checksum if given, so corrupted parts are never staged.
+func (fs *FileServer) uploadPart(w http.ResponseWriter, r *http.Request, uploadDir string) {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		http.Error(w, s3err.GetAPIError(s3err.ErrInvalidPartNumber).Code, http.StatusBadRequest)
+		return
+	}
+
+	hash := md5.New()
+	var rdr io.Reader = io.TeeReader(r.Body, hash)
+
+	var hashRdr *utils.HashReader
+	if algorithm := r.Header.Get("X-Checksum-Algorithm"); algorithm != "" {
+		hashRdr, err = utils.NewHashReader(rdr, r.Header.Get("X-Checksum"), utils.HashType(strings.ToLower(algorithm)))
+		if err != nil {
+			http.Error(w, s3err.GetAPIError(s3err.ErrInvalidChecksumAlgorithm).Code, http.StatusBadRequest)
+			return
+		}
+		rdr = hashRdr
+	}
+
+	tmp, err := os.CreateTemp(uploadDir, ".part-*")
+	if err != nil {
+		log.Printf("Failed to create part file in %s: %v", uploadDir, err)
+		http.Error(w, "Failed to create part", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, rdr)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		var apiErr s3err.APIError
+		if errors.As(err, &apiErr) {
+			http.Error(w, apiErr.Code, apiErr.HTTPStatusCode)
+			return
+		}
+		log.Printf("Failed to write part %d in %s: %v", partNumber, uploadDir, err)
+		http.Error(w, "Failed to write part", http.StatusInternalServerError)
+		return
+	}
+	if r.ContentLength >= 0 && n != r.ContentLength {
+		http.Error(w, "Incomplete body", http.StatusBadRequest)
+		return
+	}
+
+	part := partInfo{
+		PartNumber:   partNumber,
+		Size:         n,
+		LastModified: time.Now().UTC(),
+		ETag:         fmt.Sprintf("\"%s\"", hex.EncodeToString(hash.Sum(nil))),
+	}
+	if hashRdr != nil {
+		part.Checksum = hashRdr.Sum()
+	}
+
+	// The part info is stored last, parts are only listed once it exists
+	partPath := filepath.Join(uploadDir, strconv.Itoa(partNumber))
+	if err := os.Rename(tmp.Name(), partPath); err != nil {
+		log.Printf("Failed to store part %s: %v", partPath, err)
+		http.Error(w, "Failed to write part", http.StatusInternalServerError)
+		return
+	}
+	if err := writeJSONFile(partPath+".json", part); err != nil {
+		log.Printf("Failed to store part info %s: %v", partPath, err)
+		http.Error(w, "Failed to write part", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, part)
+}
+
+// describeUpload returns an upload and its staged parts in part number
+// order
+func (fs *FileServer) describeUpload(w http.ResponseWriter, uploadDir string) {
+	info, err := readUpload(uploadDir)
+	if err != nil {
+		log.Printf("Failed to read upload %s: %v", uploadDir, err)
+		http.Error(w, "Failed to read upload", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+// completeUpload concatenates parts into a temporary file next to the
+// target and renames it into place, then removes the upload
+func (fs *FileServer) completeUpload(w http.ResponseWriter, r *http.Request, volume, filePath, uploadDir string) {
+	var req completeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid complete request", http.StatusBadRequest)
+		return
+	}
+
+	localPath, err := fs.ResolvePath(volume, "/"+filePath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Path resolution failed: %v", err), http.StatusNotFound)
+		return
+	}
+
+	// The checksum is compared once all parts are read, the hash reader
+	// would compare it at the end of each part
+	var hashRdr *utils.HashReader
+	if req.ChecksumAlgorithm != "" {
+		hashRdr, err = utils.NewHashReader(nil, "", utils.HashType(strings.ToLower(req.ChecksumAlgorithm)))
+		if err != nil {
+			http.Error(w, s3err.GetAPIError(s3err.ErrInvalidChecksumAlgorithm).Code, http.StatusBadRequest)
+			return
+		}
+	}
+
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create directory %s: %v", dir, err)
+		http.Error(w, "Failed to create directory", http.StatusConflict)
+		return
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		log.Printf("Failed to create temporary file in %s: %v", dir, err)
+		http.Error(w, "Failed to create file", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := appendParts(tmp, uploadDir, req.Parts, hashRdr)
+	if err == nil && hashRdr != nil && req.Checksum != "" && hashRdr.Sum() != req.Checksum {
+		err = s3err.GetChecksumBadDigestErr(types.ChecksumAlgorithm(req.ChecksumAlgorithm))
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		var apiErr s3err.APIError
+		if errors.As(err, &apiErr) {
+			http.Error(w, apiErr.Code, apiErr.HTTPStatusCode)
+			return
+		}
+		log.Printf("Failed to assemble %s: %v", localPath, err)
+		http.Error(w, "Failed to assemble file", http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		log.Printf("Failed to set mode of %s: %v", localPath, err)
+		http.Error(w, "Failed to write file", http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		log.Printf("Failed to rename upload to %s: %v", localPath, err)
+		http.Error(w, "Failed to write file", http.StatusConflict)
+		return
+	}
+
+	removeUpload(uploadDir)
+
+	resp := completeResponse{Size: size}
+	if hashRdr != nil {
+		resp.Checksum = hashRdr.Sum()
+	}
+
+	log.Printf("Assembled file: %s (%d parts, %d bytes)", localPath, len(req.Parts), size)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// appendParts copies staged parts to f, through hashRdr if it is set
+func appendParts(f *os.File, uploadDir string, parts []int, hashRdr *utils.HashReader) (int64, error) {
+	var size int64
+	for _, partNumber := range parts {
+		pf, err := os.Open(filepath.Join(uploadDir, strconv.Itoa(partNumber)))
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, s3err.GetAPIError(s3err.ErrInvalidPart)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("open part %d: %w", partNumber, err)
+		}
+
+		var rdr io.Reader = pf
+		if hashRdr != nil {
+			hashRdr.SetReader(pf)
+			rdr = hashRdr
+		}
+
+		n, err := io.Copy(f, rdr)
+		pf.Close()
+		if err != nil {
+			return 0, fmt.Errorf("copy part %d: %w", partNumber, err)
+		}
+		size += n
+	}
+
+	return size, nil
+}
+
+// abortUpload removes an upload and its parts
+func (fs *FileServer) abortUpload(w http.ResponseWriter, uploadDir string) {
+	removeUpload(uploadDir)
+	w.WriteHeader(http.StatusNoContent)
+	log.Printf("Aborted upload: %s", uploadDir)
+}
+
+// removeUpload removes an upload, and the directory of the file's uploads
+// unless other uploads of the same file are outstanding
+func removeUpload(uploadDir string) {
+	os.RemoveAll(uploadDir)
+	os.Remove(filepath.Dir(uploadDir))
+}
+
+// readUpload reads an upload's info and the info of its staged parts
+func readUpload(uploadDir string) (uploadInfo, error) {
+	var info uploadInfo
+	data, err := os.ReadFile(filepath.Join(uploadDir, "info.json"))
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("parse upload info: %w", err)
+	}
+
+	entries, err := os.ReadDir(uploadDir)
+	if err != nil {
+		return info, err
+	}
+
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), ".json")
+		if !found {
+			continue
+		}
+		if _, err := strconv.Atoi(name); err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(uploadDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var part partInfo
+		if err := json.Unmarshal(data, &part); err != nil {
+			continue
+		}
+		info.Parts = append(info.Parts, part)
+	}
+
+	sort.Slice(info.Parts, func(i, j int) bool {
+		return info.Parts[i].PartNumber < info.Parts[j].PartNumber
+	})
+
+	return info, nil
+}
+
+// writeJSONFile atomically replaces a file with the JSON encoding of v
+func writeJSONFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".info-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -718,6 +718,14 @@ func runGateway(ctx context.Context, be backend.Backend) error {
 		return fmt.Errorf("init bucket event notifications: %w", err)
 	}
 
+	// Backends that find buckets added or removed outside of S3 requests
+	// report them through the gateway metrics and event notifications
+	if n, ok := be.(interface {
+		SetNotifiers(*metrics.Manager, s3event.S3EventSender)
+	}); ok {
+		n.SetNotifiers(metricsManager, evSender)
+	}
+
 	srv, err := s3api.New(app, be, middlewares.RootUserConfig{
 		Access: rootUserAccess,
 		Secret: rootUserSecret,
@@ -761,6 +769,13 @@ Loop:
 					break Loop
 				}
 			}
+			// A configuration that fails to reload leaves the backend
+			// running with its current configuration
+			if r, ok := be.(interface{ ReloadConfig() error }); ok {
+				if err := r.ReloadConfig(); err != nil {
+					fmt.Fprintf(os.Stderr, "HUP backend: %v\n", err)
+				}
+			}
 		}
 	}
 	saveErr := err
@@ -16,7 +16,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -30,6 +32,28 @@ var (
 	starfishCacheTTL                   int
 	starfishCollectionsRefreshInterval int
 	starfishPathRewriteConfig          string
+	starfishCollisionPolicy            string
+	starfishQueryPageSize              int
+	starfishShardVolumes               bool
+	starfishShardWorkers               int
+	starfishListCacheEntries           int
+	starfishQueryCacheEntries          int
+	starfishQueryCacheBytes            int64
+	starfishStaleCacheTTL              int
+	starfishQueryRetries               int
+	starfishBreakerThreshold           int
+	starfishBreakerCooldown            time.Duration
+	starfishRewriteIndexSize           int
+	starfishMetadataDir                string
+	starfishDefaultOwner               string
+	starfishIncludeInheritedTags       bool
+	starfishContentETags               bool
+	starfishHashCacheEntries           int
+	starfishWriteConfig                string
+	starfishBucketSource               string
+	starfishBucketTagset               string
+	starfishBucketAliases              string
+	starfishVirtualBuckets             string
 
 	// TLS Configuration
 	starfishTLSCertFile           string
@@ -41,6 +65,12 @@ var (
 	starfishConnectionPoolSize  int
 	starfishMaxIdleConnsPerHost int
 	starfishIdleConnTimeout     time.Duration
+
+	// rewrite-test
+	rewriteTestRules   string
+	rewriteTestBucket  string
+	rewriteTestEntries string
+	rewriteTestLimit   int
 )
 
 func starfishCommand() *cli.Command {
@@ -57,20 +87,59 @@ etc.) are not supported.
 Example usage:
 versitygw starfish --endpoint http://starfish-api:8080 --token your-bearer-token`,
 		Action: runStarfish,
+		Subcommands: []*cli.Command{
+			{
+				Name:  "rewrite-test",
+				Usage: "show the keys path rewrite rules give to sample entries or a collection",
+				Description: `Applies the rules of a path rewrite configuration file as listings would,
+printing each original key with its rewritten key and the rule that
+produced it. Template errors and entries rewritten to the same key are
+reported, and make the command fail.
+
+Entries are read from a JSON file holding an array of Starfish query
+results, or queried live from the collection behind --bucket:
+
+versitygw starfish rewrite-test --rules rules.json --bucket archive --entries sample.json
+versitygw starfish --endpoint http://starfish-api:8080 --token your-bearer-token rewrite-test --rules rules.json --bucket archive`,
+				Action: runStarfishRewriteTest,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "rules",
+						Usage:       "path rewrite rules configuration file to test",
+						Destination: &rewriteTestRules,
+						Required:    true,
+					},
+					&cli.StringFlag{
+						Name:        "bucket",
+						Usage:       "bucket whose rules are applied, and whose collection is queried without --entries",
+						Destination: &rewriteTestBucket,
+					},
+					&cli.StringFlag{
+						Name:        "entries",
+						Usage:       "JSON file with an array of sample Starfish entries",
+						Destination: &rewriteTestEntries,
+					},
+					&cli.IntFlag{
+						Name:        "limit",
+						Usage:       "maximum number of entries queried from the collection",
+						Destination: &rewriteTestLimit,
+						Value:       1000,
+					},
+				},
+			},
+		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:        "endpoint",
 				Usage:       "starfish API endpoint URL",
 				EnvVars:     []string{"VGW_STARFISH_ENDPOINT"},
 				Destination: &starfishAPIEndpoint,
-				Required:    true,
 			},
 			&cli.StringFlag{
 				Name:        "token",
 				Usage:       "starfish API bearer token (also used for file server authentication)",
 				EnvVars:     []string{"VGW_STARFISH_TOKEN"},
 				Destination: &starfishBearerToken,
-				Required:    true,
 			},
 			&cli.StringFlag{
 				Name:        "file-server",
@@ -98,6 +167,152 @@ versitygw starfish --endpoint http://starfish-api:8080 --token your-bearer-token
 				EnvVars:     []string{"VGW_STARFISH_PATH_REWRITE_CONFIG"},
 				Destination: &starfishPathRewriteConfig,
 			},
+			&cli.StringFlag{
+				Name:        "collision-policy",
+				Usage:       "handling of files listed under the same object key: suffix, first-wins or error",
+				EnvVars:     []string{"VGW_STARFISH_COLLISION_POLICY"},
+				Destination: &starfishCollisionPolicy,
+				Value:       starfish.CollisionSuffix,
+			},
+			&cli.IntFlag{
+				Name:        "query-page-size",
+				Usage:       "number of entries fetched per Starfish query when paging through listings",
+				EnvVars:     []string{"VGW_STARFISH_QUERY_PAGE_SIZE"},
+				Destination: &starfishQueryPageSize,
+				Value:       1000,
+			},
+			&cli.BoolFlag{
+				Name:        "shard-volumes",
+				Usage:       "query each volume of a multi-volume collection concurrently when listing",
+				EnvVars:     []string{"VGW_STARFISH_SHARD_VOLUMES"},
+				Destination: &starfishShardVolumes,
+			},
+			&cli.IntFlag{
+				Name:        "shard-workers",
+				Usage:       "number of volumes queried at once when shard-volumes is enabled",
+				EnvVars:     []string{"VGW_STARFISH_SHARD_WORKERS"},
+				Destination: &starfishShardWorkers,
+				Value:       8,
+			},
+			&cli.IntFlag{
+				Name:        "list-cache-entries",
+				Usage:       "maximum number of entries kept across cached object listings",
+				EnvVars:     []string{"VGW_STARFISH_LIST_CACHE_ENTRIES"},
+				Destination: &starfishListCacheEntries,
+				Value:       1000000,
+			},
+			&cli.IntFlag{
+				Name:        "query-cache-entries",
+				Usage:       "maximum number of Starfish query results kept in the query cache",
+				EnvVars:     []string{"VGW_STARFISH_QUERY_CACHE_ENTRIES"},
+				Destination: &starfishQueryCacheEntries,
+				Value:       10000,
+			},
+			&cli.Int64Flag{
+				Name:        "query-cache-bytes",
+				Usage:       "approximate memory budget in bytes of the query cache",
+				EnvVars:     []string{"VGW_STARFISH_QUERY_CACHE_BYTES"},
+				Destination: &starfishQueryCacheBytes,
+				Value:       256 << 20,
+			},
+			&cli.IntFlag{
+				Name:        "stale-cache-ttl",
+				Usage:       "minutes expired query results are served while the Starfish API is unavailable (0 disables)",
+				EnvVars:     []string{"VGW_STARFISH_STALE_CACHE_TTL"},
+				Destination: &starfishStaleCacheTTL,
+				Value:       60,
+			},
+			&cli.IntFlag{
+				Name:        "query-retries",
+				Usage:       "retries of Starfish queries while the API is unavailable (0 disables)",
+				EnvVars:     []string{"VGW_STARFISH_QUERY_RETRIES"},
+				Destination: &starfishQueryRetries,
+				Value:       2,
+			},
+			&cli.IntFlag{
+				Name:        "breaker-threshold",
+				Usage:       "consecutive failed Starfish queries that pause queries to the API (0 disables)",
+				EnvVars:     []string{"VGW_STARFISH_BREAKER_THRESHOLD"},
+				Destination: &starfishBreakerThreshold,
+				Value:       5,
+			},
+			&cli.DurationFlag{
+				Name:        "breaker-cooldown",
+				Usage:       "how long Starfish queries are paused after repeated failures",
+				EnvVars:     []string{"VGW_STARFISH_BREAKER_COOLDOWN"},
+				Destination: &starfishBreakerCooldown,
+				Value:       30 * time.Second,
+			},
+			&cli.IntFlag{
+				Name:        "rewrite-index-size",
+				Usage:       "maximum number of rewritten object keys remembered for object lookups",
+				EnvVars:     []string{"VGW_STARFISH_REWRITE_INDEX_SIZE"},
+				Destination: &starfishRewriteIndexSize,
+				Value:       100000,
+			},
+			&cli.StringFlag{
+				Name:        "metadata-dir",
+				Usage:       "directory to store bucket ACLs, policies, ownership controls and tagging",
+				EnvVars:     []string{"VGW_STARFISH_METADATA_DIR"},
+				Destination: &starfishMetadataDir,
+			},
+			&cli.StringFlag{
+				Name:        "default-owner",
+				Usage:       "access key of the owner of collections without a stored ACL",
+				EnvVars:     []string{"VGW_STARFISH_DEFAULT_OWNER"},
+				Destination: &starfishDefaultOwner,
+			},
+			&cli.BoolFlag{
+				Name:        "include-inherited-tags",
+				Usage:       "include tags inherited from parent directories in object tagging",
+				EnvVars:     []string{"VGW_STARFISH_INCLUDE_INHERITED_TAGS"},
+				Destination: &starfishIncludeInheritedTags,
+			},
+			&cli.BoolFlag{
+				Name:        "content-etags",
+				Usage:       "use MD5 ETags and SHA256/CRC32C checksums of file content, read through the file server",
+				EnvVars:     []string{"VGW_STARFISH_CONTENT_ETAGS"},
+				Destination: &starfishContentETags,
+			},
+			&cli.IntFlag{
+				Name:        "hash-cache-entries",
+				Usage:       "maximum number of files whose content hashes are cached",
+				EnvVars:     []string{"VGW_STARFISH_HASH_CACHE_ENTRIES"},
+				Destination: &starfishHashCacheEntries,
+				Value:       100000,
+			},
+			&cli.StringFlag{
+				Name:        "write-config",
+				Usage:       "path to the configuration of writable collections (optional, read-only if not set)",
+				EnvVars:     []string{"VGW_STARFISH_WRITE_CONFIG"},
+				Destination: &starfishWriteConfig,
+			},
+			&cli.StringFlag{
+				Name:        "bucket-source",
+				Usage:       "what buckets are mapped from: tagset, zone or volume",
+				EnvVars:     []string{"VGW_STARFISH_BUCKET_SOURCE"},
+				Destination: &starfishBucketSource,
+				Value:       starfish.BucketSourceTagset,
+			},
+			&cli.StringFlag{
+				Name:        "bucket-tagset",
+				Usage:       "tagset whose tags are buckets when the bucket source is tagset",
+				EnvVars:     []string{"VGW_STARFISH_BUCKET_TAGSET"},
+				Destination: &starfishBucketTagset,
+				Value:       "Collections",
+			},
+			&cli.StringFlag{
+				Name:        "bucket-aliases",
+				Usage:       "path to a JSON file mapping bucket names to tags, zones or volumes (optional)",
+				EnvVars:     []string{"VGW_STARFISH_BUCKET_ALIASES"},
+				Destination: &starfishBucketAliases,
+			},
+			&cli.StringFlag{
+				Name:        "virtual-buckets",
+				Usage:       "path to a JSON file mapping bucket names to Starfish queries selecting their files (optional)",
+				EnvVars:     []string{"VGW_STARFISH_VIRTUAL_BUCKETS"},
+				Destination: &starfishVirtualBuckets,
+			},
 			&cli.StringFlag{
 				Name:        "tls-cert",
 				Usage:       "path to TLS certificate file for Starfish API connections",
@@ -168,6 +383,24 @@ func runStarfish(ctx *cli.Context) error {
 		fmt.Printf("Loaded path rewrite configuration from: %s\n", starfishPathRewriteConfig)
 	}
 
+	// Load the writable collections if specified
+	writeConfig, err := starfish.LoadWriteConfig(starfishWriteConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load write configuration: %w", err)
+	}
+
+	// Load the bucket names of collections if specified
+	bucketAliases, err := starfish.LoadBucketAliases(starfishBucketAliases)
+	if err != nil {
+		return fmt.Errorf("failed to load bucket aliases: %w", err)
+	}
+
+	// Load the buckets defined by a Starfish query if specified
+	virtualBuckets, err := starfish.LoadVirtualBuckets(starfishVirtualBuckets)
+	if err != nil {
+		return fmt.Errorf("failed to load virtual buckets: %w", err)
+	}
+
 	config := &starfish.StarfishConfig{
 		APIEndpoint:                starfishAPIEndpoint,
 		BearerToken:                starfishBearerToken,
@@ -175,6 +408,29 @@ func runStarfish(ctx *cli.Context) error {
 		CacheTTL:                   time.Duration(starfishCacheTTL) * time.Minute,
 		CollectionsRefreshInterval: time.Duration(starfishCollectionsRefreshInterval) * time.Minute,
 		PathRewriteConfig:          pathRewriteConfig,
+		PathRewriteConfigFile:      starfishPathRewriteConfig,
+		CollisionPolicy:            starfishCollisionPolicy,
+		QueryPageSize:              starfishQueryPageSize,
+		ShardVolumes:               starfishShardVolumes,
+		ShardWorkers:               starfishShardWorkers,
+		ListCacheEntries:           starfishListCacheEntries,
+		QueryCacheEntries:          starfishQueryCacheEntries,
+		QueryCacheBytes:            starfishQueryCacheBytes,
+		StaleCacheTTL:              disabledIfZero(time.Duration(starfishStaleCacheTTL) * time.Minute),
+		QueryRetries:               disabledIfZero(starfishQueryRetries),
+		BreakerThreshold:           disabledIfZero(starfishBreakerThreshold),
+		BreakerCooldown:            starfishBreakerCooldown,
+		RewriteIndexSize:           starfishRewriteIndexSize,
+		MetadataDir:                starfishMetadataDir,
+		DefaultOwner:               starfishDefaultOwner,
+		IncludeInheritedTags:       starfishIncludeInheritedTags,
+		ContentETags:               starfishContentETags,
+		HashCacheEntries:           starfishHashCacheEntries,
+		WriteConfig:                writeConfig,
+		BucketSource:               starfishBucketSource,
+		BucketTagset:               starfishBucketTagset,
+		BucketAliases:              bucketAliases,
+		VirtualBuckets:             virtualBuckets,
 		TLSCertFile:                starfishTLSCertFile,
 		TLSKeyFile:                 starfishTLSKeyFile,
 		TLSInsecureSkipVerify:      starfishTLSInsecureSkipVerify,
@@ -189,41 +445,140 @@ func runStarfish(ctx *cli.Context) error {
 		return fmt.Errorf("failed to init starfish backend: %w", err)
 	}
 
-	// Initialize collections by discovering Collections: tagset tags
+	// Initialize collections by discovering the buckets of the bucket source
 	fmt.Println("Initializing Starfish collections...")
 	if err := be.InitializeCollections(ctx.Context); err != nil {
 		return fmt.Errorf("failed to initialize collections: %w", err)
 	}
 
-	// Start background refresh goroutine
-	go func(be *starfish.StarfishBackend, ctx context.Context) {
-		interval := be.CollectionsRefreshInterval
-		if interval <= 0 {
-			interval = 10 * time.Minute
-		}
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(interval):
-				fmt.Println("Refreshing Starfish collections...")
-				if err := be.InitializeCollections(ctx); err != nil {
-					fmt.Printf("[WARN] Failed to refresh Starfish collections: %v\n", err)
-				}
-			}
-		}
-	}(be, ctx.Context)
+	// Keep discovering added and removed collections until shutdown
+	be.StartCollectionsRefresh()
 
 	// Report discovered collections
 	collections := be.GetAllCollections()
 	if len(collections) == 0 {
-		fmt.Println("No tags found in Collections: tagset - no S3 buckets will be available")
+		fmt.Printf("No buckets found from %s source - no S3 buckets will be available\n", starfishBucketSource)
 	} else {
-		fmt.Printf("Discovered %d collections from Collections: tagset:\n", len(collections))
+		fmt.Printf("Discovered %d collections from %s source:\n", len(collections), starfishBucketSource)
 		for bucketName, collectionTag := range collections {
-			fmt.Printf("  - Bucket: %s -> Tag: %s\n", bucketName, collectionTag)
+			fmt.Printf("  - Bucket: %s -> %s: %s\n", bucketName, starfishBucketSource, collectionTag)
 		}
 	}
 
 	return runGateway(ctx.Context, be)
 }
+
+// disabledIfZero turns a flag set to 0 into the negative value the
+// Starfish backend takes as disabled, zero values select its defaults
+func disabledIfZero[T int | time.Duration](v T) T {
+	if v == 0 {
+		return -1
+	}
+	return v
+}
+
+// runStarfishRewriteTest applies path rewrite rules to sample entries or
+// the entries of a collection and prints the resulting keys
+func runStarfishRewriteTest(ctx *cli.Context) error {
+	rules, err := starfish.LoadPathRewriteConfig(rewriteTestRules)
+	if err != nil {
+		return err
+	}
+
+	var entries []starfish.StarfishEntry
+	if rewriteTestEntries != "" {
+		data, err := os.ReadFile(rewriteTestEntries)
+		if err != nil {
+			return fmt.Errorf("read entries: %w", err)
+		}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("parse entries: %w", err)
+		}
+	} else {
+		entries, err = queryRewriteTestEntries(ctx.Context)
+		if err != nil {
+			return err
+		}
+	}
+
+	var rewritten, hidden, failed, collisions int
+	for _, result := range rules.Explain(rewriteTestBucket, entries) {
+		if result.Excluded >= 0 {
+			fmt.Printf("%s excluded [exclude rule %d]\n", result.OriginalKey, result.Excluded)
+			hidden++
+			continue
+		}
+
+		rule := "no rule matched"
+		if result.Rule >= 0 {
+			r := rules.Rules[result.Rule]
+			rule = fmt.Sprintf("rule %d (bucket %s, priority %d, pattern %s)", result.Rule, r.Bucket, r.Priority, r.Pattern)
+			rewritten++
+		}
+		fmt.Printf("%s -> %s [%s]\n", result.OriginalKey, result.Key, rule)
+
+		for _, ruleErr := range result.Errors {
+			fmt.Printf("  template error: %v\n", ruleErr)
+			failed++
+		}
+		if result.CollidesWith != "" {
+			fmt.Printf("  collision: %s is also the key of %s\n", result.Key, result.CollidesWith)
+			collisions++
+		}
+	}
+
+	fmt.Printf("\n%d entries, %d rewritten, %d excluded, %d template errors, %d collisions\n",
+		len(entries), rewritten, hidden, failed, collisions)
+	if failed > 0 || collisions > 0 {
+		return fmt.Errorf("rewrite rules produced %d template errors and %d collisions", failed, collisions)
+	}
+	return nil
+}
+
+// queryRewriteTestEntries queries Starfish for the entries of the
+// rewrite-test bucket
+func queryRewriteTestEntries(ctx context.Context) ([]starfish.StarfishEntry, error) {
+	if rewriteTestBucket == "" {
+		return nil, fmt.Errorf("either --entries or --bucket is required")
+	}
+	if starfishAPIEndpoint == "" || starfishBearerToken == "" {
+		return nil, fmt.Errorf("starfish --endpoint and --token are required to query a collection")
+	}
+
+	bucketAliases, err := starfish.LoadBucketAliases(starfishBucketAliases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bucket aliases: %w", err)
+	}
+	virtualBuckets, err := starfish.LoadVirtualBuckets(starfishVirtualBuckets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load virtual buckets: %w", err)
+	}
+
+	be, err := starfish.NewStarfishBackend(&starfish.StarfishConfig{
+		APIEndpoint:           starfishAPIEndpoint,
+		BearerToken:           starfishBearerToken,
+		QueryPageSize:         rewriteTestLimit,
+		BucketSource:          starfishBucketSource,
+		BucketTagset:          starfishBucketTagset,
+		BucketAliases:         bucketAliases,
+		VirtualBuckets:        virtualBuckets,
+		TLSCertFile:           starfishTLSCertFile,
+		TLSKeyFile:            starfishTLSKeyFile,
+		TLSInsecureSkipVerify: starfishTLSInsecureSkipVerify,
+		TLSMinVersion:         starfishTLSMinVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init starfish backend: %w", err)
+	}
+	defer be.Shutdown()
+
+	if err := be.InitializeCollections(ctx); err != nil {
+		return nil, fmt.Errorf("failed to initialize collections: %w", err)
+	}
+
+	res, err := be.QueryStarfishPage(ctx, rewriteTestBucket, "", "type=f", 0)
+	if err != nil {
+		return nil, fmt.Errorf("query bucket %s: %w", rewriteTestBucket, err)
+	}
+	return res.Entries, nil
+}
@@ -191,6 +191,12 @@ func (m *Manager) add(key string, value int64, tags ...Tag) {
 	}
 }
 
+// Add adds value to key. It is used by backends to report their own
+// measurements outside of the per-request metrics sent by Send.
+func (m *Manager) Add(key string, value int64, tags ...Tag) {
+	m.add(key, value, tags...)
+}
+
 // Close closes metrics channels, waits for data to complete, closes all plugins
 func (m *Manager) Close() {
 	// drain the datapoint channels
@@ -519,11 +519,15 @@ func (c S3ApiController) GetActions(ctx *fiber.Ctx) error {
 
 	utils.ContextKeySkipResBodyLog.Set(ctx, true)
 	res, err := c.be.GetObject(ctx.Context(), &s3.GetObjectInput{
-		Bucket:       &bucket,
-		Key:          &key,
-		Range:        &acceptRange,
-		VersionId:    &versionId,
-		ChecksumMode: checksumMode,
+		Bucket:            &bucket,
+		Key:               &key,
+		Range:             &acceptRange,
+		VersionId:         &versionId,
+		ChecksumMode:      checksumMode,
+		IfMatch:           getOptionalHeader(ctx, "If-Match"),
+		IfNoneMatch:       getOptionalHeader(ctx, "If-None-Match"),
+		IfModifiedSince:   getDateHeader(ctx, "If-Modified-Since"),
+		IfUnmodifiedSince: getDateHeader(ctx, "If-Unmodified-Since"),
 	})
 	if err != nil {
 		if res != nil {
@@ -725,6 +729,30 @@ func getint64(i *int64) int64 {
 	return *i
 }
 
+// getOptionalHeader returns the value of a request header, or nil if the
+// header is not set
+func getOptionalHeader(ctx *fiber.Ctx, key string) *string {
+	value := ctx.Get(key)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// getDateHeader returns the time in an HTTP date request header. Invalid
+// dates are ignored, as they are for conditional requests in HTTP.
+func getDateHeader(ctx *fiber.Ctx, key string) *time.Time {
+	value := ctx.Get(key)
+	if value == "" {
+		return nil
+	}
+	tm, err := http.ParseTime(value)
+	if err != nil {
+		return nil
+	}
+	return &tm
+}
+
 func (c S3ApiController) ListActions(ctx *fiber.Ctx) error {
 	bucket := ctx.Params("bucket")
 	prefix := ctx.Query("prefix")
@@ -3331,12 +3359,16 @@ func (c S3ApiController) HeadObject(ctx *fiber.Ctx) error {
 
 	res, err := c.be.HeadObject(ctx.Context(),
 		&s3.HeadObjectInput{
-			Bucket:       &bucket,
-			Key:          &key,
-			PartNumber:   partNumber,
-			VersionId:    &versionId,
-			ChecksumMode: checksumMode,
-			Range:        &objRange,
+			Bucket:            &bucket,
+			Key:               &key,
+			PartNumber:        partNumber,
+			VersionId:         &versionId,
+			ChecksumMode:      checksumMode,
+			Range:             &objRange,
+			IfMatch:           getOptionalHeader(ctx, "If-Match"),
+			IfNoneMatch:       getOptionalHeader(ctx, "If-None-Match"),
+			IfModifiedSince:   getDateHeader(ctx, "If-Modified-Since"),
+			IfUnmodifiedSince: getDateHeader(ctx, "If-Unmodified-Since"),
 		})
 	if err != nil {
 		if res != nil {
@@ -3442,6 +3474,12 @@ func (c S3ApiController) HeadObject(ctx *fiber.Ctx) error {
 			Value: fmt.Sprintf("%v", *res.PartsCount),
 		})
 	}
+	if res.TagCount != nil {
+		headers = append(headers, utils.CustomHeader{
+			Key:   "x-amz-tagging-count",
+			Value: fmt.Sprint(*res.TagCount),
+		})
+	}
 	if res.LastModified != nil {
 		lastmod := res.LastModified.UTC().Format(timefmt)
 		headers = append(headers, utils.CustomHeader{
@@ -3929,6 +3967,10 @@ func SendResponse(ctx *fiber.Ctx, err error, l *MetaOpts) error {
 		var apierr s3err.APIError
 		if errors.As(err, &apierr) {
 			ctx.Status(apierr.HTTPStatusCode)
+			// A 304 response must not have a body
+			if apierr.HTTPStatusCode == http.StatusNotModified {
+				return nil
+			}
 			return ctx.Send(s3err.GetAPIErrorResponse(apierr, "", "", ""))
 		}
 
@@ -19,6 +19,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -1738,6 +1739,120 @@ func TestS3ApiController_HeadObject(t *testing.T) {
 	}
 }
 
+func TestS3ApiController_ConditionalRequests(t *testing.T) {
+	eTag := "\"10-1714564800\""
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	contentLength := int64(10)
+
+	// checkConditions mimics a backend evaluating the forwarded conditions
+	checkConditions := func(ifMatch, ifNoneMatch *string, ifModifiedSince, ifUnmodifiedSince *time.Time) error {
+		if ifMatch != nil && *ifMatch != eTag {
+			return s3err.GetAPIError(s3err.ErrPreconditionFailed)
+		}
+		if ifUnmodifiedSince != nil && lastModified.After(*ifUnmodifiedSince) {
+			return s3err.GetAPIError(s3err.ErrPreconditionFailed)
+		}
+		if ifNoneMatch != nil && *ifNoneMatch == eTag {
+			return s3err.GetAPIError(s3err.ErrNotModified)
+		}
+		if ifModifiedSince != nil && !lastModified.After(*ifModifiedSince) {
+			return s3err.GetAPIError(s3err.ErrNotModified)
+		}
+		return nil
+	}
+
+	app := fiber.New()
+	s3ApiController := S3ApiController{
+		be: &BackendMock{
+			GetBucketAclFunc: func(context.Context, *s3.GetBucketAclInput) ([]byte, error) {
+				return acldata, nil
+			},
+			GetObjectFunc: func(_ context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+				if err := checkConditions(input.IfMatch, input.IfNoneMatch,
+					input.IfModifiedSince, input.IfUnmodifiedSince); err != nil {
+					return nil, err
+				}
+				return &s3.GetObjectOutput{
+					ETag:          &eTag,
+					ContentLength: &contentLength,
+					LastModified:  &lastModified,
+					Body:          io.NopCloser(strings.NewReader("0123456789")),
+				}, nil
+			},
+			HeadObjectFunc: func(_ context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+				if err := checkConditions(input.IfMatch, input.IfNoneMatch,
+					input.IfModifiedSince, input.IfUnmodifiedSince); err != nil {
+					return nil, err
+				}
+				return &s3.HeadObjectOutput{
+					ETag:          &eTag,
+					ContentLength: &contentLength,
+					LastModified:  &lastModified,
+				}, nil
+			},
+		},
+	}
+
+	app.Use(func(ctx *fiber.Ctx) error {
+		utils.ContextKeyAccount.Set(ctx, auth.Account{Access: "valid access"})
+		utils.ContextKeyIsRoot.Set(ctx, true)
+		utils.ContextKeyParsedAcl.Set(ctx, auth.ACL{})
+		return ctx.Next()
+	})
+	app.Get("/:bucket/:key/*", s3ApiController.GetActions)
+	app.Head("/:bucket/:key/*", s3ApiController.HeadObject)
+
+	before := lastModified.Add(-time.Hour).Format(http.TimeFormat)
+	after := lastModified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name       string
+		method     string
+		header     string
+		value      string
+		statusCode int
+	}{
+		{"Get-if-match", http.MethodGet, "If-Match", eTag, 200},
+		{"Get-if-match-failed", http.MethodGet, "If-Match", "\"other\"", 412},
+		{"Get-if-none-match", http.MethodGet, "If-None-Match", eTag, 304},
+		{"Get-if-modified-since", http.MethodGet, "If-Modified-Since", after, 304},
+		{"Get-if-modified-since-modified", http.MethodGet, "If-Modified-Since", before, 200},
+		{"Get-if-unmodified-since", http.MethodGet, "If-Unmodified-Since", before, 412},
+		{"Get-invalid-date-ignored", http.MethodGet, "If-Modified-Since", "not a date", 200},
+		{"Head-if-match-failed", http.MethodHead, "If-Match", "\"other\"", 412},
+		{"Head-if-none-match", http.MethodHead, "If-None-Match", eTag, 304},
+		{"Head-if-modified-since", http.MethodHead, "If-Modified-Since", after, 304},
+		{"Head-if-unmodified-since", http.MethodHead, "If-Unmodified-Since", before, 412},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/my-bucket/my-key", nil)
+			req.Header.Set(tt.header, tt.value)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("statusCode = %v, wantStatusCode = %v", resp.StatusCode, tt.statusCode)
+			}
+
+			// A 304 response has no error body
+			if resp.StatusCode == http.StatusNotModified {
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatalf("read body: %v", err)
+				}
+				if len(body) != 0 {
+					t.Errorf("expected empty 304 body, got %q", body)
+				}
+			}
+		})
+	}
+}
+
 func TestS3ApiController_CreateActions(t *testing.T) {
 	type args struct {
 		req *http.Request
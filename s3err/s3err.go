@@ -167,6 +167,9 @@ const (
 	ErrChecksumTypeWithAlgo
 	ErrInvalidChecksumHeader
 	ErrTrailerHeaderNotSupported
+	ErrSlowDown
+	ErrServiceUnavailable
+	ErrRequestTimeout
 
 	// Non-AWS errors
 	ErrExistingObjectIsDirectory
@@ -175,6 +178,7 @@ const (
 	ErrDirectoryNotEmpty
 	ErrQuotaExceeded
 	ErrVersioningNotConfigured
+	ErrClientClosedRequest
 
 	// Admin api errors
 	ErrAdminAccessDenied
@@ -183,6 +187,9 @@ const (
 	ErrAdminInvalidUserRole
 	ErrAdminMissingUserAcess
 	ErrAdminMethodNotSupported
+
+	ErrInvalidContinuationToken
+	ErrNotModified
 )
 
 var errorCodeResponse = map[ErrorCode]APIError{
@@ -726,6 +733,21 @@ var errorCodeResponse = map[ErrorCode]APIError{
 		Description:    "The value specified in the x-amz-trailer header is not supported",
 		HTTPStatusCode: http.StatusBadRequest,
 	},
+	ErrSlowDown: {
+		Code:           "SlowDown",
+		Description:    "Please reduce your request rate.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	},
+	ErrServiceUnavailable: {
+		Code:           "ServiceUnavailable",
+		Description:    "Service is unable to handle request.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	},
+	ErrRequestTimeout: {
+		Code:           "RequestTimeout",
+		Description:    "Your socket connection to the server was not read from or written to within the timeout period.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
 
 	// non aws errors
 	ErrExistingObjectIsDirectory: {
@@ -758,6 +780,11 @@ var errorCodeResponse = map[ErrorCode]APIError{
 		Description:    "Versioning has not been configured for the gateway.",
 		HTTPStatusCode: http.StatusNotImplemented,
 	},
+	ErrClientClosedRequest: {
+		Code:           "ClientClosedRequest",
+		Description:    "The client closed the request before the response was sent.",
+		HTTPStatusCode: 499,
+	},
 
 	// Admin api errors
 	ErrAdminAccessDenied: {
@@ -790,6 +817,17 @@ var errorCodeResponse = map[ErrorCode]APIError{
 		Description:    "The method is not supported in single root user mode.",
 		HTTPStatusCode: http.StatusNotImplemented,
 	},
+
+	ErrInvalidContinuationToken: {
+		Code:           "InvalidArgument",
+		Description:    "The continuation token provided is incorrect.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrNotModified: {
+		Code:           "NotModified",
+		Description:    "Not Modified",
+		HTTPStatusCode: http.StatusNotModified,
+	},
 }
 
 // GetAPIError provides API Error for input API error code.
@@ -27,6 +27,7 @@ import (
 
 type S3EventSender interface {
 	SendEvent(ctx *fiber.Ctx, meta EventMeta)
+	SendBucketEvent(meta BucketEventMeta)
 	Close() error
 }
 
@@ -38,6 +39,14 @@ type EventMeta struct {
 	VersionId   *string
 }
 
+// BucketEventMeta describes a bucket level event that did not come from an
+// S3 request, such as a backend discovering or losing a bucket
+type BucketEventMeta struct {
+	BucketOwner string
+	EventName   EventType
+	Bucket      string
+}
+
 type EventSchema struct {
 	Records []EventRecord
 }
@@ -195,6 +204,33 @@ func createEventSchema(ctx *fiber.Ctx, meta EventMeta, configId ConfigurationId)
 	}
 }
 
+func createBucketEventSchema(meta BucketEventMeta, configId ConfigurationId) EventSchema {
+	return EventSchema{
+		Records: []EventRecord{
+			{
+				EventVersion: "2.2",
+				EventSource:  "aws:s3",
+				EventTime:    time.Now().Format(time.RFC3339),
+				EventName:    meta.EventName,
+				S3: EventS3Data{
+					S3SchemaVersion: "1.0",
+					ConfigurationId: configId,
+					Bucket: EventS3BucketData{
+						Name: meta.Bucket,
+						OwnerIdentity: EventUserIdentity{
+							PrincipalId: meta.BucketOwner,
+						},
+						Arn: fmt.Sprintf("arn:aws:s3:::%v", meta.Bucket),
+					},
+					Object: EventObjectData{
+						Sequencer: genSequencer(),
+					},
+				},
+			},
+		},
+	}
+}
+
 func generateTestEvent() ([]byte, error) {
 	msg := map[string]string{
 		"Service": "S3",
@@ -41,6 +41,10 @@ const (
 	EventObjectRestore              EventType = "s3:ObjectRestore:*" // ObjectRestore
 	EventObjectRestorePost          EventType = "s3:ObjectRestore:Post"
 	EventObjectRestoreCompleted     EventType = "s3:ObjectRestore:Completed"
+	EventBucketCreated              EventType = "s3:BucketCreated:*" // non AWS custom type for buckets appearing in the backend
+	EventBucketCreatedDiscovered    EventType = "s3:BucketCreated:Discovered"
+	EventBucketRemoved              EventType = "s3:BucketRemoved:*" // non AWS custom type for buckets disappearing from the backend
+	EventBucketRemovedVanished      EventType = "s3:BucketRemoved:Vanished"
 	// EventObjectRestorePost       EventType = "s3:ObjectRestore:Post"
 	// EventObjectRestoreDelete     EventType = "s3:ObjectRestore:Delete"
 )
@@ -66,6 +70,10 @@ var supportedEventFilters = map[EventType]struct{}{
 	EventObjectRestore:              {},
 	EventObjectRestorePost:          {},
 	EventObjectRestoreCompleted:     {},
+	EventBucketCreated:              {},
+	EventBucketCreatedDiscovered:    {},
+	EventBucketRemoved:              {},
+	EventBucketRemovedVanished:      {},
 }
 
 type EventFilter map[EventType]bool
@@ -107,6 +107,19 @@ func (ks *Kafka) SendEvent(ctx *fiber.Ctx, meta EventMeta) {
 	go ks.send(schema)
 }
 
+func (ks *Kafka) SendBucketEvent(meta BucketEventMeta) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if ks.filter != nil && !ks.filter.Filter(meta.EventName) {
+		return
+	}
+
+	schema := createBucketEventSchema(meta, ConfigurationIdKafka)
+
+	go ks.send(schema)
+}
+
 func (ks *Kafka) Close() error {
 	return ks.writer.Close()
 }
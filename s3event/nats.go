@@ -94,6 +94,19 @@ func (ns *NatsEventSender) SendEvent(ctx *fiber.Ctx, meta EventMeta) {
 	go ns.send(schema)
 }
 
+func (ns *NatsEventSender) SendBucketEvent(meta BucketEventMeta) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if ns.filter != nil && !ns.filter.Filter(meta.EventName) {
+		return
+	}
+
+	schema := createBucketEventSchema(meta, ConfigurationIdNats)
+
+	go ns.send(schema)
+}
+
 func (ns *NatsEventSender) Close() error {
 	ns.client.Close()
 	return nil
@@ -106,6 +106,19 @@ func (w *Webhook) SendEvent(ctx *fiber.Ctx, meta EventMeta) {
 	go w.send(schema)
 }
 
+func (w *Webhook) SendBucketEvent(meta BucketEventMeta) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.filter != nil && !w.filter.Filter(meta.EventName) {
+		return
+	}
+
+	schema := createBucketEventSchema(meta, ConfigurationIdWebhook)
+
+	go w.send(schema)
+}
+
 func (w *Webhook) Close() error {
 	return nil
 }
@@ -20804,3 +20804,327 @@ func Versioning_concurrent_upload_object(s *S3Conf) error {
 		return nil
 	}, withVersioning(types.BucketVersioningStatusEnabled))
 }
+
+// Starfish collections are discovered from the Starfish API rather than
+// created through the gateway, so these tests run against the first
+// collection the gateway reports.
+func getStarfishCollection(s3client *s3.Client) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+	out, err := s3client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	cancel()
+	if err != nil {
+		return "", err
+	}
+	if len(out.Buckets) == 0 {
+		return "", fmt.Errorf("expected at least one starfish collection")
+	}
+
+	return getString(out.Buckets[0].Name), nil
+}
+
+// getStarfishObject returns the first object listed in the collection
+func getStarfishObject(s3client *s3.Client, bucket string) (types.Object, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+	out, err := s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  &bucket,
+		MaxKeys: aws.Int32(1),
+	})
+	cancel()
+	if err != nil {
+		return types.Object{}, err
+	}
+	if len(out.Contents) == 0 {
+		return types.Object{}, fmt.Errorf("expected at least one object in collection %v", bucket)
+	}
+
+	return out.Contents[0], nil
+}
+
+func Starfish_ListBuckets_success(s *S3Conf) error {
+	testName := "Starfish_ListBuckets_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		_, err := getStarfishCollection(s3client)
+		return err
+	})
+}
+
+func Starfish_HeadBucket_success(s *S3Conf) error {
+	testName := "Starfish_HeadBucket_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		_, err = s3client.HeadBucket(ctx, &s3.HeadBucketInput{
+			Bucket: &bucket,
+		})
+		cancel()
+		return err
+	})
+}
+
+func Starfish_ListObjects_success(s *S3Conf) error {
+	testName := "Starfish_ListObjects_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		out, err := s3client.ListObjects(ctx, &s3.ListObjectsInput{
+			Bucket: &bucket,
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if getString(out.Name) != bucket {
+			return fmt.Errorf("expected the bucket name to be %v, instead got %v",
+				bucket, getString(out.Name))
+		}
+
+		return nil
+	})
+}
+
+func Starfish_HeadObject_success(s *S3Conf) error {
+	testName := "Starfish_HeadObject_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+		obj, err := getStarfishObject(s3client, bucket)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		out, err := s3client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: &bucket,
+			Key:    obj.Key,
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if getString(out.ETag) != getString(obj.ETag) {
+			return fmt.Errorf("expected the object etag to be %v, instead got %v",
+				getString(obj.ETag), getString(out.ETag))
+		}
+		if out.ContentLength == nil || *out.ContentLength != *obj.Size {
+			return fmt.Errorf("expected the object size to be %v, instead got %v",
+				*obj.Size, out.ContentLength)
+		}
+
+		return nil
+	})
+}
+
+func Starfish_GetObject_success(s *S3Conf) error {
+	testName := "Starfish_GetObject_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+		obj, err := getStarfishObject(s3client, bucket)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		out, err := s3client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: &bucket,
+			Key:    obj.Key,
+		})
+		defer cancel()
+		if err != nil {
+			return err
+		}
+		defer out.Body.Close()
+
+		body, err := io.ReadAll(out.Body)
+		if err != nil {
+			return err
+		}
+		if int64(len(body)) != *obj.Size {
+			return fmt.Errorf("expected the object size to be %v, instead got %v",
+				*obj.Size, len(body))
+		}
+
+		return nil
+	})
+}
+
+func Starfish_GetObject_file_server_success(s *S3Conf) error {
+	testName := "Starfish_GetObject_file_server_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+		obj, err := getStarfishObject(s3client, bucket)
+		if err != nil {
+			return err
+		}
+		if *obj.Size == 0 {
+			return nil
+		}
+
+		// Ranged reads are served by the Starfish file server
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		out, err := s3client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: &bucket,
+			Key:    obj.Key,
+			Range:  getPtr("bytes=0-0"),
+		})
+		defer cancel()
+		if err != nil {
+			return err
+		}
+		defer out.Body.Close()
+
+		body, err := io.ReadAll(out.Body)
+		if err != nil {
+			return err
+		}
+		if len(body) != 1 {
+			return fmt.Errorf("expected a 1 byte range, instead got %v bytes", len(body))
+		}
+
+		return nil
+	})
+}
+
+func Starfish_PutBucketAcl_success(s *S3Conf) error {
+	testName := "Starfish_PutBucketAcl_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		_, err = s3client.PutBucketAcl(ctx, &s3.PutBucketAclInput{
+			Bucket: &bucket,
+			AccessControlPolicy: &types.AccessControlPolicy{
+				Owner: &types.Owner{
+					ID: &s.awsID,
+				},
+				Grants: []types.Grant{
+					{
+						Grantee: &types.Grantee{
+							ID:   &s.awsID,
+							Type: types.TypeCanonicalUser,
+						},
+						Permission: types.PermissionFullControl,
+					},
+				},
+			},
+		})
+		cancel()
+		return err
+	})
+}
+
+func Starfish_GetBucketAcl_success(s *S3Conf) error {
+	testName := "Starfish_GetBucketAcl_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		_, err = s3client.GetBucketAcl(ctx, &s3.GetBucketAclInput{
+			Bucket: &bucket,
+		})
+		cancel()
+		return err
+	})
+}
+
+func Starfish_PutBucketPolicy_success(s *S3Conf) error {
+	testName := "Starfish_PutBucketPolicy_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+
+		doc := genPolicyDoc("Allow", `"*"`, `"s3:GetObject"`, fmt.Sprintf(`"arn:aws:s3:::%v/*"`, bucket))
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		_, err = s3client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+			Bucket: &bucket,
+			Policy: &doc,
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), shortTimeout)
+		out, err := s3client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{
+			Bucket: &bucket,
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+		if getString(out.Policy) != doc {
+			return fmt.Errorf("expected the bucket policy to be %v, instead got %v",
+				doc, getString(out.Policy))
+		}
+
+		return nil
+	})
+}
+
+func Starfish_GetBucketPolicy_not_set(s *S3Conf) error {
+	testName := "Starfish_GetBucketPolicy_not_set"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		_, err = s3client.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{
+			Bucket: &bucket,
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), shortTimeout)
+		_, err = s3client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{
+			Bucket: &bucket,
+		})
+		cancel()
+		return checkApiErr(err, s3err.GetAPIError(s3err.ErrNoSuchBucketPolicy))
+	})
+}
+
+func Starfish_DeleteBucketPolicy_success(s *S3Conf) error {
+	testName := "Starfish_DeleteBucketPolicy_success"
+	return actionHandlerNoSetup(s, testName, func(s3client *s3.Client, _ string) error {
+		bucket, err := getStarfishCollection(s3client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shortTimeout)
+		_, err = s3client.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{
+			Bucket: &bucket,
+		})
+		cancel()
+		return err
+	})
+}